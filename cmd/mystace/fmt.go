@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/mlctrez/mystace/format"
+	"github.com/mlctrez/mystace/source"
+)
+
+func fmtCommand(args []string, stdin io.Reader, stdout, stderr io.Writer) (err error) {
+	fs := newFlagSet("fmt", "[path...]", stderr)
+	check := fs.Bool("check", false, "list the templates that are not formatted and fail if there are any, writing nothing")
+	write := fs.Bool("w", false, "write formatted templates to their files instead of stdout")
+	indent := fs.Int("indent", format.DefaultIndent, "spaces indenting each level of nested sections, with -no-lambdas")
+	noLambdas := fs.Bool("no-lambdas", false, "format the text within sections, which lambdas would receive formatted")
+	ext := fs.String("ext", ".mustache", "extension of the template files read from directories")
+	delims := fs.String("delims", "", "tag delimiters separated by a space: \"<% %>\"")
+	if err = parseFlags(fs, args); err != nil {
+		return
+	}
+	if *indent < 0 {
+		return &usageError{err: fmt.Errorf("negative -indent %d", *indent)}
+	}
+	options := []format.Option{format.WithIndent(*indent)}
+	if *noLambdas {
+		options = append(options, format.WithoutLambdas())
+	}
+	if *delims != "" {
+		var open, close string
+		if open, close, err = delimiters(*delims); err != nil {
+			return
+		}
+		options = append(options, format.WithDelimiters(open, close))
+	}
+
+	if fs.NArg() == 0 {
+		if *write {
+			return &usageError{err: fmt.Errorf("-w requires template paths")}
+		}
+		var data []byte
+		if data, err = io.ReadAll(stdin); err != nil {
+			return
+		}
+		var formatted string
+		if formatted, err = formatTemplate("<stdin>", data, options); err != nil {
+			return
+		}
+		if *check {
+			if formatted != string(data) {
+				fmt.Fprintln(stdout, "<stdin>")
+				return fmt.Errorf("1 template is not formatted")
+			}
+			return nil
+		}
+		_, err = io.WriteString(stdout, formatted)
+		return
+	}
+
+	var paths []string
+	if paths, err = templatePaths(fs.Args(), *ext); err != nil {
+		return
+	}
+	unformatted := 0
+	for _, path := range paths {
+		var data []byte
+		if data, err = os.ReadFile(path); err != nil {
+			return
+		}
+		var formatted string
+		if formatted, err = formatTemplate(path, data, options); err != nil {
+			return
+		}
+		switch {
+		case *check:
+			if formatted != string(data) {
+				unformatted++
+				fmt.Fprintln(stdout, path)
+			}
+		case *write:
+			if formatted != string(data) {
+				if err = os.WriteFile(path, []byte(formatted), 0644); err != nil {
+					return
+				}
+			}
+		default:
+			if _, err = io.WriteString(stdout, formatted); err != nil {
+				return
+			}
+		}
+	}
+	if unformatted > 0 {
+		return fmt.Errorf("%d templates are not formatted", unformatted)
+	}
+	return nil
+}
+
+// formatTemplate formats the template data read from path
+func formatTemplate(path string, data []byte, options []format.Option) (string, error) {
+	src, err := source.FromString(string(data), source.WithName(path))
+	if err != nil {
+		return "", err
+	}
+	return format.Source(src, options...)
+}
+
+// templatePaths returns the files of paths and the files ending in ext below the directories of paths
+func templatePaths(paths []string, ext string) (files []string, err error) {
+	for _, path := range paths {
+		var info os.FileInfo
+		if info, err = os.Stat(path); err != nil {
+			return
+		}
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+		err = filepath.WalkDir(path, func(p string, d os.DirEntry, walkErr error) error {
+			if walkErr == nil && !d.IsDir() && filepath.Ext(p) == ext {
+				files = append(files, p)
+			}
+			return walkErr
+		})
+		if err != nil {
+			return
+		}
+	}
+	return
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mlctrez/mystace/internal/testify"
+)
+
+func TestFmtCommand(t *testing.T) {
+	_, require := testify.New(t)
+
+	dir := writeFiles(t, map[string]string{
+		"page.mustache":     "{{ title }}\n{{# items }}\n      {{#ok}}\nx\n{{/ok}}\n{{/ items }}\n",
+		"done.mustache":     "{{title}}\n",
+		"nested/a.mustache": "{{& a }}",
+		"broken.txt":        "{{#a}}",
+		"skipped.txt":       "{{ a }}",
+	})
+	page := filepath.Join(dir, "page.mustache")
+	formatted := "{{title}}\n{{#items}}\n  {{#ok}}\nx\n{{/ok}}\n{{/items}}\n"
+
+	// the text within sections is passed to lambdas as written
+	code, stdout, stderr := runArgs("", "fmt", page)
+	require.Equal(exitOK, code, stderr)
+	require.Equal("{{title}}\n{{#items}}\n      {{#ok}}\nx\n{{/ok}}\n{{/items}}\n", stdout)
+
+	code, stdout, stderr = runArgs("", "fmt", "-no-lambdas", page)
+	require.Equal(exitOK, code, stderr)
+	require.Equal(formatted, stdout)
+
+	code, stdout, stderr = runArgs("", "fmt", "-check", dir)
+	require.Equal(exitError, code)
+	require.Equal(filepath.Join(dir, "nested", "a.mustache")+"\n"+page+"\n", stdout)
+	require.Contains(stderr, "2 templates are not formatted")
+
+	code, _, _ = runArgs("", "fmt", "-w", "-no-lambdas", dir)
+	require.Equal(exitOK, code)
+	written, err := os.ReadFile(page)
+	require.Nil(err)
+	require.Equal(formatted, string(written))
+
+	code, stdout, _ = runArgs("", "fmt", "-check", dir)
+	require.Equal(exitOK, code)
+	require.Equal("", stdout)
+
+	code, stdout, _ = runArgs("{{ a }}", "fmt", "-indent", "4")
+	require.Equal(exitOK, code)
+	require.Equal("{{a}}", stdout)
+
+	code, stdout, _ = runArgs("<% a %>", "fmt", "-check", "-delims", "<% %>")
+	require.Equal(exitError, code)
+	require.Equal("<stdin>\n", stdout)
+
+	code, _, stderr = runArgs("", "fmt", filepath.Join(dir, "broken.txt"))
+	require.Equal(exitError, code)
+	require.Contains(stderr, "missing close tag")
+
+	for _, args := range [][]string{{"-w"}, {"-indent", "-1", dir}, {"-delims", "<%", dir}} {
+		code, _, _ = runArgs("", append([]string{"fmt"}, args...)...)
+		require.Equal(exitUsage, code, args)
+	}
+}
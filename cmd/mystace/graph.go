@@ -0,0 +1,57 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/mlctrez/mystace/render"
+)
+
+func graphCommand(args []string, _ io.Reader, stdout, stderr io.Writer) (err error) {
+	fs := newFlagSet("graph", "path...", stderr)
+	format := fs.String("format", "dot", "output format: dot or json")
+	ext := fs.String("ext", ".mustache", "extension of the template files read from directories")
+	delims := fs.String("delims", "", "tag delimiters separated by a space: \"<% %>\"")
+	check := fs.Bool("check", false, "fail when partials include themselves, directly or through others")
+	if err = parseFlags(fs, args); err != nil {
+		return
+	}
+	if *format != "dot" && *format != "json" {
+		return &usageError{err: fmt.Errorf("unknown -format %q", *format)}
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return &usageError{err: fmt.Errorf("expected template files or directories"), reported: true}
+	}
+	// cycles are reported in the graph rather than rejected
+	options := []render.Option{render.WithMaxPartialDepth(render.DefaultMaxPartialDepth)}
+	if *delims != "" {
+		var open, close string
+		if open, close, err = delimiters(*delims); err != nil {
+			return
+		}
+		options = append(options, render.WithDelimiters(open, close))
+	}
+
+	files, err := readPaths(fs.Args(), *ext)
+	if err != nil {
+		return
+	}
+	r := render.New(options...)
+	if err = addSources(r, files); err != nil {
+		return
+	}
+	g := r.Graph()
+	if *format == "json" {
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(g)
+	} else {
+		err = g.WriteDOT(stdout)
+	}
+	if err == nil && *check && len(g.Cycles) > 0 {
+		err = fmt.Errorf("%d partial cycles", len(g.Cycles))
+	}
+	return
+}
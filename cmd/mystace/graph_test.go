@@ -0,0 +1,35 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/mlctrez/mystace/internal/testify"
+	"github.com/mlctrez/mystace/render"
+)
+
+func TestGraphCommand(t *testing.T) {
+	_, require := testify.New(t)
+
+	dir := writeFiles(t, map[string]string{
+		"page.mustache":          "{{> partials/node}}{{> footer}}",
+		"partials/node.mustache": "{{name}}{{#children}}{{> partials/node}}{{/children}}",
+	})
+
+	code, stdout, stderr := runArgs("", "graph", dir)
+	require.Equal(exitOK, code, stderr)
+	require.Equal("digraph partials {\n\t\"page\";\n\t\"partials/node\";\n\t\"footer\" [style=dashed];\n"+
+		"\t\"page\" -> \"partials/node\";\n\t\"page\" -> \"footer\";\n\t\"partials/node\" -> \"partials/node\" [color=red];\n}\n", stdout)
+
+	code, stdout, _ = runArgs("", "graph", "-format", "json", "-check", dir)
+	require.Equal(exitError, code)
+	var g render.Graph
+	require.Nil(json.Unmarshal([]byte(stdout), &g))
+	require.Equal([]string{"footer"}, g.Missing)
+	require.Equal([][]string{{"partials/node"}}, g.Cycles)
+
+	code, _, _ = runArgs("", "graph", "-format", "svg", dir)
+	require.Equal(exitUsage, code)
+	code, _, _ = runArgs("", "graph")
+	require.Equal(exitUsage, code)
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/mlctrez/mystace/lexer"
+	"github.com/mlctrez/mystace/lint"
+	"github.com/mlctrez/mystace/source"
+)
+
+// lintWriters are the values of the -format flag of lint
+var lintWriters = map[string]func(w io.Writer, problems []lint.Problem) error{
+	"text":  lint.WriteText,
+	"json":  lint.WriteJSON,
+	"sarif": lint.WriteSARIF,
+}
+
+// lintFailOn are the severities failing the command by value of the -fail-on flag
+var lintFailOn = map[string]map[lint.Severity]bool{
+	string(lint.SeverityError):   {lint.SeverityError: true},
+	string(lint.SeverityWarning): {lint.SeverityError: true, lint.SeverityWarning: true},
+	"none":                       {},
+}
+
+func lintCommand(args []string, _ io.Reader, stdout, stderr io.Writer) (err error) {
+	fs := newFlagSet("lint", "path...", stderr)
+	format := fs.String("format", "text", "output format: text, json or sarif")
+	enable := fs.String("enable", "", "comma separated rules to run instead of all rules")
+	disable := fs.String("disable", "", "comma separated rules to skip")
+	roots := fs.String("roots", "", "comma separated templates rendered directly, enables the "+lint.RuleUnusedPartial+" rule")
+	ext := fs.String("ext", ".mustache", "extension of the template files read from directories")
+	delims := fs.String("delims", "", "tag delimiters separated by a space: \"<% %>\"")
+	failOn := fs.String("fail-on", string(lint.SeverityError), "lowest severity of the problems failing the command: error, warning or none")
+	rules := fs.Bool("rules", false, "list the rules and exit")
+	if err = parseFlags(fs, args); err != nil {
+		return
+	}
+	if *rules {
+		for _, r := range lint.Rules {
+			fmt.Fprintf(stdout, "%-20s %-8s %s\n", r.Name, r.Severity, r.Description)
+		}
+		return
+	}
+	write, ok := lintWriters[*format]
+	if !ok {
+		return &usageError{err: fmt.Errorf("unknown -format %q", *format)}
+	}
+	failing, ok := lintFailOn[*failOn]
+	if !ok {
+		return &usageError{err: fmt.Errorf("unknown -fail-on %q", *failOn)}
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return &usageError{err: fmt.Errorf("expected template files or directories"), reported: true}
+	}
+
+	var options []lint.Option
+	if *enable != "" {
+		options = append(options, lint.WithRules(splitList(*enable)...))
+	}
+	if *disable != "" {
+		options = append(options, lint.WithoutRules(splitList(*disable)...))
+	}
+	if *roots != "" {
+		options = append(options, lint.WithRoots(splitList(*roots)...))
+	}
+	if *delims != "" {
+		var open, close string
+		if open, close, err = delimiters(*delims); err != nil {
+			return
+		}
+		options = append(options, lint.WithLexerOptions(lexer.WithDelimiters(open, close)))
+	}
+
+	files, err := readPaths(fs.Args(), *ext)
+	if err != nil {
+		return
+	}
+	var sources []source.Source
+	for _, name := range sortedNames(files) {
+		sources = append(sources, files[name].src)
+	}
+	problems, err := lint.Lint(sources, options...)
+	if err != nil {
+		return &usageError{err: err}
+	}
+	for i := range problems {
+		problems[i].Source = files[problems[i].Source].path
+	}
+	if err = write(stdout, problems); err != nil {
+		return
+	}
+	failed := 0
+	for _, p := range problems {
+		if failing[p.Severity] {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d problems", failed)
+	}
+	return nil
+}
+
+// splitList splits a comma separated flag value
+func splitList(value string) (items []string) {
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return
+}
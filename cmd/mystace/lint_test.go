@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"testing"
+
+	"github.com/mlctrez/mystace/internal/testify"
+	"github.com/mlctrez/mystace/lint"
+)
+
+func TestLintCommand(t *testing.T) {
+	_, require := testify.New(t)
+
+	dir := writeFiles(t, map[string]string{
+		"page.mustache":          "<p>{{{name}}}</p>{{> partials/item}}",
+		"partials/item.mustache": "{{#a}}{{/a}}",
+		"partials/old.mustache":  "old",
+	})
+
+	// warnings are reported without failing the command
+	code, stdout, _ := runArgs("", "lint", dir)
+	require.Equal(exitOK, code)
+	require.Equal(filepath.Join(dir, "page.mustache")+":1:4: warning unescaped-html : value written without html escaping\n"+
+		filepath.Join(dir, "partials", "item.mustache")+":1:1: warning empty-section : section \"a\" is empty\n", stdout)
+
+	code, _, stderr := runArgs("", "lint", "-fail-on", "warning", dir)
+	require.Equal(exitError, code)
+	require.Contains(stderr, "2 problems")
+
+	code, stdout, _ = runArgs("", "lint", "-format", "json", "-disable", lint.RuleEmptySection, "-roots", "page", dir)
+	require.Equal(exitOK, code)
+	var problems []lint.Problem
+	require.Nil(json.Unmarshal([]byte(stdout), &problems))
+	require.Len(problems, 2)
+	require.Equal(lint.RuleUnescapedHTML, problems[0].Rule)
+	require.Equal(lint.RuleUnusedPartial, problems[1].Rule)
+	require.Equal(filepath.Join(dir, "partials", "old.mustache"), problems[1].Source)
+
+	code, stdout, _ = runArgs("", "lint", "-format", "sarif", "-enable", lint.RuleMissingPartial, dir)
+	require.Equal(exitOK, code)
+	require.Contains(stdout, `"version": "2.1.0"`)
+
+	code, stdout, _ = runArgs("", "lint", "-rules")
+	require.Equal(exitOK, code)
+	require.Contains(stdout, lint.RuleShadowedName)
+
+	code, _, _ = runArgs("", "lint", "-delims", "<% %>", "-enable", lint.RuleEmptySection, filepath.Join(dir, "page.mustache"))
+	require.Equal(exitOK, code)
+
+	broken := writeFiles(t, map[string]string{"broken.mustache": "{{#a}}{{{b}}}"})
+	code, _, stderr = runArgs("", "lint", broken)
+	require.Equal(exitError, code)
+	require.Contains(stderr, "1 problems")
+	code, _, _ = runArgs("", "lint", "-fail-on", "none", broken)
+	require.Equal(exitOK, code)
+
+	for _, args := range [][]string{{}, {"-format", "xml", dir}, {"-enable", "nope", dir}, {"-delims", "x", dir}, {"-fail-on", "info", dir}} {
+		code, _, _ = runArgs("", append([]string{"lint"}, args...)...)
+		require.Equal(exitUsage, code, args)
+	}
+
+	code, _, stderr = runArgs("", "lint", dir, filepath.Join(dir, "page.mustache"))
+	require.Equal(exitError, code)
+	require.Contains(stderr, `are both named "page"`)
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/mlctrez/mystace/lsp"
+)
+
+func lspCommand(args []string, stdin io.Reader, stdout, stderr io.Writer) (err error) {
+	fs := newFlagSet("lsp", "", stderr)
+	schemaPath := fs.String("schema", "", "JSON Schema file completing names, such as one written by the schema package")
+	data := fs.String("data", "", "sample data file completing names, .json, .yaml, .yml or .toml")
+	ext := fs.String("ext", lsp.DefaultExtension, "extension of the template files in the workspace")
+	delims := fs.String("delims", "", "tag delimiters separated by a space: \"<% %>\"")
+	if err = parseFlags(fs, args); err != nil {
+		return
+	}
+	if fs.NArg() != 0 {
+		return &usageError{err: fmt.Errorf("unexpected arguments %q", fs.Args())}
+	}
+	if *schemaPath != "" && *data != "" {
+		return &usageError{err: fmt.Errorf("-schema and -data are exclusive")}
+	}
+	options := []lsp.Option{lsp.WithExtension(*ext)}
+	switch {
+	case *schemaPath != "":
+		s, schemaErr := lsp.ReadSchema(*schemaPath)
+		if schemaErr != nil {
+			return schemaErr
+		}
+		options = append(options, lsp.WithSchema(s))
+	case *data == "-":
+		return &usageError{err: fmt.Errorf("-data cannot read stdin, the protocol uses it")}
+	case *data != "":
+		ctx, dataErr := readData(*data, "", stdin)
+		if dataErr != nil {
+			return dataErr
+		}
+		options = append(options, lsp.WithData(ctx))
+	}
+	if *delims != "" {
+		var open, close string
+		if open, close, err = delimiters(*delims); err != nil {
+			return
+		}
+		options = append(options, lsp.WithDelimiters(open, close))
+	}
+
+	var server *lsp.Server
+	if server, err = lsp.NewServer(options...); err != nil {
+		return
+	}
+	return server.Serve(stdin, stdout)
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/mlctrez/mystace/internal/testify"
+)
+
+// frame writes a json-rpc message with its Content-Length header
+func frame(body string) string {
+	return fmt.Sprintf("Content-Length: %d\r\n\r\n%s", len(body), body)
+}
+
+func TestLspCommand(t *testing.T) {
+	_, require := testify.New(t)
+
+	dir := writeFiles(t, map[string]string{
+		"data.json":   `{"title":"t","items":[{"name":"a"}]}`,
+		"schema.json": `{"type":"object","properties":{"title":{"type":"string"}}}`,
+	})
+	session := frame(`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{}}`) +
+		frame(`{"jsonrpc":"2.0","method":"textDocument/didOpen","params":{"textDocument":{"uri":"file:///page.mustache","version":1,"text":"{{#items}}{{"}}}`) +
+		frame(`{"jsonrpc":"2.0","id":2,"method":"textDocument/completion","params":{"textDocument":{"uri":"file:///page.mustache"},"position":{"line":0,"character":12}}}`) +
+		frame(`{"jsonrpc":"2.0","id":3,"method":"shutdown"}`) +
+		frame(`{"jsonrpc":"2.0","method":"exit"}`)
+
+	code, stdout, stderr := runArgs(session, "lsp", "-data", filepath.Join(dir, "data.json"))
+	require.Equal(exitOK, code, stderr)
+	require.Contains(stdout, `"hoverProvider":true`)
+	require.Contains(stdout, `"method":"textDocument/publishDiagnostics"`)
+	require.Contains(stdout, `"result":[{"label":"name","kind":6,"detail":"string"},{"label":"items","kind":22,"detail":"array"},{"label":"title","kind":6,"detail":"string"}]`)
+
+	code, stdout, _ = runArgs(session, "lsp", "-schema", filepath.Join(dir, "schema.json"))
+	require.Equal(exitOK, code)
+	require.Contains(stdout, `"result":[{"label":"title","kind":6,"detail":"string"}]`)
+
+	code, _, stderr = runArgs("", "lsp")
+	require.Equal(exitError, code)
+	require.Contains(stderr, "exit without shutdown")
+
+	code, _, _ = runArgs("", "lsp", "-schema", "a.json", "-data", "b.json")
+	require.Equal(exitUsage, code)
+	code, _, _ = runArgs("", "lsp", "-data", "-")
+	require.Equal(exitUsage, code)
+	code, _, _ = runArgs("", "lsp", "extra")
+	require.Equal(exitUsage, code)
+}
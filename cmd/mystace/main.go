@@ -0,0 +1,123 @@
+// Command mystace renders mustache templates.
+//
+//	mystace render [flags] template
+//	mystace lint [flags] path...
+//	mystace fmt [flags] [path...]
+//	mystace graph [flags] path...
+//	mystace lsp [flags]
+//
+// Run a command with -h for its flags.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+)
+
+// exit codes
+const (
+	exitOK    = 0
+	exitError = 1
+	exitUsage = 2
+)
+
+// command runs with the arguments following its name and returns an error to exit with exitError.
+// Errors from parsing flags or arguments are wrapped in usageError to exit with exitUsage.
+type command struct {
+	summary string
+	run     func(args []string, stdin io.Reader, stdout, stderr io.Writer) error
+}
+
+var commands = map[string]command{
+	"fmt":    {summary: "format templates canonically", run: fmtCommand},
+	"graph":  {summary: "print the partials included by templates", run: graphCommand},
+	"lint":   {summary: "report problems in templates", run: lintCommand},
+	"lsp":    {summary: "serve the language server protocol over stdio", run: lspCommand},
+	"render": {summary: "render a template with data", run: renderCommand},
+}
+
+type usageError struct {
+	err error
+	// reported is set when the flag package already wrote the error and usage
+	reported bool
+}
+
+func (e *usageError) Error() string {
+	return e.err.Error()
+}
+
+func (e *usageError) Unwrap() error {
+	return e.err
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if len(args) == 0 || args[0] == "help" || args[0] == "-h" || args[0] == "--help" {
+		usage(stderr)
+		return exitUsage
+	}
+	c, ok := commands[args[0]]
+	if !ok {
+		fmt.Fprintf(stderr, "mystace: unknown command %q\n", args[0])
+		usage(stderr)
+		return exitUsage
+	}
+	err := c.run(args[1:], stdin, stdout, stderr)
+	var ue *usageError
+	switch {
+	case err == nil:
+		return exitOK
+	case errors.Is(err, flag.ErrHelp):
+		return exitUsage
+	case errors.As(err, &ue):
+		if !ue.reported {
+			fmt.Fprintf(stderr, "mystace %s: %s\n", args[0], err)
+		}
+		return exitUsage
+	}
+	fmt.Fprintf(stderr, "mystace %s: %s\n", args[0], err)
+	return exitError
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "usage: mystace <command> [flags] [arguments]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "commands:")
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(w, "  %-10s %s\n", name, commands[name].summary)
+	}
+}
+
+// newFlagSet returns a flag set for the command name writing its usage to stderr
+func newFlagSet(name, arguments string, stderr io.Writer) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(stderr, "usage: mystace %s [flags] %s\n", name, arguments)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// parseFlags parses args with fs, wrapping errors other than flag.ErrHelp in usageError
+func parseFlags(fs *flag.FlagSet, args []string) error {
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return err
+		}
+		return &usageError{err: err, reported: true}
+	}
+	return nil
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/mlctrez/mystace/internal/testify"
+)
+
+// runArgs runs the command line args and returns the exit code and output
+func runArgs(stdin string, args ...string) (code int, stdout, stderr string) {
+	out, errOut := &bytes.Buffer{}, &bytes.Buffer{}
+	code = run(args, strings.NewReader(stdin), out, errOut)
+	return code, out.String(), errOut.String()
+}
+
+func TestRun(t *testing.T) {
+	_, require := testify.New(t)
+
+	code, _, stderr := runArgs("")
+	require.Equal(exitUsage, code)
+	require.Contains(stderr, "render")
+
+	code, _, stderr = runArgs("", "unknown")
+	require.Equal(exitUsage, code)
+	require.Contains(stderr, `unknown command "unknown"`)
+
+	code, _, stderr = runArgs("", "render", "-h")
+	require.Equal(exitUsage, code)
+	require.Contains(stderr, "usage: mystace render [flags] template")
+
+	code, _, stderr = runArgs("", "render", "-unknown")
+	require.Equal(exitUsage, code)
+	require.Equal(1, strings.Count(stderr, "flag provided but not defined"))
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mlctrez/mystace/context"
+	"github.com/mlctrez/mystace/render"
+)
+
+// loaders decode data by format, the format of a data file is its extension
+var loaders = map[string]func(r io.Reader) (*context.Context, error){
+	"json": context.FromJSON,
+	"yaml": context.FromYAML,
+	"yml":  context.FromYAML,
+	"toml": context.FromTOML,
+}
+
+// escapers are the values of the -escape flag, html is the default escaping of render
+var escapers = map[string]func(s string) string{
+	"html": nil,
+	"none": func(s string) string { return s },
+}
+
+func renderCommand(args []string, stdin io.Reader, stdout, stderr io.Writer) (err error) {
+	fs := newFlagSet("render", "template", stderr)
+	data := fs.String("data", "", "data file, .json, .yaml, .yml or .toml, or - to read stdin")
+	format := fs.String("format", "json", "format of data read from stdin: json, yaml or toml")
+	output := fs.String("o", "", "output file, written only when rendering succeeds (default stdout)")
+	name := fs.String("name", "", "name of the template to render when template is a directory: partials/card")
+	ext := fs.String("ext", ".mustache", "extension of the template files registered as partials")
+	strict := fs.Bool("strict", false, "fail on variables and partials that are missing")
+	escape := fs.String("escape", "html", "escaping of {{name}} tags: html or none")
+	delims := fs.String("delims", "", "tag delimiters separated by a space: \"<% %>\"")
+	maxDepth := fs.Int("max-depth", 0, "allow recursive partials nested up to this depth")
+	if err = parseFlags(fs, args); err != nil {
+		return
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return &usageError{err: fmt.Errorf("expected one template, got %d arguments", fs.NArg()), reported: true}
+	}
+
+	var options []render.Option
+	if *strict {
+		options = append(options, render.WithStrict())
+	}
+	escaper, ok := escapers[*escape]
+	if !ok {
+		return &usageError{err: fmt.Errorf("unknown -escape %q", *escape)}
+	}
+	if escaper != nil {
+		options = append(options, render.WithEscaper(escaper))
+	}
+	if *delims != "" {
+		var open, close string
+		if open, close, err = delimiters(*delims); err != nil {
+			return
+		}
+		options = append(options, render.WithDelimiters(open, close))
+	}
+	if *maxDepth < 0 {
+		return &usageError{err: fmt.Errorf("negative -max-depth %d", *maxDepth)}
+	}
+	if *maxDepth > 0 {
+		options = append(options, render.WithMaxPartialDepth(*maxDepth))
+	}
+
+	ctx, err := readData(*data, *format, stdin)
+	if err != nil {
+		return
+	}
+
+	template, files, err := loadTemplates(fs.Arg(0), *name, *ext)
+	if err != nil {
+		return
+	}
+	sources, err := included(template, files, options)
+	if err != nil {
+		return
+	}
+	forever := render.CachePolicy{TTL: render.CacheForever, NegativeTTL: render.CacheForever}
+	r := render.New(append(options, render.WithPartialLoader(fileLoader(files), forever))...)
+	if err = addSources(r, sources); err != nil {
+		return
+	}
+	buf := &bytes.Buffer{}
+	r.Writer(buf)
+	if err = r.Render(template, ctx); err != nil {
+		return locate(err, files)
+	}
+
+	if *output == "" {
+		_, err = stdout.Write(buf.Bytes())
+		return
+	}
+	return os.WriteFile(*output, buf.Bytes(), 0644)
+}
+
+// readData reads the data file at path, stdin in format when path is - and no data when it is empty
+func readData(path, format string, stdin io.Reader) (*context.Context, error) {
+	switch path {
+	case "":
+		return context.New(map[string]interface{}{}), nil
+	case "-":
+		load, ok := loaders[format]
+		if !ok {
+			return nil, &usageError{err: fmt.Errorf("unknown -format %q", format)}
+		}
+		return load(stdin)
+	}
+	load, ok := loaders[strings.TrimPrefix(filepath.Ext(path), ".")]
+	if !ok {
+		return nil, &usageError{err: fmt.Errorf("unknown data file extension %q", filepath.Ext(path))}
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+	ctx, err := load(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s : %w", path, err)
+	}
+	return ctx, nil
+}
+
+// delimiters splits the value of a -delims flag
+func delimiters(value string) (open, close string, err error) {
+	d := strings.Fields(value)
+	if len(d) != 2 {
+		return "", "", &usageError{err: fmt.Errorf("-delims %q is not two delimiters separated by a space", value)}
+	}
+	return d[0], d[1], nil
+}
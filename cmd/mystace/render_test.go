@@ -0,0 +1,121 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mlctrez/mystace/internal/testify"
+)
+
+// writeFiles writes files by relative path below a temporary directory and returns it
+func writeFiles(t *testing.T, files map[string]string) string {
+	dir := t.TempDir()
+	for path, content := range files {
+		path = filepath.Join(dir, filepath.FromSlash(path))
+		testify.Require(t).Nil(os.MkdirAll(filepath.Dir(path), 0755))
+		testify.Require(t).Nil(os.WriteFile(path, []byte(content), 0644))
+	}
+	return dir
+}
+
+func TestRenderCommand(t *testing.T) {
+	_, require := testify.New(t)
+
+	dir := writeFiles(t, map[string]string{
+		"page.mustache":          "<h1>{{title}}</h1>{{#items}}{{> partials/item}}{{/items}}\n",
+		"partials/item.mustache": "<p>{{name}}</p>",
+		"broken.mustache":        "ok\n{{#open}}",
+		"data.json":              `{"title": "a & b", "items": [{"name": "x"}, {"name": "y"}]}`,
+		"data.yaml":              "title: yaml\nitems: []\n",
+		"data.txt":               "",
+	})
+	page := filepath.Join(dir, "page.mustache")
+
+	code, stdout, stderr := runArgs("", "render", "-data", filepath.Join(dir, "data.json"), page)
+	require.Equal(exitOK, code, stderr)
+	require.Equal("<h1>a &amp; b</h1><p>x</p><p>y</p>\n", stdout)
+
+	code, stdout, _ = runArgs("title: stdin\nitems: []\n", "render", "-data", "-", "-format", "yaml", "-escape", "none", "-name", "page", dir)
+	require.Equal(exitOK, code)
+	require.Equal("<h1>stdin</h1>\n", stdout)
+
+	out := filepath.Join(dir, "out.html")
+	code, stdout, _ = runArgs("", "render", "-data", filepath.Join(dir, "data.yaml"), "-o", out, page)
+	require.Equal(exitOK, code)
+	require.Equal("", stdout)
+	written, err := os.ReadFile(out)
+	require.Nil(err)
+	require.Equal("<h1>yaml</h1>\n", string(written))
+
+	code, _, stderr = runArgs("", "render", "-strict", page)
+	require.Equal(exitError, code)
+	require.Contains(stderr, page+":1:5: {{title}} : missing var")
+
+	code, _, stderr = runArgs("", "render", filepath.Join(dir, "broken.mustache"))
+	require.Equal(exitError, code)
+	require.Contains(stderr, filepath.Join(dir, "broken.mustache")+":2:1: {{#open}} : unable to find close")
+
+	code, _, stderr = runArgs("", "render", "-name", "missing", dir)
+	require.Equal(exitError, code)
+	require.Contains(stderr, `template "missing" not found`)
+
+	for _, args := range [][]string{
+		{dir},
+		{"-escape", "js", page},
+		{"-delims", "<%", page},
+		{"-data", filepath.Join(dir, "data.txt"), page},
+		{"-data", "-", "-format", "xml", page},
+		{page, page},
+	} {
+		code, _, _ = runArgs("", append([]string{"render"}, args...)...)
+		require.Equal(exitUsage, code, args)
+	}
+}
+
+func TestRenderCommand_Delimiters(t *testing.T) {
+	_, require := testify.New(t)
+
+	dir := writeFiles(t, map[string]string{"main.go.tpl": "func main() { fmt.Println(\"<% greeting %>\") }"})
+	code, stdout, stderr := runArgs(`{"greeting": "hi"}`, "render", "-data", "-", "-delims", "<% %>", "-ext", ".tpl", filepath.Join(dir, "main.go.tpl"))
+	require.Equal(exitOK, code, stderr)
+	require.Equal("func main() { fmt.Println(\"hi\") }", stdout)
+}
+
+func TestRenderCommand_MaxDepth(t *testing.T) {
+	_, require := testify.New(t)
+
+	dir := writeFiles(t, map[string]string{"node.mustache": "<{{name}}{{#children}}{{> node}}{{/children}}>"})
+	data := `{"name": "a", "children": [{"name": "b", "children": []}]}`
+	code, _, stderr := runArgs(data, "render", "-data", "-", filepath.Join(dir, "node.mustache"))
+	require.Equal(exitError, code)
+	require.Contains(stderr, "node > node : partial cycle")
+
+	code, stdout, stderr := runArgs(data, "render", "-data", "-", "-max-depth", "5", filepath.Join(dir, "node.mustache"))
+	require.Equal(exitOK, code, stderr)
+	require.Equal("<a<b>>", stdout)
+}
+
+func TestRenderCommand_UnusedPartials(t *testing.T) {
+	_, require := testify.New(t)
+
+	dir := writeFiles(t, map[string]string{
+		"page.mustache":   "{{> header}}{{>*body}}",
+		"header.mustache": "<h1>{{title}}</h1>",
+		"body.mustache":   "<p>body</p>",
+		"a.mustache":      "{{> b}}",
+		"b.mustache":      "{{> a}}",
+	})
+	data := `{"title": "t", "body": "body"}`
+	code, stdout, stderr := runArgs(data, "render", "-data", "-", filepath.Join(dir, "page.mustache"))
+	require.Equal(exitOK, code, stderr)
+	require.Equal("<h1>t</h1><p>body</p>", stdout)
+
+	code, _, stderr = runArgs(`{"body": "a"}`, "render", "-data", "-", filepath.Join(dir, "page.mustache"))
+	require.Equal(exitError, code)
+	require.Contains(stderr, "partials nested too deeply")
+
+	code, _, stderr = runArgs("", "render", "-name", "a", dir)
+	require.Equal(exitError, code)
+	require.Contains(stderr, "partial cycle")
+}
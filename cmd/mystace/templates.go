@@ -0,0 +1,213 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/mlctrez/mystace/render"
+	"github.com/mlctrez/mystace/source"
+)
+
+// templateFile is a template read from disk, its name is the path relative to the
+// template directory without extension and with slashes: partials/card
+type templateFile struct {
+	name string
+	path string
+	text string
+	src  source.Source
+}
+
+// source returns a new source reading the file, src is read once by the renderer it is added to
+func (f *templateFile) source() (source.Source, error) {
+	return source.FromString(f.text, source.WithName(f.name))
+}
+
+// templateName returns the name of the file at path within dir
+func templateName(dir, path string) (string, error) {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil {
+		return "", err
+	}
+	return filepath.ToSlash(strings.TrimSuffix(rel, filepath.Ext(rel))), nil
+}
+
+// readTemplate reads the file at path as the source name
+func readTemplate(name, path string) (*templateFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	src, err := source.FromString(string(data), source.WithName(name))
+	if err != nil {
+		return nil, err
+	}
+	return &templateFile{name: name, path: path, text: string(data), src: src}, nil
+}
+
+// readTemplates reads the files ending in ext below dir, sorted by name
+func readTemplates(dir, ext string) (files []*templateFile, err error) {
+	err = filepath.WalkDir(dir, func(path string, d fs.DirEntry, walkErr error) error {
+		if walkErr != nil || d.IsDir() || filepath.Ext(path) != ext {
+			return walkErr
+		}
+		name, nameErr := templateName(dir, path)
+		if nameErr != nil {
+			return nameErr
+		}
+		file, readErr := readTemplate(name, path)
+		if readErr == nil {
+			files = append(files, file)
+		}
+		return readErr
+	})
+	sort.Slice(files, func(i, j int) bool { return files[i].name < files[j].name })
+	return
+}
+
+// loadTemplates reads the template at path and the files ending in ext in its directory,
+// which are available as partials by name, see included. When path is a directory, name selects the
+// template to render. It returns the name of the template and the files by name.
+func loadTemplates(path, name, ext string) (string, map[string]*templateFile, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", nil, err
+	}
+	dir := path
+	if !info.IsDir() {
+		dir = filepath.Dir(path)
+		if name, err = templateName(dir, path); err != nil {
+			return "", nil, err
+		}
+	} else if name == "" {
+		return "", nil, &usageError{err: fmt.Errorf("-name is required when %s is a directory", path)}
+	}
+	files, err := readTemplates(dir, ext)
+	if err != nil {
+		return "", nil, err
+	}
+	byName := map[string]*templateFile{}
+	for _, f := range files {
+		byName[f.name] = f
+	}
+	if !info.IsDir() && byName[name] == nil {
+		var f *templateFile
+		if f, err = readTemplate(name, path); err != nil {
+			return "", nil, err
+		}
+		byName[name] = f
+	}
+	if byName[name] == nil {
+		return "", nil, fmt.Errorf("template %q not found in %s", name, dir)
+	}
+	return name, byName, nil
+}
+
+// addSources adds the sources of files to r in order of their names
+func addSources(r render.Render, files map[string]*templateFile) error {
+	for _, name := range sortedNames(files) {
+		if err := r.AddSource(files[name].src); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// included returns the file of template and of the partials it includes, directly or through others.
+// The other files may form partial cycles, AddSource rejects them even when the template does not use them.
+func included(template string, files map[string]*templateFile, options []render.Option) (map[string]*templateFile, error) {
+	r := render.New(append(options, render.WithMaxPartialDepth(render.DefaultMaxPartialDepth))...)
+	for _, f := range files {
+		src, err := f.source()
+		if err != nil {
+			return nil, err
+		}
+		if err = r.AddSource(src); err != nil {
+			return nil, err
+		}
+	}
+	g := r.Graph()
+	byName := map[string]*templateFile{template: files[template]}
+	queue := []string{template}
+	for len(queue) > 0 {
+		name := queue[0]
+		queue = queue[1:]
+		for _, p := range g.Partials[name] {
+			if _, seen := byName[p]; !seen && files[p] != nil {
+				byName[p] = files[p]
+				queue = append(queue, p)
+			}
+		}
+	}
+	return byName, nil
+}
+
+// fileLoader loads the files by name, for dynamic partials naming files that are not included
+func fileLoader(files map[string]*templateFile) render.PartialLoader {
+	return render.PartialLoaderFunc(func(name string) (source.Source, error) {
+		if f, ok := files[name]; ok {
+			return f.source()
+		}
+		return nil, fmt.Errorf("partial %q : %w", name, render.ErrSourceNameNotFound)
+	})
+}
+
+// locate replaces the source name of a render error with the path of its file
+func locate(err error, files map[string]*templateFile) error {
+	var renderError *render.RenderError
+	if errors.As(err, &renderError) {
+		if f, ok := files[renderError.Source]; ok {
+			renderError.Source = f.path
+		}
+	}
+	return err
+}
+
+// readPaths reads the template files and the files ending in ext below the directories of paths.
+// Files are named relative to the directory given or, for files given, to their directory.
+func readPaths(paths []string, ext string) (map[string]*templateFile, error) {
+	byName := map[string]*templateFile{}
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		var files []*templateFile
+		if info.IsDir() {
+			if files, err = readTemplates(path, ext); err != nil {
+				return nil, err
+			}
+		} else {
+			var name string
+			if name, err = templateName(filepath.Dir(path), path); err != nil {
+				return nil, err
+			}
+			var f *templateFile
+			if f, err = readTemplate(name, path); err != nil {
+				return nil, err
+			}
+			files = append(files, f)
+		}
+		for _, f := range files {
+			if other, ok := byName[f.name]; ok {
+				return nil, fmt.Errorf("%s and %s are both named %q", other.path, f.path, f.name)
+			}
+			byName[f.name] = f
+		}
+	}
+	return byName, nil
+}
+
+// sortedNames returns the names of files in order
+func sortedNames(files map[string]*templateFile) []string {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,234 @@
+// Package codegen compiles parsed templates to Go source. The generated function
+// writes the same output as render.Render without lexing the template at run time:
+//
+//	func RenderInvoice(w io.Writer, data *context.Context) error
+//
+// When a data type is given with WithDataType, names are resolved against the fields
+// of the type while generating, and the function reads the fields directly:
+//
+//	func RenderInvoice(w io.Writer, data *billing.Invoice) error
+package codegen
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"go/token"
+	"io"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/mlctrez/mystace/parse"
+)
+
+var (
+	ErrUnsupportedTag  = fmt.Errorf("unsupported tag")
+	ErrUnsupportedType = fmt.Errorf("unsupported type")
+	ErrInvalidName     = fmt.Errorf("invalid identifier")
+)
+
+const (
+	contextImport = "github.com/mlctrez/mystace/context"
+	renderImport  = "github.com/mlctrez/mystace/render"
+)
+
+type Option func(g *generator) error
+
+// WithPackage sets the package clause of the generated file, the default is main
+func WithPackage(name string) Option {
+	return func(g *generator) error {
+		if !token.IsIdentifier(name) {
+			return fmt.Errorf("package %q : %w", name, ErrInvalidName)
+		}
+		g.pkg = name
+		return nil
+	}
+}
+
+// WithFuncName sets the name of the generated function, the default is Render followed by the tree name
+func WithFuncName(name string) Option {
+	return func(g *generator) error {
+		if !token.IsIdentifier(name) {
+			return fmt.Errorf("func %q : %w", name, ErrInvalidName)
+		}
+		g.funcName = name
+		return nil
+	}
+}
+
+// WithDataType generates a function taking a pointer to the struct type of v, which may
+// be a struct value or pointer. Fields are named as in typecheck.FieldName.
+func WithDataType(v interface{}) Option {
+	return func(g *generator) error {
+		t := reflect.TypeOf(v)
+		if t != nil && t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		if t == nil || t.Kind() != reflect.Struct || t.Name() == "" {
+			return fmt.Errorf("data type %v : %w", t, ErrUnsupportedType)
+		}
+		g.dataType = t
+		return nil
+	}
+}
+
+// Generate writes a formatted Go file holding the render function of tree to w
+func Generate(w io.Writer, tree *parse.Tree, options ...Option) (err error) {
+	g := &generator{tree: tree, pkg: "main", funcName: funcName(tree.Name), imports: map[string]bool{}}
+	for _, option := range options {
+		if err = option(g); err != nil {
+			return
+		}
+	}
+
+	body := &bytes.Buffer{}
+	g.out = body
+	dataType := "*context.Context"
+	if g.dataType == nil {
+		g.imports[contextImport] = true
+		err = g.untyped(tree.Nodes, "data")
+	} else {
+		dataType = "*" + g.typeName(g.dataType)
+		g.printf("if data == nil {\ndata = &%s{}\n}\n", g.typeName(g.dataType))
+		g.frames = []frame{{expr: "data", typ: reflect.PtrTo(g.dataType)}}
+		err = g.typed(tree.Nodes)
+	}
+	if err != nil {
+		return
+	}
+	g.imports["io"] = true
+	g.imports[renderImport] = true
+
+	src := &bytes.Buffer{}
+	fmt.Fprintf(src, "// Code generated by mystace codegen. DO NOT EDIT.\n\npackage %s\n\nimport (\n", g.pkg)
+	var std, imports []string
+	for path := range g.imports {
+		if strings.Contains(strings.Split(path, "/")[0], ".") {
+			imports = append(imports, path)
+		} else {
+			std = append(std, path)
+		}
+	}
+	sort.Strings(std)
+	sort.Strings(imports)
+	for _, path := range append(append(std, ""), imports...) {
+		if path == "" {
+			src.WriteString("\n")
+		} else {
+			fmt.Fprintf(src, "%q\n", path)
+		}
+	}
+	fmt.Fprintf(src, ")\n\n// %s renders the template %q\n", g.funcName, tree.Name)
+	fmt.Fprintf(src, "func %s(w io.Writer, data %s) error {\n", g.funcName, dataType)
+	fmt.Fprintf(src, "rt := render.NewRuntime(w, %q)\n", tree.Name)
+	src.Write(body.Bytes())
+	src.WriteString("return rt.Err()\n}\n")
+
+	var formatted []byte
+	if formatted, err = format.Source(src.Bytes()); err != nil {
+		return
+	}
+	_, err = w.Write(formatted)
+	return
+}
+
+// funcName converts the name of a template such as "invoice/line-item" to RenderInvoiceLineItem
+func funcName(name string) string {
+	var sb strings.Builder
+	sb.WriteString("Render")
+	upper := true
+	for _, r := range name {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			upper = true
+			continue
+		}
+		if upper {
+			r = unicode.ToUpper(r)
+			upper = false
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
+
+type generator struct {
+	tree     *parse.Tree
+	pkg      string
+	funcName string
+	dataType reflect.Type
+	imports  map[string]bool
+	out      *bytes.Buffer
+	frames   []frame
+	vars     int
+}
+
+func (g *generator) printf(format string, args ...interface{}) {
+	fmt.Fprintf(g.out, format, args...)
+}
+
+func (g *generator) errorAt(n parse.Node, tag string, err error) error {
+	return &parse.Error{Name: g.tree.Name, Range: n.Range(), Tag: tag, Err: err}
+}
+
+// newVar returns an identifier unique within the generated function
+func (g *generator) newVar(prefix string) string {
+	g.vars++
+	return fmt.Sprintf("%s%d", prefix, g.vars)
+}
+
+// typeName qualifies t by its package unless it is declared in the generated package
+func (g *generator) typeName(t reflect.Type) string {
+	name := t.String()
+	if pkg, _, ok := strings.Cut(name, "."); ok && pkg == g.pkg {
+		return t.Name()
+	}
+	g.imports[t.PkgPath()] = true
+	return name
+}
+
+func tag(n parse.Node) string {
+	switch nt := n.(type) {
+	case *parse.VariableNode:
+		return nt.Token.Data.Str
+	case *parse.SectionNode:
+		return nt.Token.Data.Str
+	case *parse.PartialNode:
+		return nt.Token.Data.Str
+	case *parse.TranslateNode:
+		return nt.Token.Data.Str
+	}
+	return ""
+}
+
+func tagLiteral(n parse.Node) string {
+	start := n.Range().Start
+	return fmt.Sprintf("render.Tag{Str: %q, Line: %d, Column: %d}", tag(n), start.Line, start.Column)
+}
+
+// untyped generates code looking up names in the *context.Context named ctx
+func (g *generator) untyped(nodes []parse.Node, ctx string) error {
+	for _, n := range nodes {
+		switch nt := n.(type) {
+		case *parse.TextNode:
+			if nt.Text != "" {
+				g.printf("rt.Text(%s)\n", strconv.Quote(nt.Text))
+			}
+		case *parse.CommentNode:
+		case *parse.VariableNode:
+			g.printf("rt.Variable(%s, %s, %q, %t)\n", ctx, tagLiteral(nt), nt.Name, nt.Escape)
+		case *parse.SectionNode:
+			g.printf("rt.Section(%s, %s, %q, %t, %s, func(ctx *context.Context) {\n",
+				ctx, tagLiteral(nt), nt.Name, nt.Inverted, strconv.Quote(nt.Raw))
+			if err := g.untyped(nt.Nodes, "ctx"); err != nil {
+				return err
+			}
+			g.printf("})\n")
+		default:
+			return g.errorAt(n, tag(n), ErrUnsupportedTag)
+		}
+	}
+	return nil
+}
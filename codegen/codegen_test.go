@@ -0,0 +1,301 @@
+package codegen
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mlctrez/mystace/context"
+	"github.com/mlctrez/mystace/helpers"
+	"github.com/mlctrez/mystace/internal/fixtures"
+	"github.com/mlctrez/mystace/internal/spec"
+	"github.com/mlctrez/mystace/internal/testify"
+	"github.com/mlctrez/mystace/parse"
+	"github.com/mlctrez/mystace/render"
+	"github.com/mlctrez/mystace/source"
+)
+
+func parseString(t *testing.T, name, template string) *parse.Tree {
+	src, err := source.FromString(template, source.WithName(name))
+	testify.Require(t).Nil(err)
+	tree, err := parse.Parse(src)
+	testify.Require(t).Nil(err)
+	return tree
+}
+
+func Test_funcName(t *testing.T) {
+	require := testify.Require(t)
+	require.Equal("RenderInvoiceLineItem", funcName("invoice/line-item"))
+	require.Equal("Render", funcName(""))
+}
+
+func TestGenerate(t *testing.T) {
+	require := testify.Require(t)
+
+	tree := parseString(t, "greeting", "Hello {{name}}!\n")
+	buf := &bytes.Buffer{}
+	require.Nil(Generate(buf, tree, WithPackage("views")))
+	code := buf.String()
+	require.Contains(code, "// Code generated by mystace codegen. DO NOT EDIT.")
+	require.Contains(code, "package views")
+	require.Contains(code, "func RenderGreeting(w io.Writer, data *context.Context) error {")
+	require.Contains(code, `rt.Variable(data, render.Tag{Str: "{{name}}", Line: 1, Column: 7}, "name", true)`)
+
+	buf.Reset()
+	require.Nil(Generate(buf, tree, WithFuncName("Greet"), WithDataType(fixtures.Invoice{})))
+	code = buf.String()
+	require.Contains(code, "func Greet(w io.Writer, data *fixtures.Invoice) error {")
+	require.Contains(code, `"github.com/mlctrez/mystace/internal/fixtures"`)
+	require.NotContains(code, contextImport)
+	// {{name}} is not a field of Invoice, so nothing is written
+	require.NotContains(code, "rt.String")
+
+	buf.Reset()
+	require.Nil(Generate(buf, parseString(t, "memo", "{{memo}}{{author}}"), WithPackage("fixtures"), WithDataType(&fixtures.Invoice{})))
+	code = buf.String()
+	require.Contains(code, "func RenderMemo(w io.Writer, data *Invoice) error {")
+	require.Contains(code, "rt.String(data.Memo, true)")
+	require.Contains(code, "rt.String(data.Author, true)")
+
+	require.ErrorIs(Generate(buf, tree, WithPackage("1x")), ErrInvalidName)
+	require.ErrorIs(Generate(buf, tree, WithFuncName("a-b")), ErrInvalidName)
+	require.ErrorIs(Generate(buf, tree, WithDataType("")), ErrUnsupportedType)
+	require.ErrorIs(Generate(buf, tree, WithDataType(nil)), ErrUnsupportedType)
+
+	err := Generate(buf, parseString(t, "partial", "a\n{{> other}}"))
+	require.ErrorIs(err, ErrUnsupportedTag)
+	var parseError *parse.Error
+	require.True(errors.As(err, &parseError))
+	require.Equal(2, parseError.Range.Start.Line)
+
+	for _, template := range []string{"{{paid}}", "{{customer}}", "{{#issued}}{{/issued}}", "{{_ key}}"} {
+		err = Generate(buf, parseString(t, "typed", template), WithDataType(fixtures.Invoice{}))
+		require.NotNil(err, template)
+	}
+}
+
+// generatedCase is rendered by generated code and compared with the expected output of
+// spec cases, or with the output of render.Render
+type generatedCase struct {
+	template string
+	data     string
+	helpers  bool
+	// typed cases use fixtures.Invoice, data names a func returning *fixtures.Invoice
+	typed bool
+	spec  bool
+	// expected is the output of spec cases
+	expected string
+}
+
+var generatedCases = []generatedCase{
+	{template: "Hello {{name}}!", data: `{"name": "<b>Ana</b>"}`},
+	{template: "{{&name}} {{{name}}} \"quoted\" \\ {{missing}}", data: `{"name": "<b>Ana</b>"}`},
+	{template: "{{#items}}\n- {{name}}: {{price}}\n{{/items}}\n{{^items}}\nnone\n{{/items}}\n", data: `{"items": [{"name": "a", "price": 1.5}, {"name": "b", "price": 2}]}`},
+	{template: "{{#items}}\n- {{name}}\n{{/items}}\n{{^items}}\nnone\n{{/items}}\n", data: `{"items": []}`},
+	{template: "{{a.b.c}} {{#a}}{{b.c}}{{/a}} {{#a.b}}{{c}}{{/a.b}} {{a.x.c}}", data: `{"a": {"b": {"c": "deep"}}}`},
+	{template: "first\n{{! a comment }}\nsecond\n  {{! indented }}\nthird", data: `{}`},
+	{template: "{{#count}}[{{.}}]{{/count}}{{^count}}none{{/count}}|{{#flag}}on{{/flag}}{{^flag}}off{{/flag}}", data: `{"count": 3, "flag": false}`},
+	{template: "{{#users}}{{name}} of {{company}};{{/users}}", data: `{"company": "acme", "users": [{"name": "x"}, {"name": "y", "company": "other"}]}`},
+	{template: "{{#upper}}hi {{name}}{{/upper}} {{#join}}tags{{/join}}", data: `{"name": "ana", "tags": ["a", "b"]}`, helpers: true},
+	{template: "before {{#missing}}x{{/missing}} after", data: `{}`},
+	{template: "{{.}}", data: `"scalar"`},
+	{template: sampleInvoice, data: "fixtures.SampleInvoice()", typed: true},
+	{template: sampleInvoice, data: "&fixtures.Invoice{}", typed: true},
+	{template: "{{#lines}}{{#tax}}{{rate}}{{/tax}}{{^tax}}none{{/tax}};{{/lines}}{{#lines}}.{{/lines}}", data: "fixtures.SampleInvoice()", typed: true},
+	{template: "{{#customer.missing}}x{{/customer.missing}}", data: "fixtures.SampleInvoice()", typed: true},
+	{template: "{{#missing}}x{{/missing}}", data: "nil", typed: true},
+}
+
+const sampleInvoice = `Invoice {{number}} issued {{issued}} by {{author}}
+{{#customer}}{{name}} <{{email}}>{{#address}} {{city}}{{/address}}{{^address}} no address{{/address}}{{/customer}}
+{{#lines}}
+* {{item}} x{{quantity}} @ {{price}}{{#tax}} tax {{rate}}{{/tax}} on {{number}}
+{{/lines}}
+{{^lines}}
+no lines
+{{/lines}}
+{{#paid}}paid{{/paid}}{{^paid}}due {{total}}{{/paid}} {{discount}}{{#discount}}-{{.}}{{/discount}}{{^discount}}no discount{{/discount}}
+{{customer.name}}{{customer.address.city}} {{#notes}}notes are scalars{{/notes}}{{^notes}}no notes{{/notes}} {{memo}}
+`
+
+// specCases reads the mustache spec tests passed by render.Render, skipping t when the spec files are missing
+func specCases(t *testing.T) (cases []generatedCase) {
+	for _, file := range []string{"comments", "interpolation", "sections"} {
+		path := fmt.Sprintf("../mustache/specs/%s.json", file)
+		f, err := spec.Read(path)
+		if errors.Is(err, os.ErrNotExist) {
+			t.Skipf("spec file %s not found, run git submodule update --init", path)
+		}
+		testify.Require(t).Nil(err, path)
+		for _, test := range f.Tests {
+			data, _ := json.Marshal(test.Data)
+			// line endings are normalized to \n when reading templates
+			expected := strings.ReplaceAll(test.Expected, "\r", "")
+			cases = append(cases, generatedCase{template: test.Template, data: string(data), spec: true, expected: expected})
+		}
+	}
+	return
+}
+
+// renderCase renders a case with render.Render. Typed data is converted to maps keyed by
+// typecheck.FieldName: a json round trip adding Memo, which json skips but templates name memo.
+func renderCase(t *testing.T, name string, c generatedCase) string {
+	require := testify.Require(t)
+	data := c.data
+	if c.typed {
+		invoice := map[string]*fixtures.Invoice{
+			"fixtures.SampleInvoice()": fixtures.SampleInvoice(), "&fixtures.Invoice{}": {}, "nil": {}}[c.data]
+		encoded, err := json.Marshal(invoice)
+		require.Nil(err)
+		var values map[string]interface{}
+		require.Nil(json.Unmarshal(encoded, &values))
+		values["memo"] = invoice.Memo
+		encoded, err = json.Marshal(values)
+		require.Nil(err)
+		data = string(encoded)
+	}
+	ctx, err := context.FromJSON(strings.NewReader(data))
+	require.Nil(err)
+	if c.helpers {
+		ctx = context.Layer(helpers.Context(), ctx)
+	}
+	src, err := source.FromString(c.template, source.WithName(name))
+	require.Nil(err)
+	r := render.New()
+	buf := &bytes.Buffer{}
+	r.Writer(buf)
+	require.Nil(r.AddSource(src))
+	if err = r.Render(name, ctx); err != nil {
+		return "error: " + err.Error()
+	}
+	return buf.String()
+}
+
+func TestGenerate_MatchesRender(t *testing.T) {
+	matches(t, generatedCases)
+}
+
+func TestGenerate_Specs(t *testing.T) {
+	matches(t, specCases(t))
+}
+
+// scratchModule returns a temporary module requiring this one, for running generated code
+func scratchModule(t *testing.T) string {
+	require := testify.Require(t)
+	root, err := filepath.Abs("..")
+	require.Nil(err)
+	mod, err := os.ReadFile(filepath.Join(root, "go.mod"))
+	require.Nil(err)
+	sum, err := os.ReadFile(filepath.Join(root, "go.sum"))
+	require.Nil(err)
+
+	// the requirements of this module keep the build from looking up its dependencies, the
+	// module path is below this one to import internal/fixtures
+	requirements := strings.Replace(string(mod), "module github.com/mlctrez/mystace", "module github.com/mlctrez/mystace/codegen/generated", 1)
+	requirements += fmt.Sprintf("\nrequire github.com/mlctrez/mystace v0.0.0\n\nreplace github.com/mlctrez/mystace => %s\n", root)
+
+	dir := t.TempDir()
+	require.Nil(os.WriteFile(filepath.Join(dir, "go.mod"), []byte(requirements), 0644))
+	require.Nil(os.WriteFile(filepath.Join(dir, "go.sum"), sum, 0644))
+	return dir
+}
+
+// matches compiles the generated code of cases with the go tool and compares its output with
+// the expected output of spec cases or with render.Render
+func matches(t *testing.T, cases []generatedCase) {
+	require := testify.Require(t)
+	if testing.Short() {
+		t.Skip("runs the go tool")
+	}
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go tool not found")
+	}
+
+	dir := scratchModule(t)
+
+	main := &bytes.Buffer{}
+	main.WriteString(`package main
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"strings"
+	"bytes"
+
+	"github.com/mlctrez/mystace/context"
+	"github.com/mlctrez/mystace/helpers"
+	"github.com/mlctrez/mystace/internal/fixtures"
+)
+
+var _ = fixtures.SampleInvoice
+var _ = helpers.Map
+var _ = strings.NewReader
+
+func main() {
+	results := map[string]string{}
+	run := func(name string, f func(w io.Writer) error) {
+		buf := &bytes.Buffer{}
+		if err := f(buf); err != nil {
+			results[name] = "error: " + err.Error()
+			return
+		}
+		results[name] = buf.String()
+	}
+`)
+
+	for i, c := range cases {
+		name := fmt.Sprintf("case%d", i)
+		options := []Option{WithFuncName(fmt.Sprintf("Render%d", i))}
+		if c.typed {
+			options = append(options, WithDataType(fixtures.Invoice{}))
+		}
+		code := &bytes.Buffer{}
+		require.Nil(Generate(code, parseString(t, name, c.template), options...), c.template)
+		require.Nil(os.WriteFile(filepath.Join(dir, name+".go"), code.Bytes(), 0644))
+
+		switch {
+		case c.typed:
+			fmt.Fprintf(main, "run(%q, func(w io.Writer) error { return Render%d(w, %s) })\n", name, i, c.data)
+		case c.helpers:
+			fmt.Fprintf(main, "run(%q, func(w io.Writer) error { ctx, _ := context.FromJSON(strings.NewReader(%q)); return Render%d(w, context.Layer(helpers.Context(), ctx)) })\n", name, c.data, i)
+		default:
+			fmt.Fprintf(main, "run(%q, func(w io.Writer) error { ctx, _ := context.FromJSON(strings.NewReader(%q)); return Render%d(w, ctx) })\n", name, c.data, i)
+		}
+	}
+	main.WriteString("_ = json.NewEncoder(os.Stdout).Encode(results)\n}\n")
+	require.Nil(os.WriteFile(filepath.Join(dir, "main.go"), main.Bytes(), 0644))
+
+	cmd := exec.Command("go", "run", ".")
+	cmd.Dir = dir
+	out, err := cmd.Output()
+	var exitError *exec.ExitError
+	if errors.As(err, &exitError) {
+		t.Log(string(exitError.Stderr))
+	}
+	require.Nil(err)
+
+	var results map[string]string
+	require.Nil(json.Unmarshal(out, &results))
+	require.Len(results, len(cases))
+
+	for i, c := range cases {
+		name := fmt.Sprintf("case%d", i)
+		if c.spec {
+			require.Equal(c.expected, results[name], "template %q data %s", c.template, c.data)
+			continue
+		}
+		expected := renderCase(t, name, c)
+		if c.typed && strings.HasPrefix(expected, "error: ") {
+			require.True(strings.HasPrefix(results[name], "error: "), "template %q : %s", c.template, results[name])
+			continue
+		}
+		require.Equal(expected, results[name], "template %q data %s", c.template, c.data)
+	}
+}
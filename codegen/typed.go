@@ -0,0 +1,242 @@
+package codegen
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mlctrez/mystace/parse"
+	"github.com/mlctrez/mystace/typecheck"
+)
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// frame is a value in scope while generating typed code, the equivalent of a context frame
+type frame struct {
+	expr string
+	typ  reflect.Type
+	used bool
+}
+
+// typed generates code reading the fields of the frames, resolving names while generating.
+// The output matches rendering the data converted to maps keyed by typecheck.FieldName, which
+// is a json round trip except for fields named by a mystace tag that json skips.
+func (g *generator) typed(nodes []parse.Node) (err error) {
+	for _, n := range nodes {
+		switch nt := n.(type) {
+		case *parse.TextNode:
+			if nt.Text != "" {
+				g.printf("rt.Text(%s)\n", strconv.Quote(nt.Text))
+			}
+		case *parse.CommentNode:
+		case *parse.VariableNode:
+			err = g.resolve(nt.Name, func(expr string, t reflect.Type) error {
+				return g.writeValue(nt, expr, t, nt.Escape)
+			}, nil)
+		case *parse.SectionNode:
+			err = g.resolve(nt.Name, func(expr string, t reflect.Type) error {
+				return g.section(nt, expr, t)
+			}, func() {
+				g.printf("rt.Missing(%s)\n", tagLiteral(nt))
+			})
+		default:
+			err = g.errorAt(n, tag(n), ErrUnsupportedTag)
+		}
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// resolve finds the first segment of name in the frames and the rest within that value,
+// calling found with the expression of the value or missing when it does not exist
+func (g *generator) resolve(name string, found func(expr string, t reflect.Type) error, missing func()) error {
+	if name == "." {
+		top := &g.frames[len(g.frames)-1]
+		top.used = true
+		return found(top.expr, top.typ)
+	}
+	names := strings.Split(name, ".")
+	for i := len(g.frames) - 1; i >= 0; i-- {
+		f := &g.frames[i]
+		if field, ok := typecheck.Field(f.typ, names[0]); ok {
+			f.used = true
+			return g.path(f.expr+"."+field.Name, field.Type, names[1:], found, missing)
+		}
+	}
+	if missing != nil {
+		missing()
+	}
+	return nil
+}
+
+// path resolves names within the value expr of type t, checking pointers for nil
+func (g *generator) path(expr string, t reflect.Type, names []string, found func(expr string, t reflect.Type) error, missing func()) (err error) {
+	if len(names) == 0 {
+		return found(expr, t)
+	}
+	if t.Kind() == reflect.Ptr && t.Elem().Kind() == reflect.Struct {
+		v := g.newVar("p")
+		g.printf("if %s := %s; %s != nil {\n", v, expr, v)
+		if err = g.path(v, t.Elem(), names, found, missing); err != nil {
+			return
+		}
+		if missing != nil {
+			g.printf("} else {\n")
+			missing()
+		}
+		g.printf("}\n")
+		return
+	}
+	if field, ok := typecheck.Field(t, names[0]); ok {
+		return g.path(expr+"."+field.Name, field.Type, names[1:], found, missing)
+	}
+	if missing != nil {
+		missing()
+	}
+	return
+}
+
+func (g *generator) unsupported(n parse.Node, t reflect.Type) error {
+	return g.errorAt(n, tag(n), fmt.Errorf("%s : %w", t, ErrUnsupportedType))
+}
+
+// convert converts expr to the basic type named by to unless it already is that type
+func convert(expr string, t reflect.Type, to string) string {
+	if t.PkgPath() == "" && t.Name() == to {
+		return expr
+	}
+	return fmt.Sprintf("%s(%s)", to, expr)
+}
+
+func (g *generator) writeValue(n *parse.VariableNode, expr string, t reflect.Type, escape bool) error {
+	switch t.Kind() {
+	case reflect.Ptr:
+		v := g.newVar("p")
+		g.printf("if %s := %s; %s != nil {\n", v, expr, v)
+		if err := g.writeValue(n, "*"+v, t.Elem(), escape); err != nil {
+			return err
+		}
+		g.printf("}\n")
+	case reflect.String:
+		g.printf("rt.String(%s, %t)\n", convert(expr, t, "string"), escape)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		g.printf("rt.Int(%s)\n", convert(expr, t, "int64"))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		g.printf("rt.Uint(%s)\n", convert(expr, t, "uint64"))
+	case reflect.Float32, reflect.Float64:
+		g.printf("rt.Float(%s)\n", convert(expr, t, "float64"))
+	default:
+		if t != timeType {
+			return g.unsupported(n, t)
+		}
+		g.printf("rt.Time(%s)\n", expr)
+	}
+	return nil
+}
+
+// with generates nodes with f pushed onto the frames, returning the generated code and the frame
+func (g *generator) with(f frame, nodes []parse.Node) (code []byte, pushed frame, err error) {
+	out := g.out
+	g.out = &bytes.Buffer{}
+	g.frames = append(g.frames, f)
+	err = g.typed(nodes)
+	pushed = g.frames[len(g.frames)-1]
+	g.frames = g.frames[:len(g.frames)-1]
+	code, g.out = g.out.Bytes(), out
+	return
+}
+
+// body generates the section nodes with the current frames
+func (g *generator) body(n *parse.SectionNode) error {
+	return g.typed(n.Nodes)
+}
+
+// push generates the section nodes with the value expr as a new frame
+func (g *generator) push(n *parse.SectionNode, expr string, t reflect.Type) error {
+	code, _, err := g.with(frame{expr: expr, typ: t}, n.Nodes)
+	g.out.Write(code)
+	return err
+}
+
+func (g *generator) section(n *parse.SectionNode, expr string, t reflect.Type) (err error) {
+	switch t.Kind() {
+	case reflect.Ptr:
+		v := g.newVar("p")
+		g.printf("if %s := %s; %s != nil {\n", v, expr, v)
+		if !n.Inverted {
+			if t.Elem().Kind() == reflect.Struct {
+				err = g.push(n, v, t)
+			} else {
+				err = g.section(n, "*"+v, t.Elem())
+			}
+		}
+		if err == nil && n.Inverted {
+			g.printf("} else {\n")
+			err = g.body(n)
+		}
+		g.printf("}\n")
+	case reflect.Bool:
+		if n.Inverted {
+			expr = "!" + expr
+		}
+		g.printf("if %s {\n", expr)
+		err = g.body(n)
+		g.printf("}\n")
+	case reflect.String, reflect.Float32, reflect.Float64,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if !n.Inverted {
+			err = g.push(n, expr, t)
+		}
+	case reflect.Struct:
+		if t == timeType {
+			return g.unsupported(n, t)
+		}
+		if !n.Inverted {
+			err = g.push(n, expr, t)
+		}
+	case reflect.Slice, reflect.Array:
+		if n.Inverted {
+			g.printf("if len(%s) == 0 {\n", expr)
+			err = g.body(n)
+			g.printf("}\n")
+			return
+		}
+		err = g.items(n, expr, t.Elem())
+	default:
+		return g.unsupported(n, t)
+	}
+	return
+}
+
+// items generates a section over a list. As with Render, only items that become frames,
+// structs and non nil pointers to structs, render the section.
+func (g *generator) items(n *parse.SectionNode, expr string, elem reflect.Type) (err error) {
+	item := g.newVar("item")
+	switch {
+	case elem.Kind() == reflect.Struct && elem != timeType:
+		var code []byte
+		var pushed frame
+		if code, pushed, err = g.with(frame{expr: item, typ: elem}, n.Nodes); err != nil {
+			return
+		}
+		if pushed.used {
+			g.printf("for _, %s := range %s {\n", item, expr)
+		} else {
+			g.printf("for range %s {\n", expr)
+		}
+		g.out.Write(code)
+		g.printf("}\n")
+	case elem.Kind() == reflect.Ptr && elem.Elem().Kind() == reflect.Struct:
+		g.printf("for _, %s := range %s {\n", item, expr)
+		g.printf("if %s != nil {\n", item)
+		err = g.push(n, item, elem)
+		g.printf("}\n}\n")
+	}
+	return
+}
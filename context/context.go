@@ -1,97 +1,336 @@
 package context
 
 import (
+	stdcontext "context"
 	"fmt"
+	"html"
+	"strconv"
 	"strings"
+
+	"github.com/mlctrez/mystace/locale"
 )
 
+// Context is an immutable frame of values with an optional parent frame. Lookups have no
+// side effects, so a Context may be shared by concurrent renders. New frames are added with
+// New, Push or With, which never modify the receiver.
 type Context struct {
 	values   map[string]interface{}
+	resolver Resolver
 	parent   *Context
-	resolved map[string]bool
+	// escape, locale and options are set on the copies of frames renderers pass to lambdas,
+	// which keep the identity of the frame they copy in memo keys
+	escape  func(s string) string
+	locale  *locale.Locale
+	options []LookupOption
+	copyOf  *Context
 }
 
-func New(values map[string]interface{}, parent ...*Context) (ctx *Context) {
+// New creates a frame above the first parent. The values of the frame may be a
+// map[string]interface{}, a Resolver, or nil for an empty frame. Any other value
+// becomes the ImplicitIterator of the frame. The frame takes ownership of a map,
+// which must not be modified after New returns.
+func New(values interface{}, parent ...*Context) (ctx *Context) {
 
-	ctx = &Context{values: values}
-	if ctx.values == nil {
+	ctx = &Context{}
+	switch vt := values.(type) {
+	case nil:
 		ctx.values = map[string]interface{}{}
+	case map[string]interface{}:
+		ctx.values = vt
+		if ctx.values == nil {
+			ctx.values = map[string]interface{}{}
+		}
+	case Resolver:
+		ctx.resolver = vt
+	default:
+		ctx.values = map[string]interface{}{ImplicitIterator: vt}
 	}
 	for _, p := range parent {
 		ctx.parent = p
 		break
 	}
-	//fmt.Println(ctx)
 	return
 }
 
+// Push returns a new frame of values with c as the parent, values are interpreted as in New
+func (c *Context) Push(values interface{}) *Context {
+	return New(values, c)
+}
+
+// With returns a new frame holding a single value with c as the parent
+func (c *Context) With(key string, value interface{}) *Context {
+	return New(map[string]interface{}{key: value}, c)
+}
+
 func (c *Context) String() string {
 	if c == nil {
 		return "Context: <nil>"
 	}
+	if c.resolver != nil {
+		return fmt.Sprintf("Context: %v\n %s", c.resolver, c.parent)
+	}
 	return fmt.Sprintf("Context: %s\n %s", c.values, c.parent)
 }
 
-func (c *Context) markResolved(key string) {
-	if c.resolved == nil {
-		c.clearResolved()
+// get returns the value of name in this frame only
+func (c *Context) get(name string) (interface{}, bool) {
+	if c.resolver != nil {
+		return c.resolver.Resolve(name)
 	}
-	c.resolved[key] = true
+	v, ok := c.values[name]
+	return v, ok
 }
 
-func (c *Context) wasResolved(key string) bool {
-	if c.resolved == nil {
-		return false
+// ParentPrefix addresses the frame above the current frame in LookupPath: {{../name}}
+const ParentPrefix = "../"
+
+// Depth returns the number of frames from c to the root, inclusive
+func (c *Context) Depth() (depth int) {
+	for f := c; f != nil; f = f.parent {
+		depth++
 	}
+	return
+}
 
-	first, _, ok := maybeSplitParts(key)
-	if !ok {
-		return false
+// Frame returns the frame i levels above c, Frame(0) is c. Frame returns nil when i is out of range.
+func (c *Context) Frame(i int) *Context {
+	if i < 0 {
+		return nil
+	}
+	f := c
+	for ; f != nil && i > 0; i-- {
+		f = f.parent
 	}
+	return f
+}
 
-	return c.resolved[first]
+// Parent returns the frame above c, or nil when c is the root
+func (c *Context) Parent() *Context {
+	return c.parent
 }
 
-func (c *Context) clearResolved() {
-	c.resolved = map[string]bool{}
+// Root returns the outermost frame
+func (c *Context) Root() *Context {
+	f := c
+	for f != nil && f.parent != nil {
+		f = f.parent
+	}
+	return f
 }
 
-func (c *Context) Lookup(key string) (i interface{}, ok bool) {
+// WithEscaper returns a copy of the frame c, holding the same values, whose Escape calls escape.
+// Renderers pass such a frame to lambdas so values they write are escaped as {{name}} tags are.
+func (c *Context) WithEscaper(escape func(s string) string) *Context {
+	f := c.copy()
+	f.escape = escape
+	return f
+}
 
-	if i, ok = c.lookup(key, c.values); ok {
-		return
-	}
+// copy returns a shallow copy of the frame c
+func (c *Context) copy() *Context {
+	f := *c
+	f.copyOf = c.identity()
+	return &f
+}
 
-	if c.wasResolved(key) || c.parent == nil {
-		return nil, false
+// identity returns the frame c is a copy of, or c
+func (c *Context) identity() *Context {
+	if c.copyOf != nil {
+		return c.copyOf
 	}
+	return c
+}
 
-	return c.parent.Lookup(key)
+// Escape escapes s as the renderer invoking a Lambda escapes the values of {{name}} tags,
+// or escapes html when c is not from a renderer
+func (c *Context) Escape(s string) string {
+	for f := c; f != nil; f = f.parent {
+		if f.escape != nil {
+			return f.escape(s)
+		}
+	}
+	return EscapeHTML(s)
 }
 
-func (c *Context) lookup(keyOuter string, vars map[string]interface{}) (i interface{}, ok bool) {
+// WithLocale returns a copy of the frame c, holding the same values, whose Locale is l.
+// Renderers pass such a frame to lambdas so they format values as {{name}} tags do.
+func (c *Context) WithLocale(l locale.Locale) *Context {
+	f := c.copy()
+	f.locale = &l
+	return f
+}
 
-	key := strings.TrimSpace(keyOuter)
+// Locale returns the locale of the renderer invoking a Lambda, ok is false when it has none
+func (c *Context) Locale() (l locale.Locale, ok bool) {
+	for f := c; f != nil; f = f.parent {
+		if f.locale != nil {
+			return *f.locale, true
+		}
+	}
+	return
+}
 
-	first, remainder, ok := maybeSplitParts(key)
+// WithLookupOptions returns a copy of the frame c, holding the same values, whose Value
+// resolves names with options. Renderers pass such a frame to lambdas so they look up
+// names as {{name}} tags do, evaluating Lazy values once per render.
+func (c *Context) WithLookupOptions(options ...LookupOption) *Context {
+	f := c.copy()
+	f.options = append([]LookupOption{}, options...)
+	return f
+}
 
-	if ok {
-		if nestedMap, nestedOk := vars[first].(map[string]interface{}); nestedOk {
-			c.markResolved(first)
-			return c.lookup(remainder, nestedMap)
+// Value resolves key as the renderer invoking a Lambda resolves {{key}}, with its lookup
+// options, or as Resolve when c is not from a renderer
+func (c *Context) Value(key string) (i interface{}, ok bool, err error) {
+	for f := c; f != nil; f = f.parent {
+		if f.options != nil {
+			return c.Resolve(key, f.options...)
 		}
 	}
+	return c.Resolve(key)
+}
 
-	i, ok = vars[key]
-	return
+// EscapeHTML escapes the characters of s that have meaning in html
+func EscapeHTML(s string) string {
+	return strings.ReplaceAll(html.EscapeString(s), "&#34;", "&quot;")
+}
+
+// ImplicitIterator is the name of the current frame value: {{.}}
+const ImplicitIterator = "."
+
+// LookupOption enables an extension to the spec name resolution of LookupWith
+type LookupOption func(l *lookup)
+
+type lookup struct {
+	parentPaths    bool
+	numericIndexes bool
+	memo           *Memo
+	done           stdcontext.Context
 }
 
-func maybeSplitParts(key string) (first string, remainder string, ok bool) {
-	if strings.Index(key, ".") > 0 {
-		splitParts := strings.SplitN(key, ".", 2)
-		first = splitParts[0]
-		remainder = splitParts[1]
-		ok = true
+// ParentPaths enables leading ParentPrefix segments. Each ../ skips one frame before
+// the lookup starts, so an outer value shadowed by an inner frame can be addressed
+// explicitly. The lookup still walks outwards from the addressed frame.
+func ParentPaths() LookupOption {
+	return func(l *lookup) {
+		l.parentPaths = true
+	}
+}
+
+// NumericIndexes enables addressing list items by index in dotted names: {{items.0.name}}
+func NumericIndexes() LookupOption {
+	return func(l *lookup) {
+		l.numericIndexes = true
+	}
+}
+
+// Lookup resolves key following the mustache spec
+func (c *Context) Lookup(key string) (i interface{}, ok bool) {
+	return c.LookupWith(key)
+}
+
+// LookupPath is Lookup with ParentPaths enabled
+func (c *Context) LookupPath(key string) (i interface{}, ok bool) {
+	return c.LookupWith(key, ParentPaths())
+}
+
+// LookupWith resolves key following the mustache spec with optional extensions.
+//
+// The name . is the value of the current frame. A dotted name a.b.c resolves a by
+// walking the frames outwards, then resolves b and c within that value only, never
+// falling back to outer frames once a is found. LookupWith has no side effects.
+// A Lazy value that fails to evaluate is not found, use Resolve to receive the error.
+func (c *Context) LookupWith(key string, options ...LookupOption) (i interface{}, ok bool) {
+	if i, ok, _ = c.Resolve(key, options...); !ok {
+		i = nil
 	}
 	return
 }
+
+// Resolve is LookupWith that reports the error of a Lazy value which failed to evaluate
+func (c *Context) Resolve(key string, options ...LookupOption) (i interface{}, ok bool, err error) {
+	l := &lookup{}
+	for _, option := range options {
+		option(l)
+	}
+
+	key = strings.TrimSpace(key)
+	frame := c
+	if l.parentPaths {
+		for strings.HasPrefix(key, ParentPrefix) {
+			key = strings.TrimPrefix(key, ParentPrefix)
+			frame = frame.parent
+			if frame == nil {
+				return nil, false, nil
+			}
+		}
+	}
+
+	if key == ImplicitIterator {
+		if i, ok = frame.get(ImplicitIterator); ok {
+			i, err = l.evaluate(l.key(memoKey{base: frame.identity()}, frame.container(), ImplicitIterator), i)
+			return i, err == nil, err
+		}
+		return frame.container(), true, nil
+	}
+
+	names := strings.Split(key, ".")
+	for f := frame; f != nil; f = f.parent {
+		if i, ok = f.get(names[0]); ok {
+			k := l.key(memoKey{base: f.identity()}, f.container(), names[0])
+			if i, err = l.evaluate(k, i); err != nil {
+				return nil, false, err
+			}
+			return l.resolve(k, i, names[1:])
+		}
+	}
+	return nil, false, nil
+}
+
+// container returns the map or Resolver holding the values of this frame
+func (c *Context) container() interface{} {
+	if c.resolver != nil {
+		return c.resolver
+	}
+	return c.values
+}
+
+// resolve finds the remaining names of a dotted name within v, found at key
+func (l *lookup) resolve(key memoKey, v interface{}, names []string) (interface{}, bool, error) {
+	for _, name := range names {
+		container := v
+		switch vt := v.(type) {
+		case map[string]interface{}:
+			var ok bool
+			if v, ok = vt[name]; !ok {
+				return nil, false, nil
+			}
+		case Resolver:
+			var ok bool
+			if v, ok = vt.Resolve(name); !ok {
+				return nil, false, nil
+			}
+		case []interface{}:
+			index, err := strconv.Atoi(name)
+			if !l.numericIndexes || err != nil || index < 0 || index >= len(vt) {
+				return nil, false, nil
+			}
+			v = vt[index]
+		default:
+			return nil, false, nil
+		}
+		var err error
+		key = l.key(key, container, name)
+		if v, err = l.evaluate(key, v); err != nil {
+			return nil, false, err
+		}
+	}
+	return v, true, nil
+}
+
+// RenderFunc renders template text against the frame a Lambda was invoked in.
+type RenderFunc func(text string) (string, error)
+
+// Lambda is a callable context value. When used as a section, text is the raw,
+// unrendered section body. When interpolated, text is empty.
+type Lambda func(text string, ctx *Context, render RenderFunc) (string, error)
@@ -1,9 +1,12 @@
 package context
 
 import (
+	"strings"
+	"sync"
 	"testing"
 
 	"github.com/mlctrez/mystace/internal/testify"
+	"github.com/mlctrez/mystace/locale"
 )
 
 func TestNew(t *testing.T) {
@@ -102,34 +105,48 @@ func TestContext_Lookup_NoShadow(t *testing.T) {
 
 }
 
-func Test_lookup(t *testing.T) {
+func Test_resolve(t *testing.T) {
 	require := testify.Require(t)
 	require.True(true)
 
-	c := New(nil)
-
-	expectString := "string at root"
-	lookup, ok := c.lookup(".", map[string]interface{}{".": expectString})
-	require.True(ok)
-	require.Equal(expectString, lookup)
+	l := &lookup{}
 
-	expectString = "value for key"
-	lookup, ok = c.lookup("key", map[string]interface{}{"key": expectString})
+	expectString := "value for key"
+	resolved, ok, _ := l.resolve(memoKey{}, expectString, nil)
 	require.True(ok)
-	require.Equal(expectString, lookup)
+	require.Equal(expectString, resolved)
 
 	expectString = "value for levelTwo"
-	lookup, ok = c.lookup("levelOne.levelTwo", map[string]interface{}{"levelOne": map[string]interface{}{
+	levels := map[string]interface{}{"levelOne": map[string]interface{}{
 		"levelTwo": expectString,
-	}})
+	}}
+	resolved, ok, _ = l.resolve(memoKey{}, levels, []string{"levelOne", "levelTwo"})
 	require.True(ok)
-	require.Equal(expectString, lookup)
+	require.Equal(expectString, resolved)
 
-	lookup, ok = c.lookup("levelOne.doesnotexist", map[string]interface{}{"levelOne": map[string]interface{}{
-		"levelTwo": expectString,
-	}})
+	resolved, ok, _ = l.resolve(memoKey{}, levels, []string{"levelOne", "doesnotexist"})
 	require.False(ok)
-	require.Nil(lookup)
+	require.Nil(resolved)
+
+	resolved, ok, _ = l.resolve(memoKey{}, levels, []string{"levelOne", "levelTwo", "beyond"})
+	require.False(ok)
+	require.Nil(resolved)
+
+	list := []interface{}{"zero", "one"}
+	resolved, ok, _ = l.resolve(memoKey{}, list, []string{"1"})
+	require.False(ok)
+	require.Nil(resolved)
+
+	l = &lookup{numericIndexes: true}
+	resolved, ok, _ = l.resolve(memoKey{}, list, []string{"1"})
+	require.True(ok)
+	require.Equal("one", resolved)
+
+	for _, index := range []string{"2", "-1", "x"} {
+		resolved, ok, _ = l.resolve(memoKey{}, list, []string{index})
+		require.False(ok, index)
+		require.Nil(resolved, index)
+	}
 
 }
 
@@ -141,7 +158,7 @@ func TestContext_String(t *testing.T) {
 	require.Equal("Context: map[]\n Context: <nil>", New(nil).String())
 }
 
-func TestContext_wasResolved(t *testing.T) {
+func TestContext_Lookup_Stateless(t *testing.T) {
 	require := testify.Require(t)
 	require.True(true)
 
@@ -150,20 +167,246 @@ func TestContext_wasResolved(t *testing.T) {
 		"d": "e",
 	},
 		New(map[string]interface{}{
-			"a": map[string]interface{}{"b": "ERRROR"},
+			"a": map[string]interface{}{"b": "ERRROR", "x": "ERROR"},
 			"d": "ERROR",
+			"y": "parent",
 		}),
 	)
 
-	lookup, ok := ctx.Lookup("d")
+	// repeated lookups in any order resolve the same way
+	for i := 0; i < 2; i++ {
+		lookup, ok := ctx.Lookup("a.b")
+		require.True(ok)
+		require.Equal("c", lookup)
+
+		lookup, ok = ctx.Lookup("a.x")
+		require.False(ok)
+		require.Nil(lookup)
+
+		lookup, ok = ctx.Lookup("d")
+		require.True(ok)
+		require.Equal("e", lookup)
+
+		lookup, ok = ctx.Lookup("y")
+		require.True(ok)
+		require.Equal("parent", lookup)
+	}
+
+}
+
+func TestContext_Lookup_ImplicitIterator(t *testing.T) {
+	require := testify.Require(t)
+
+	values := map[string]interface{}{"a": "b"}
+	lookup, ok := New(values).Lookup(".")
+	require.True(ok)
+	require.Equal(values, lookup)
+
+	lookup, ok = New(map[string]interface{}{".": "scalar"}, New(values)).Lookup(" . ")
+	require.True(ok)
+	require.Equal("scalar", lookup)
+
+	lookup, ok = New(nil, New(map[string]interface{}{".": "scalar"})).LookupPath("../.")
+	require.True(ok)
+	require.Equal("scalar", lookup)
+}
+
+func TestContext_LookupWith_NumericIndexes(t *testing.T) {
+	require := testify.Require(t)
+
+	ctx := New(map[string]interface{}{
+		"items": []interface{}{map[string]interface{}{"name": "first"}},
+	})
+
+	lookup, ok := ctx.Lookup("items.0.name")
+	require.False(ok)
+	require.Nil(lookup)
+
+	lookup, ok = ctx.LookupWith("items.0.name", NumericIndexes())
+	require.True(ok)
+	require.Equal("first", lookup)
+
+	lookup, ok = ctx.LookupWith("items.1.name", NumericIndexes())
+	require.False(ok)
+	require.Nil(lookup)
+
+	lookup, ok = ctx.LookupWith("items.name", NumericIndexes())
+	require.False(ok)
+	require.Nil(lookup)
+}
+
+func TestContext_Frames(t *testing.T) {
+	require := testify.Require(t)
+
+	root := New(map[string]interface{}{"name": "root"})
+	middle := New(map[string]interface{}{"name": "middle"}, root)
+	inner := New(nil, middle)
+
+	require.Equal(3, inner.Depth())
+	require.Equal(1, root.Depth())
+	require.Equal(0, (*Context)(nil).Depth())
+
+	require.Equal(inner, inner.Frame(0))
+	require.Equal(middle, inner.Frame(1))
+	require.Equal(root, inner.Frame(2))
+	require.Nil(inner.Frame(3))
+	require.Nil(inner.Frame(-1))
+
+	require.Equal(middle, inner.Parent())
+	require.Nil(root.Parent())
+
+	require.Equal(root, inner.Root())
+	require.Equal(root, root.Root())
+}
+
+func TestContext_LookupPath(t *testing.T) {
+	require := testify.Require(t)
+
+	root := New(map[string]interface{}{"name": "root", "only": "in root"})
+	middle := New(map[string]interface{}{"name": "middle"}, root)
+	inner := New(map[string]interface{}{"name": "inner"}, middle)
+
+	lookup, ok := inner.LookupPath("name")
+	require.True(ok)
+	require.Equal("inner", lookup)
+
+	lookup, ok = inner.LookupPath(" ../name ")
+	require.True(ok)
+	require.Equal("middle", lookup)
+
+	lookup, ok = inner.LookupPath("../../name")
+	require.True(ok)
+	require.Equal("root", lookup)
+
+	// lookups continue outwards from the addressed frame
+	lookup, ok = inner.LookupPath("../only")
+	require.True(ok)
+	require.Equal("in root", lookup)
+
+	lookup, ok = inner.LookupPath("../../../name")
+	require.False(ok)
+	require.Nil(lookup)
+}
+
+func TestContext_PushWith(t *testing.T) {
+	require := testify.Require(t)
+
+	root := New(map[string]interface{}{"a": "root"})
+
+	pushed := root.Push(map[string]interface{}{"a": "pushed"})
+	require.Equal(root, pushed.Parent())
+	lookup, _ := pushed.Lookup("a")
+	require.Equal("pushed", lookup)
+
+	with := pushed.With("b", "with")
+	require.Equal(pushed, with.Parent())
+	lookup, _ = with.Lookup("b")
+	require.Equal("with", lookup)
+
+	// the receivers are unchanged
+	lookup, _ = root.Lookup("a")
+	require.Equal("root", lookup)
+	_, ok := pushed.Lookup("b")
+	require.False(ok)
+	require.Equal(1, root.Depth())
+}
+
+func TestContext_Escape(t *testing.T) {
+	require := testify.Require(t)
+
+	root := New(map[string]interface{}{"a": "root"})
+	require.Equal("&lt;a href=&quot;x&quot;&gt; &amp;", root.Escape(`<a href="x"> &`))
+
+	escaping := root.WithEscaper(strings.ToUpper)
+	require.Equal("<B>", escaping.Escape("<b>"))
+	require.Equal("<B>", escaping.Push(nil).Escape("<b>"))
+	lookup, _ := escaping.Lookup("a")
+	require.Equal("root", lookup)
+	require.Equal(root.Depth(), escaping.Depth())
+
+	// the receiver is unchanged
+	require.Equal("&lt;b&gt;", root.Escape("<b>"))
+}
+
+func TestContext_Locale(t *testing.T) {
+	require := testify.Require(t)
+
+	root := New(nil)
+	_, ok := root.Locale()
+	require.False(ok)
+
+	de, err := locale.Lookup("de-DE")
+	require.Nil(err)
+	l, ok := root.WithLocale(de).Push(nil).Locale()
 	require.True(ok)
-	require.Equal("e", lookup)
-	require.False(ctx.wasResolved("d"))
+	require.Equal(de, l)
 
-	lookup, ok = ctx.Lookup("a.b")
+	_, ok = root.Locale()
+	require.False(ok)
+}
+
+func TestContext_Value(t *testing.T) {
+	require := testify.Require(t)
+
+	calls := 0
+	resolver := ResolverFunc(func(name string) (interface{}, bool) {
+		return Lazy(func() (interface{}, error) {
+			calls++
+			return name, nil
+		}), name == "lazy"
+	})
+	root := New(map[string]interface{}{"a": "root", "list": []interface{}{"x"}})
+	frame := New(resolver, root)
+
+	v, ok, err := frame.Value("../a")
+	require.Nil(err)
+	require.False(ok)
+	require.Nil(v)
+
+	memo := NewMemo()
+	lookups := frame.WithLookupOptions(ParentPaths(), NumericIndexes(), Memoize(memo)).Push(nil)
+	v, ok, _ = lookups.Value("../../a")
 	require.True(ok)
-	require.Equal("c", lookup)
-	require.True(ctx.wasResolved("a.b"))
-	require.False(ctx.wasResolved("a"))
+	require.Equal("root", v)
+	v, _, _ = lookups.Value("list.0")
+	require.Equal("x", v)
+	_, ok, _ = frame.Value("list.0")
+	require.False(ok)
 
+	// the copy is the same frame in memo keys
+	v, _, _ = lookups.Value("lazy")
+	require.Equal("lazy", v)
+	_, _, _ = frame.Resolve("lazy", Memoize(memo))
+	_, _, _ = frame.WithEscaper(strings.ToUpper).Resolve("lazy", Memoize(memo))
+	require.Equal(1, calls)
+}
+
+// TestContext_Concurrent is meaningful when run with -race
+func TestContext_Concurrent(t *testing.T) {
+	assert := testify.Assert(t)
+
+	root := New(map[string]interface{}{
+		"a": map[string]interface{}{"b": "c"},
+		"d": "e",
+	})
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			frame := root.With("g", g)
+			for i := 0; i < 100; i++ {
+				v, ok := frame.Lookup("a.b")
+				assert.True(ok)
+				assert.Equal("c", v)
+				v, ok = frame.Push(map[string]interface{}{"d": i}).Lookup("d")
+				assert.True(ok)
+				assert.Equal(i, v)
+				v, _ = frame.Lookup("g")
+				assert.Equal(g, v)
+			}
+		}(g)
+	}
+	wg.Wait()
 }
@@ -0,0 +1,160 @@
+package context
+
+import (
+	stdcontext "context"
+	"reflect"
+	"sync"
+)
+
+// Lazy is a value computed when it is first looked up. Plain func() (interface{}, error)
+// values are treated the same way. Without a Memo a Lazy value is evaluated on every lookup.
+// A Lazy value runs to completion, use LazyContext for values that should stop with a render.
+type Lazy func() (interface{}, error)
+
+// LazyContext is a Lazy value receiving the stdlib context of the lookup, set by Until, which
+// is done when the render looking it up is stopped. Plain func(context.Context) (interface{}, error)
+// values are treated the same way.
+type LazyContext func(ctx stdcontext.Context) (interface{}, error)
+
+func asLazy(v interface{}) (l LazyContext, ok bool) {
+	switch vt := v.(type) {
+	case Lazy:
+		return func(stdcontext.Context) (interface{}, error) { return vt() }, true
+	case func() (interface{}, error):
+		return func(stdcontext.Context) (interface{}, error) { return vt() }, true
+	case LazyContext:
+		return vt, true
+	case func(stdcontext.Context) (interface{}, error):
+		return vt, true
+	}
+	return
+}
+
+// Until passes done to LazyContext values, which are given context.Background without it.
+// Renderers pass the context of the render.
+func Until(done stdcontext.Context) LookupOption {
+	return func(l *lookup) {
+		l.done = done
+	}
+}
+
+// Memoize evaluates each Lazy value at most once for the lifetime of m, the renderer uses one Memo per render
+func Memoize(m *Memo) LookupOption {
+	return func(l *lookup) {
+		l.memo = m
+	}
+}
+
+// Memo caches the results of Lazy values by the path they were found at. Paths start at the
+// first frame, map, list or Resolver a lookup reached them from, so the values of a Resolver
+// returning new maps on every call are evaluated once. A slow Lazy value only delays the
+// lookups of the same value.
+type Memo struct {
+	mu      sync.Mutex
+	results map[memoKey]*memoResult
+	// origins are the keys of the containers seen by lookups, holding the containers keeps
+	// their addresses from being reused by other values while m is in use
+	origins map[uintptr]origin
+}
+
+// memoKey is a dotted path below a frame or a container
+type memoKey struct {
+	base interface{}
+	path string
+}
+
+func (k memoKey) child(name string) memoKey {
+	if k.path == "" {
+		return memoKey{base: k.base, path: name}
+	}
+	return memoKey{base: k.base, path: k.path + "." + name}
+}
+
+type origin struct {
+	key       memoKey
+	container interface{}
+}
+
+type memoResult struct {
+	once  sync.Once
+	value interface{}
+	err   error
+}
+
+func NewMemo() *Memo {
+	return &Memo{results: map[memoKey]*memoResult{}, origins: map[uintptr]origin{}}
+}
+
+// key returns the key of the value name in container, which was found at parent
+func (l *lookup) key(parent memoKey, container interface{}, name string) memoKey {
+	if l.memo == nil {
+		return memoKey{}
+	}
+	return l.memo.base(parent, container).child(name)
+}
+
+// evaluate returns v, or the result of evaluating v when it is Lazy, found at key
+func (l *lookup) evaluate(key memoKey, v interface{}) (interface{}, error) {
+	done := l.done
+	if done == nil {
+		done = stdcontext.Background()
+	}
+	if l.memo == nil {
+		if fn, ok := asLazy(v); ok {
+			return fn(done)
+		}
+		return v, nil
+	}
+	if fn, ok := asLazy(v); ok {
+		var err error
+		if v, err = l.memo.evaluate(key, func() (interface{}, error) { return fn(done) }); err != nil {
+			return nil, err
+		}
+	}
+	l.memo.base(key, v)
+	return v, nil
+}
+
+func (m *Memo) evaluate(key memoKey, fn Lazy) (interface{}, error) {
+	m.mu.Lock()
+	result, ok := m.results[key]
+	if !ok {
+		result = &memoResult{}
+		m.results[key] = result
+	}
+	m.mu.Unlock()
+	result.once.Do(func() {
+		result.value, result.err = fn()
+	})
+	return result.value, result.err
+}
+
+// base returns the key the paths within container start at: the key container was first
+// found at, or parent when container has no stable identity and is found again on every lookup
+func (m *Memo) base(parent memoKey, container interface{}) memoKey {
+	id, ok := identify(container)
+	if !ok {
+		return parent
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	o, seen := m.origins[id]
+	if !seen {
+		o = origin{key: parent, container: container}
+		m.origins[id] = o
+	}
+	return o.key
+}
+
+// identify returns the address of maps, lists and pointers, other values have no stable identity
+func identify(container interface{}) (id uintptr, ok bool) {
+	rv := reflect.ValueOf(container)
+	switch rv.Kind() {
+	case reflect.Map, reflect.Ptr, reflect.Slice:
+		if rv.IsNil() {
+			return
+		}
+		return rv.Pointer(), true
+	}
+	return
+}
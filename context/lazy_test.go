@@ -0,0 +1,236 @@
+package context
+
+import (
+	stdcontext "context"
+	"fmt"
+	"testing"
+
+	"github.com/mlctrez/mystace/internal/testify"
+)
+
+var errLazy = fmt.Errorf("lazy error")
+
+func TestContext_Resolve_Lazy(t *testing.T) {
+	require := testify.Require(t)
+
+	calls := 0
+	ctx := New(map[string]interface{}{
+		"lazy": Lazy(func() (interface{}, error) {
+			calls++
+			return "computed", nil
+		}),
+		"plain": func() (interface{}, error) {
+			return map[string]interface{}{"nested": func() (interface{}, error) { return "deep", nil }}, nil
+		},
+		"failing": func() (interface{}, error) { return nil, errLazy },
+		"list":    []interface{}{Lazy(func() (interface{}, error) { return "item", nil })},
+	})
+
+	v, ok, err := ctx.Resolve("lazy")
+	require.Nil(err)
+	require.True(ok)
+	require.Equal("computed", v)
+
+	// without a memo lazy values are evaluated on every lookup
+	v, ok = ctx.Lookup("lazy")
+	require.True(ok)
+	require.Equal("computed", v)
+	require.Equal(2, calls)
+
+	v, ok = ctx.Lookup("plain.nested")
+	require.True(ok)
+	require.Equal("deep", v)
+
+	v, ok = ctx.LookupWith("list.0", NumericIndexes())
+	require.True(ok)
+	require.Equal("item", v)
+
+	v, ok, err = ctx.Resolve("failing")
+	require.ErrorIs(err, errLazy)
+	require.False(ok)
+	require.Nil(v)
+
+	_, _, err = ctx.Resolve("failing.nested")
+	require.ErrorIs(err, errLazy)
+
+	_, _, err = New(map[string]interface{}{"a": map[string]interface{}{"b": Lazy(func() (interface{}, error) {
+		return nil, errLazy
+	})}}).Resolve("a.b")
+	require.ErrorIs(err, errLazy)
+
+	v, ok = ctx.Lookup("failing")
+	require.False(ok)
+	require.Nil(v)
+
+	v, ok = New(map[string]interface{}{".": Lazy(func() (interface{}, error) { return "dot", nil })}).Lookup(".")
+	require.True(ok)
+	require.Equal("dot", v)
+}
+
+func TestLazyContext(t *testing.T) {
+	require := testify.Require(t)
+
+	type key struct{}
+	ctx := New(map[string]interface{}{
+		"lazy": LazyContext(func(ctx stdcontext.Context) (interface{}, error) {
+			return ctx.Value(key{}), ctx.Err()
+		}),
+		"plain": func(ctx stdcontext.Context) (interface{}, error) { return "plain", nil },
+	})
+
+	v, ok, err := ctx.Resolve("lazy")
+	require.Nil(err)
+	require.True(ok)
+	require.Nil(v)
+
+	done, cancel := stdcontext.WithCancel(stdcontext.WithValue(stdcontext.Background(), key{}, "render"))
+	v, _, err = ctx.Resolve("lazy", Until(done), Memoize(NewMemo()))
+	require.Nil(err)
+	require.Equal("render", v)
+	cancel()
+	_, _, err = ctx.Resolve("lazy", Until(done))
+	require.ErrorIs(err, stdcontext.Canceled)
+
+	v, _ = ctx.Lookup("plain")
+	require.Equal("plain", v)
+}
+
+func TestMemoize(t *testing.T) {
+	require := testify.Require(t)
+
+	calls := 0
+	values := map[string]interface{}{
+		"lazy": Lazy(func() (interface{}, error) {
+			calls++
+			return calls, nil
+		}),
+		"failing": Lazy(func() (interface{}, error) {
+			calls++
+			return nil, errLazy
+		}),
+	}
+	root := New(values)
+	memo := NewMemo()
+
+	for i := 0; i < 3; i++ {
+		v, ok, err := root.Push(nil).Resolve("lazy", Memoize(memo))
+		require.Nil(err)
+		require.True(ok)
+		require.Equal(1, v)
+	}
+	require.Equal(1, calls)
+
+	for i := 0; i < 2; i++ {
+		_, _, err := root.Resolve("failing", Memoize(memo))
+		require.ErrorIs(err, errLazy)
+	}
+	require.Equal(2, calls)
+
+	// a new memo evaluates again
+	v, _, _ := root.Resolve("lazy", Memoize(NewMemo()))
+	require.Equal(3, v)
+
+	// frames without a stable identity are told apart by the frame
+	scalar := ResolverFunc(func(name string) (interface{}, bool) {
+		return values["lazy"], true
+	})
+	v, _, _ = New(scalar).Resolve("lazy", Memoize(memo))
+	require.Equal(4, v)
+	v, _, _ = New(scalar).Resolve("lazy", Memoize(memo))
+	require.Equal(5, v)
+}
+
+func TestMemoize_Resolvers(t *testing.T) {
+	require := testify.Require(t)
+
+	calls := 0
+	lazy := Lazy(func() (interface{}, error) {
+		calls++
+		return calls, nil
+	})
+	// each call returns new values, as a resolver backed by a database or the merged frames would
+	resolver := ResolverFunc(func(name string) (interface{}, bool) {
+		switch name {
+		case "lazy":
+			return func() (interface{}, error) { return lazy() }, true
+		case "nested":
+			return map[string]interface{}{"lazy": func() (interface{}, error) { return lazy() }}, true
+		}
+		return nil, false
+	})
+	root := New(resolver)
+	merged := Merge(New(map[string]interface{}{"nested": map[string]interface{}{"a": 1}}), root)
+	memo := NewMemo()
+
+	for i := 0; i < 3; i++ {
+		v, _, err := root.Push(nil).Resolve("lazy", Memoize(memo))
+		require.Nil(err)
+		require.Equal(1, v)
+
+		v, _, _ = root.Resolve("nested.lazy", Memoize(memo))
+		require.Equal(2, v)
+
+		// a section over nested pushes the value found at nested
+		nested, _, _ := root.Resolve("nested", Memoize(memo))
+		v, _, _ = root.Push(nested).Resolve("lazy", Memoize(memo))
+		require.Equal(2, v)
+
+		v, _, _ = merged.Resolve("nested.lazy", Memoize(memo))
+		require.Equal(3, v)
+	}
+	require.Equal(3, calls)
+}
+
+func TestMemoize_Concurrent(t *testing.T) {
+	require := testify.Require(t)
+
+	release := make(chan struct{})
+	started := make(chan struct{})
+	slowCalls := 0
+	ctx := New(map[string]interface{}{
+		"slow": Lazy(func() (interface{}, error) {
+			slowCalls++
+			close(started)
+			<-release
+			return "slow", nil
+		}),
+		"fast": Lazy(func() (interface{}, error) { return "fast", nil }),
+	})
+	memo := NewMemo()
+
+	results := make(chan interface{}, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			v, _, _ := ctx.Resolve("slow", Memoize(memo))
+			results <- v
+		}()
+	}
+	<-started
+
+	// the evaluation of slow does not block other values
+	v, _, err := ctx.Resolve("fast", Memoize(memo))
+	require.Nil(err)
+	require.Equal("fast", v)
+
+	close(release)
+	require.Equal("slow", <-results)
+	require.Equal("slow", <-results)
+	require.Equal(1, slowCalls)
+}
+
+func Test_identify(t *testing.T) {
+	require := testify.Require(t)
+
+	values := map[string]interface{}{}
+	id, ok := identify(values)
+	require.True(ok)
+	other, _ := identify(values)
+	require.Equal(id, other)
+
+	_, ok = identify(map[string]interface{}(nil))
+	require.False(ok)
+	_, ok = identify("scalar")
+	require.False(ok)
+	_, ok = identify([]interface{}{1})
+	require.True(ok)
+}
@@ -0,0 +1,125 @@
+package context
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// EnvSeparator separates nested names in environment variables read by FromEnv
+const EnvSeparator = "__"
+
+// FromJSON decodes a json document into a frame. Numbers are kept as json.Number
+// so integers are not converted to float64.
+func FromJSON(r io.Reader) (ctx *Context, err error) {
+	decoder := json.NewDecoder(r)
+	decoder.UseNumber()
+	var values interface{}
+	if err = decoder.Decode(&values); err != nil {
+		return nil, fmt.Errorf("json : %w", err)
+	}
+	return New(values), nil
+}
+
+// FromYAML decodes a yaml document into a frame. Mappings with keys other than
+// strings are converted to map[string]interface{} using the formatted key.
+func FromYAML(r io.Reader) (ctx *Context, err error) {
+	var values interface{}
+	if err = yaml.NewDecoder(r).Decode(&values); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("yaml : %w", err)
+	}
+	return New(normalize(values)), nil
+}
+
+// FromTOML decodes a toml document into a frame. Arrays of tables become lists of maps.
+func FromTOML(r io.Reader) (ctx *Context, err error) {
+	values := map[string]interface{}{}
+	if _, err = toml.NewDecoder(r).Decode(&values); err != nil {
+		return nil, fmt.Errorf("toml : %w", err)
+	}
+	return New(normalize(values)), nil
+}
+
+// FromEnv creates a frame from the environment variables starting with prefix and an
+// underscore. The remainder of each variable is lower cased and split on EnvSeparator
+// into nested maps, so with prefix APP the variable APP_DB__HOST is the name db.host.
+func FromEnv(prefix string) *Context {
+	return fromEnviron(prefix, os.Environ())
+}
+
+func fromEnviron(prefix string, environ []string) *Context {
+	values := map[string]interface{}{}
+	prefix += "_"
+	for _, entry := range environ {
+		name, value, ok := strings.Cut(entry, "=")
+		if !ok || !strings.HasPrefix(name, prefix) || name == prefix {
+			continue
+		}
+		names := strings.Split(strings.ToLower(strings.TrimPrefix(name, prefix)), EnvSeparator)
+		current := values
+		for _, n := range names[:len(names)-1] {
+			next, isMap := current[n].(map[string]interface{})
+			if !isMap {
+				next = map[string]interface{}{}
+				current[n] = next
+			}
+			current = next
+		}
+		if _, isMap := current[names[len(names)-1]].(map[string]interface{}); !isMap {
+			current[names[len(names)-1]] = value
+		}
+	}
+	return New(values)
+}
+
+// normalize converts decoded maps and lists into the map[string]interface{} and
+// []interface{} types used for lookups and sections
+func normalize(v interface{}) interface{} {
+	switch vt := v.(type) {
+	case map[string]interface{}:
+		for key, value := range vt {
+			vt[key] = normalize(value)
+		}
+		return vt
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(vt))
+		for key, value := range vt {
+			m[fmt.Sprint(key)] = normalize(value)
+		}
+		return m
+	case []interface{}:
+		for i, value := range vt {
+			vt[i] = normalize(value)
+		}
+		return vt
+	case []map[string]interface{}:
+		list := make([]interface{}, len(vt))
+		for i, value := range vt {
+			list[i] = normalize(value)
+		}
+		return list
+	}
+	return v
+}
+
+// Layer stacks the frames of layers so later layers take precedence over earlier ones,
+// names missing from a layer fall back to the layers before it. Only the top frame of
+// each layer is used and, as with any parent lookup, a nested map in a later layer
+// shadows the whole map of the same name in an earlier layer, use Merge to combine them.
+func Layer(layers ...*Context) (ctx *Context) {
+	for _, layer := range layers {
+		if layer == nil {
+			continue
+		}
+		ctx = &Context{values: layer.values, resolver: layer.resolver, parent: ctx}
+	}
+	if ctx == nil {
+		ctx = New(nil)
+	}
+	return
+}
@@ -0,0 +1,173 @@
+package context
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mlctrez/mystace/internal/mocks"
+	"github.com/mlctrez/mystace/internal/testify"
+)
+
+func TestFromJSON(t *testing.T) {
+	require := testify.Require(t)
+
+	ctx, err := FromJSON(strings.NewReader(`{"id": 9007199254740993, "price": 1.5, "user": {"name": "Ana"}, "tags": ["a"]}`))
+	require.Nil(err)
+
+	v, ok := ctx.Lookup("id")
+	require.True(ok)
+	require.Equal(json.Number("9007199254740993"), v)
+
+	v, _ = ctx.Lookup("price")
+	require.Equal(json.Number("1.5"), v)
+
+	v, _ = ctx.Lookup("user.name")
+	require.Equal("Ana", v)
+
+	v, _ = ctx.Lookup("tags")
+	require.Equal([]interface{}{"a"}, v)
+
+	ctx, err = FromJSON(strings.NewReader(`"scalar"`))
+	require.Nil(err)
+	v, _ = ctx.Lookup(".")
+	require.Equal("scalar", v)
+
+	_, err = FromJSON(strings.NewReader(`{`))
+	require.NotNil(err)
+
+	_, err = FromJSON(&mocks.BadReader{ReadErr: mocks.ErrBadReaderMockError})
+	require.ErrorIs(err, mocks.ErrBadReaderMockError)
+}
+
+func TestFromYAML(t *testing.T) {
+	require := testify.Require(t)
+
+	ctx, err := FromYAML(strings.NewReader(`
+id: 42
+price: 1.5
+when: 2022-01-02T03:04:05Z
+user:
+  name: Ana
+numbers:
+  1: one
+items:
+  - name: a
+  - name: b
+`))
+	require.Nil(err)
+
+	v, _ := ctx.Lookup("id")
+	require.Equal(42, v)
+	v, _ = ctx.Lookup("price")
+	require.Equal(1.5, v)
+	v, _ = ctx.Lookup("when")
+	require.Equal(time.Date(2022, 1, 2, 3, 4, 5, 0, time.UTC), v)
+	v, _ = ctx.Lookup("user.name")
+	require.Equal("Ana", v)
+	v, _ = ctx.Lookup("numbers.1")
+	require.Equal("one", v)
+	v, _ = ctx.Lookup("items")
+	require.Equal([]interface{}{map[string]interface{}{"name": "a"}, map[string]interface{}{"name": "b"}}, v)
+
+	ctx, err = FromYAML(strings.NewReader(""))
+	require.Nil(err)
+	require.Equal(1, ctx.Depth())
+
+	_, err = FromYAML(strings.NewReader("a: [b"))
+	require.NotNil(err)
+}
+
+func TestFromTOML(t *testing.T) {
+	require := testify.Require(t)
+
+	ctx, err := FromTOML(strings.NewReader(`
+id = 42
+price = 1.5
+
+[user]
+name = "Ana"
+
+[[items]]
+name = "a"
+
+[[items]]
+name = "b"
+`))
+	require.Nil(err)
+
+	v, _ := ctx.Lookup("id")
+	require.Equal(int64(42), v)
+	v, _ = ctx.Lookup("price")
+	require.Equal(1.5, v)
+	v, _ = ctx.Lookup("user.name")
+	require.Equal("Ana", v)
+	v, _ = ctx.Lookup("items")
+	require.Equal([]interface{}{map[string]interface{}{"name": "a"}, map[string]interface{}{"name": "b"}}, v)
+
+	_, err = FromTOML(strings.NewReader("a = "))
+	require.NotNil(err)
+}
+
+func TestFromEnv(t *testing.T) {
+	require := testify.Require(t)
+
+	t.Setenv("MYSTACE_TEST_NAME", "Ana")
+	ctx := FromEnv("MYSTACE_TEST")
+	v, ok := ctx.Lookup("name")
+	require.True(ok)
+	require.Equal("Ana", v)
+
+	ctx = fromEnviron("APP", []string{
+		"APP_DB__HOST=localhost",
+		"APP_DB__PORT=5432",
+		"APP_LOG_LEVEL=debug",
+		"APP_DB=shadowed by the nested names",
+		"APP_=ignored",
+		"OTHER_NAME=ignored",
+		"malformed",
+	})
+
+	v, _ = ctx.Lookup("db.host")
+	require.Equal("localhost", v)
+	v, _ = ctx.Lookup("db.port")
+	require.Equal("5432", v)
+	v, _ = ctx.Lookup("log_level")
+	require.Equal("debug", v)
+	require.Equal(map[string]interface{}{
+		"db":        map[string]interface{}{"host": "localhost", "port": "5432"},
+		"log_level": "debug",
+	}, ctx.values)
+
+	ctx = fromEnviron("APP", []string{"APP_DB=value", "APP_DB__HOST=localhost"})
+	v, _ = ctx.Lookup("db.host")
+	require.Equal("localhost", v)
+}
+
+func TestLayer(t *testing.T) {
+	require := testify.Require(t)
+
+	base := New(map[string]interface{}{"name": "base", "only": "base", "db": map[string]interface{}{"host": "h", "port": 1}})
+	override := New(map[string]interface{}{"name": "override", "db": map[string]interface{}{"port": 2}}, New(map[string]interface{}{"dropped": true}))
+
+	ctx := Layer(base, nil, override)
+	require.Equal(2, ctx.Depth())
+
+	v, _ := ctx.Lookup("name")
+	require.Equal("override", v)
+	v, _ = ctx.Lookup("only")
+	require.Equal("base", v)
+	v, _ = ctx.Lookup("db.port")
+	require.Equal(2, v)
+
+	// nested maps shadow the earlier layer as a whole
+	_, ok := ctx.Lookup("db.host")
+	require.False(ok)
+
+	// parents of a layer are not used
+	_, ok = ctx.Lookup("dropped")
+	require.False(ok)
+
+	require.Equal(1, Layer().Depth())
+}
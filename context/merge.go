@@ -0,0 +1,103 @@
+package context
+
+// ListStrategy controls how Merge combines lists found at the same name in two layers
+type ListStrategy int
+
+const (
+	// ListReplace uses the list of the later layer
+	ListReplace ListStrategy = iota
+	// ListAppend appends the items of the later layer to the list of the earlier one
+	ListAppend
+)
+
+// Merge deep merges the top frames of layers into a single frame with ListReplace.
+// See MergeLists.
+func Merge(layers ...*Context) *Context {
+	return MergeLists(ListReplace, layers...)
+}
+
+// MergeLists deep merges the top frames of layers into a single frame. Later layers take
+// precedence, but unlike Layer, a nested map is merged with the map of the same name in
+// earlier layers instead of shadowing it, and lists are combined using strategy. The
+// layers are not modified. When any layer is backed by a Resolver, names are merged when
+// they are looked up rather than up front.
+func MergeLists(strategy ListStrategy, layers ...*Context) *Context {
+	m := &merged{strategy: strategy}
+	for _, layer := range layers {
+		if layer == nil {
+			continue
+		}
+		if layer.resolver != nil {
+			m.resolvers = true
+		}
+		m.layers = append(m.layers, layer)
+	}
+	if m.resolvers {
+		return New(m)
+	}
+	var values interface{} = map[string]interface{}{}
+	for _, layer := range m.layers {
+		values = mergeValues(values, layer.values, strategy)
+	}
+	return New(values)
+}
+
+// MergeMaps deep merges maps into a new map as MergeLists does for frames
+func MergeMaps(strategy ListStrategy, maps ...map[string]interface{}) map[string]interface{} {
+	var values interface{} = map[string]interface{}{}
+	for _, m := range maps {
+		values = mergeValues(values, m, strategy)
+	}
+	return values.(map[string]interface{})
+}
+
+// merged resolves names by merging the values of every layer at lookup time
+type merged struct {
+	strategy  ListStrategy
+	layers    []*Context
+	resolvers bool
+}
+
+func (m *merged) Resolve(name string) (v interface{}, found bool) {
+	for _, layer := range m.layers {
+		if lv, ok := layer.get(name); ok {
+			if found {
+				v = mergeValues(v, lv, m.strategy)
+			} else {
+				v, found = lv, true
+			}
+		}
+	}
+	return
+}
+
+// mergeValues merges src over dst without modifying either
+func mergeValues(dst, src interface{}, strategy ListStrategy) interface{} {
+	switch st := src.(type) {
+	case map[string]interface{}:
+		dt, ok := dst.(map[string]interface{})
+		if !ok {
+			return src
+		}
+		out := make(map[string]interface{}, len(dt)+len(st))
+		for key, value := range dt {
+			out[key] = value
+		}
+		for key, value := range st {
+			if existing, exists := out[key]; exists {
+				out[key] = mergeValues(existing, value, strategy)
+			} else {
+				out[key] = value
+			}
+		}
+		return out
+	case []interface{}:
+		dt, ok := dst.([]interface{})
+		if !ok || strategy != ListAppend {
+			return src
+		}
+		out := make([]interface{}, 0, len(dt)+len(st))
+		return append(append(out, dt...), st...)
+	}
+	return src
+}
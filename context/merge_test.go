@@ -0,0 +1,96 @@
+package context
+
+import (
+	"testing"
+
+	"github.com/mlctrez/mystace/internal/testify"
+)
+
+func mergeLayers() (defaults, tenant, request *Context) {
+	defaults = New(map[string]interface{}{
+		"title": "default",
+		"theme": map[string]interface{}{"color": "blue", "font": "serif"},
+		"tags":  []interface{}{"a"},
+	})
+	tenant = New(map[string]interface{}{
+		"theme": map[string]interface{}{"color": "red"},
+		"tags":  []interface{}{"b"},
+	})
+	request = New(map[string]interface{}{
+		"title": "request",
+		"theme": map[string]interface{}{"logo": "x.png"},
+	})
+	return
+}
+
+func TestMerge(t *testing.T) {
+	require := testify.Require(t)
+
+	defaults, tenant, request := mergeLayers()
+	ctx := Merge(defaults, nil, tenant, request)
+	require.Equal(1, ctx.Depth())
+	require.Equal(map[string]interface{}{
+		"title": "request",
+		"theme": map[string]interface{}{"color": "red", "font": "serif", "logo": "x.png"},
+		"tags":  []interface{}{"b"},
+	}, ctx.values)
+
+	v, _ := ctx.Lookup("theme.font")
+	require.Equal("serif", v)
+
+	// layers are not modified
+	require.Equal(map[string]interface{}{"color": "blue", "font": "serif"}, defaults.values["theme"])
+	require.Equal(map[string]interface{}{"color": "red"}, tenant.values["theme"])
+
+	ctx = MergeLists(ListAppend, defaults, tenant, request)
+	v, _ = ctx.Lookup("tags")
+	require.Equal([]interface{}{"a", "b"}, v)
+	require.Equal([]interface{}{"a"}, defaults.values["tags"])
+
+	// a value that is not a map replaces a map and the other way around
+	ctx = Merge(defaults, New(map[string]interface{}{"theme": "dark", "title": map[string]interface{}{"text": "t"}}))
+	v, _ = ctx.Lookup("theme")
+	require.Equal("dark", v)
+	v, _ = ctx.Lookup("title.text")
+	require.Equal("t", v)
+
+	require.Equal(map[string]interface{}{}, Merge().values)
+}
+
+func TestMerge_Resolver(t *testing.T) {
+	require := testify.Require(t)
+
+	defaults, tenant, _ := mergeLayers()
+	request := New(ResolverFunc(func(name string) (interface{}, bool) {
+		if name == "theme" {
+			return map[string]interface{}{"logo": "x.png"}, true
+		}
+		return nil, false
+	}))
+
+	ctx := MergeLists(ListAppend, defaults, request, tenant)
+	require.NotNil(ctx.resolver)
+
+	v, _ := ctx.Lookup("theme")
+	require.Equal(map[string]interface{}{"color": "red", "font": "serif", "logo": "x.png"}, v)
+	v, _ = ctx.Lookup("tags")
+	require.Equal([]interface{}{"a", "b"}, v)
+	v, _ = ctx.Lookup("title")
+	require.Equal("default", v)
+	_, ok := ctx.Lookup("missing")
+	require.False(ok)
+}
+
+func TestMergeMaps(t *testing.T) {
+	require := testify.Require(t)
+
+	a := map[string]interface{}{"list": []interface{}{1}, "nested": map[string]interface{}{"a": 1}}
+	b := map[string]interface{}{"list": []interface{}{2}, "nested": map[string]interface{}{"b": 2}}
+
+	require.Equal(map[string]interface{}{
+		"list":   []interface{}{2},
+		"nested": map[string]interface{}{"a": 1, "b": 2},
+	}, MergeMaps(ListReplace, a, nil, b))
+	require.Equal([]interface{}{1, 2}, MergeMaps(ListAppend, a, b)["list"])
+	require.Equal(map[string]interface{}{}, MergeMaps(ListAppend))
+}
@@ -0,0 +1,15 @@
+package context
+
+// Resolver backs a frame with a custom data source. Resolve is called lazily, only
+// for the names a template looks up, and must be safe for concurrent use when the
+// frame is shared by concurrent renders.
+type Resolver interface {
+	Resolve(name string) (interface{}, bool)
+}
+
+// ResolverFunc adapts a function to a Resolver
+type ResolverFunc func(name string) (interface{}, bool)
+
+func (f ResolverFunc) Resolve(name string) (interface{}, bool) {
+	return f(name)
+}
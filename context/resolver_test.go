@@ -0,0 +1,82 @@
+package context
+
+import (
+	"testing"
+
+	"github.com/mlctrez/mystace/internal/testify"
+)
+
+type countingResolver struct {
+	values map[string]interface{}
+	calls  []string
+}
+
+func (c *countingResolver) Resolve(name string) (v interface{}, ok bool) {
+	c.calls = append(c.calls, name)
+	v, ok = c.values[name]
+	return
+}
+
+func TestResolverFunc(t *testing.T) {
+	require := testify.Require(t)
+
+	var r Resolver = ResolverFunc(func(name string) (interface{}, bool) {
+		return "resolved " + name, true
+	})
+	v, ok := r.Resolve("a")
+	require.True(ok)
+	require.Equal("resolved a", v)
+}
+
+func TestNew_Resolver(t *testing.T) {
+	require := testify.Require(t)
+
+	resolver := &countingResolver{values: map[string]interface{}{
+		"name":   "from resolver",
+		"nested": ResolverFunc(func(name string) (interface{}, bool) { return "nested " + name, true }),
+	}}
+	ctx := New(map[string]interface{}{"child": "value"}, New(resolver, New(map[string]interface{}{"root": "root"})))
+
+	v, ok := ctx.Lookup("child")
+	require.True(ok)
+	require.Equal("value", v)
+	require.Empty(resolver.calls)
+
+	v, ok = ctx.Lookup("name")
+	require.True(ok)
+	require.Equal("from resolver", v)
+
+	v, ok = ctx.Lookup("nested.x")
+	require.True(ok)
+	require.Equal("nested x", v)
+
+	v, ok = ctx.Lookup("root")
+	require.True(ok)
+	require.Equal("root", v)
+
+	// the resolver is only asked for names that were looked up
+	require.Equal([]string{"name", "nested", "root"}, resolver.calls)
+
+	v, ok = ctx.Lookup("name.missing")
+	require.False(ok)
+	require.Nil(v)
+
+	v, ok = New(resolver).Lookup(".")
+	require.True(ok)
+	require.Equal(resolver, v)
+
+	require.Contains(New(resolver).String(), "Context: &{")
+}
+
+func TestNew_Values(t *testing.T) {
+	require := testify.Require(t)
+
+	var nilMap map[string]interface{}
+	ctx := New(nilMap)
+	require.NotNil(ctx.values)
+
+	ctx = New("scalar")
+	v, ok := ctx.Lookup(".")
+	require.True(ok)
+	require.Equal("scalar", v)
+}
@@ -0,0 +1,319 @@
+// Package format prints templates canonically: tags without inner whitespace, {{name}},
+// {{#name}}, {{> name}} and {{>*name}}, and standalone section and comment tags indented
+// by the depth of their sections.
+//
+// Formatting never changes the output of a template. Every change is checked by parsing
+// the result, which follows the whitespace rules of the renderer, and changes that would
+// alter the output, such as the indentation of a close tag the renderer writes, are left
+// out. A section may be a lambda receiving its text as written, so the text within
+// sections is left unchanged unless WithoutLambdas is given.
+package format
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mlctrez/mystace/lexer"
+	"github.com/mlctrez/mystace/parse"
+	"github.com/mlctrez/mystace/source"
+)
+
+// DefaultIndent is the number of spaces indenting each level of nested sections
+const DefaultIndent = 2
+
+var ErrNotEquivalent = fmt.Errorf("formatted template renders differently")
+
+type Option func(f *formatter) error
+
+// WithIndent sets the number of spaces indenting each level of nested sections, which are only
+// formatted with WithoutLambdas. The renderer only removes spaces before standalone tags, so
+// tabs would change the output.
+func WithIndent(spaces int) Option {
+	return func(f *formatter) error {
+		if spaces < 0 {
+			return fmt.Errorf("negative indent %d", spaces)
+		}
+		f.indent = strings.Repeat(" ", spaces)
+		return nil
+	}
+}
+
+// WithDelimiters reads and writes templates using open and close instead of {{ and }}
+func WithDelimiters(open, close string) Option {
+	return func(f *formatter) error {
+		f.open, f.close = open, close
+		f.lexerOptions = append(f.lexerOptions, lexer.WithDelimiters(open, close))
+		return nil
+	}
+}
+
+// WithoutLambdas formats the text within sections, for templates rendered without lambdas,
+// which would receive the formatted text
+func WithoutLambdas() Option {
+	return func(f *formatter) error {
+		f.withoutLambdas = true
+		return nil
+	}
+}
+
+// WithLexerOptions reads templates with options, such as lexer.WithMaxLoops
+func WithLexerOptions(options ...lexer.Option) Option {
+	return func(f *formatter) error {
+		f.lexerOptions = append(f.lexerOptions, options...)
+		return nil
+	}
+}
+
+type formatter struct {
+	name           string
+	indent         string
+	open           string
+	close          string
+	withoutLambdas bool
+	lexerOptions   []lexer.Option
+}
+
+// edit replaces the text of a token
+type edit struct {
+	index int
+	text  string
+}
+
+// Source returns the canonical form of the template src, which must parse without errors
+func Source(src source.Source, options ...Option) (formatted string, err error) {
+	f := &formatter{name: src.Name(), indent: strings.Repeat(" ", DefaultIndent), open: lexer.OpenDelimiter, close: lexer.CloseDelimiter}
+	for _, option := range options {
+		if err = option(f); err != nil {
+			return
+		}
+	}
+	var tokens []lexer.Token
+	if tokens, err = lexer.New(src, f.lexerOptions...).Parse(); err != nil {
+		return
+	}
+	var tree *parse.Tree
+	if tree, err = parse.Tokens(f.name, tokens); err != nil {
+		return
+	}
+
+	tags, indents := f.tags(tokens), f.indents(tokens)
+	formatted = f.print(tokens, append(append([]edit{}, tags...), indents...))
+	if f.equivalent(tree, formatted) {
+		return
+	}
+	// keep the changes that do not alter the output one at a time
+	var kept []edit
+	for _, change := range changes(tokens, append(tags, indents...)) {
+		if f.equivalent(tree, f.print(tokens, append(kept, change...))) {
+			kept = append(kept, change...)
+		}
+	}
+	formatted = f.print(tokens, kept)
+	if !f.equivalent(tree, formatted) {
+		return "", fmt.Errorf("%s : %w", f.name, ErrNotEquivalent)
+	}
+	return
+}
+
+// String formats the template text
+func String(template string, options ...Option) (string, error) {
+	src, err := source.FromString(template, source.WithName("template"))
+	if err != nil {
+		return "", err
+	}
+	return Source(src, options...)
+}
+
+// changes groups the edits of the open and close tags of each section, which only match when edited together
+func changes(tokens []lexer.Token, edits []edit) (groups [][]edit) {
+	closes := map[int]int{}
+	for _, e := range edits {
+		if group, ok := closes[e.index]; ok {
+			groups[group] = append(groups[group], e)
+			continue
+		}
+		if mods, _ := tokens[e.index].Value(); !tokens[e.index].IsChar() && mods.HasModifier(lexer.HashModifier, lexer.InvertedModifier) {
+			if end := lexer.CloseOf(tokens, e.index); end != -1 {
+				closes[end] = len(groups)
+			}
+		}
+		groups = append(groups, []edit{e})
+	}
+	return
+}
+
+// tags returns the edits writing tags canonically
+func (f *formatter) tags(tokens []lexer.Token) (edits []edit) {
+	for i, token := range tokens {
+		if token.IsChar() {
+			continue
+		}
+		mods, value := token.Value()
+		var inner string
+		switch {
+		case mods.HasModifier(lexer.CommentModifier):
+			continue
+		case token.IsThreeBracket():
+			inner = "{" + modifiers(mods) + strings.TrimSpace(value) + "}"
+		case mods.HasModifier(lexer.ImportModifier):
+			if name, dynamic := lexer.PartialName(value); dynamic {
+				inner = string(lexer.ImportModifier) + lexer.DynamicPrefix + name
+			} else {
+				inner = string(lexer.ImportModifier) + " " + name
+			}
+		default:
+			inner = modifiers(mods) + strings.TrimSpace(value)
+		}
+		if text := f.open + inner + f.close; text != f.text(token) {
+			edits = append(edits, edit{index: i, text: text})
+		}
+	}
+	return
+}
+
+func modifiers(mods lexer.Modifiers) (s string) {
+	for _, m := range mods {
+		s += string(m)
+	}
+	return
+}
+
+// indents returns the edits indenting standalone section and comment tags by their depth
+func (f *formatter) indents(tokens []lexer.Token) (edits []edit) {
+	depth := 0
+	for i, token := range tokens {
+		if token.IsChar() {
+			continue
+		}
+		mods, _ := token.Value()
+		level := depth
+		switch {
+		case mods.HasModifier(lexer.HashModifier, lexer.InvertedModifier):
+			depth++
+		case mods.HasModifier(lexer.CloseModifier):
+			if depth > 0 {
+				depth--
+			}
+			level = depth
+		case mods.HasModifier(lexer.CommentModifier):
+			if strings.Contains(token.Data.Str, "\n") {
+				continue
+			}
+		default:
+			continue
+		}
+		if i == 0 || !tokens[i-1].IsChar() || !standaloneAfter(tokens, i) {
+			continue
+		}
+		before := tokens[i-1].Data.Str
+		line := strings.LastIndex(before, "\n")
+		if line == -1 && i-1 != 0 || strings.TrimSpace(before[line+1:]) != "" {
+			continue
+		}
+		if text := before[:line+1] + strings.Repeat(f.indent, level); text != before {
+			edits = append(edits, edit{index: i - 1, text: text})
+		}
+	}
+	return
+}
+
+// standaloneAfter reports whether only spaces follow tokens[i] on its line
+func standaloneAfter(tokens []lexer.Token, i int) bool {
+	if i == len(tokens)-1 {
+		return true
+	}
+	next := tokens[i+1]
+	if !next.IsChar() {
+		return false
+	}
+	rest := next.Data.Str
+	if end := strings.Index(rest, "\n"); end != -1 {
+		rest = rest[:end]
+	}
+	return strings.TrimSpace(rest) == ""
+}
+
+// text returns the text of token as written in the source
+func (f *formatter) text(token lexer.Token) string {
+	if token.IsChar() {
+		return token.Data.Str
+	}
+	inner := strings.TrimSuffix(strings.TrimPrefix(token.Data.Str, lexer.OpenDelimiter), lexer.CloseDelimiter)
+	return f.open + inner + f.close
+}
+
+func (f *formatter) print(tokens []lexer.Token, edits []edit) string {
+	replaced := map[int]string{}
+	for _, e := range edits {
+		replaced[e.index] = e.text
+	}
+	var b strings.Builder
+	for i, token := range tokens {
+		if text, ok := replaced[i]; ok {
+			b.WriteString(text)
+		} else {
+			b.WriteString(f.text(token))
+		}
+	}
+	return b.String()
+}
+
+// equivalent reports whether the template text parses to a tree rendering the same output as tree
+func (f *formatter) equivalent(tree *parse.Tree, text string) bool {
+	src, err := source.FromString(text, source.WithName(f.name))
+	if err != nil {
+		return false
+	}
+	var formatted *parse.Tree
+	if formatted, err = parse.Parse(src, f.lexerOptions...); err != nil {
+		return false
+	}
+	return f.sameNodes(tree.Nodes, formatted.Nodes)
+}
+
+// sameNodes compares the output of nodes, names are compared as the renderer looks them up
+// and sections by the text passed to lambdas unless there are none
+func (f *formatter) sameNodes(a, b []parse.Node) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		switch an := a[i].(type) {
+		case *parse.TextNode:
+			bn, ok := b[i].(*parse.TextNode)
+			if !ok || an.Text != bn.Text {
+				return false
+			}
+		case *parse.VariableNode:
+			bn, ok := b[i].(*parse.VariableNode)
+			if !ok || strings.TrimSpace(an.Name) != strings.TrimSpace(bn.Name) || an.Escape != bn.Escape {
+				return false
+			}
+		case *parse.SectionNode:
+			bn, ok := b[i].(*parse.SectionNode)
+			if !ok || strings.TrimSpace(an.Name) != strings.TrimSpace(bn.Name) || an.Inverted != bn.Inverted || !f.sameNodes(an.Nodes, bn.Nodes) {
+				return false
+			}
+			if !f.withoutLambdas && an.Raw != bn.Raw {
+				return false
+			}
+		case *parse.CommentNode:
+			if _, ok := b[i].(*parse.CommentNode); !ok {
+				return false
+			}
+		case *parse.PartialNode:
+			bn, ok := b[i].(*parse.PartialNode)
+			if !ok || an.Name != bn.Name || an.Dynamic != bn.Dynamic {
+				return false
+			}
+		case *parse.TranslateNode:
+			bn, ok := b[i].(*parse.TranslateNode)
+			if !ok || an.Key != bn.Key {
+				return false
+			}
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,134 @@
+package format
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/mlctrez/mystace/context"
+	"github.com/mlctrez/mystace/internal/testify"
+	"github.com/mlctrez/mystace/lexer"
+	"github.com/mlctrez/mystace/parse"
+	"github.com/mlctrez/mystace/render"
+	"github.com/mlctrez/mystace/source"
+)
+
+func renderString(t *testing.T, template string, values interface{}, options ...render.Option) string {
+	_, require := testify.New(t)
+	src, err := source.FromString(template, source.WithName("t"))
+	require.Nil(err)
+	partial, err := source.FromString("<{{name}}>", source.WithName("p"))
+	require.Nil(err)
+	r := render.New(options...)
+	buf := &bytes.Buffer{}
+	r.Writer(buf)
+	require.Nil(r.AddSource(src))
+	require.Nil(r.AddSource(partial))
+	require.Nil(r.Render("t", context.New(values)))
+	return buf.String()
+}
+
+func TestString(t *testing.T) {
+	_, require := testify.New(t)
+
+	values := map[string]interface{}{
+		"name":  "<b>",
+		"items": []interface{}{map[string]interface{}{"name": "a", "tags": true}, map[string]interface{}{"name": "b", "tags": false}},
+		"empty": []interface{}{},
+	}
+	template := "{{ name }} {{& name }} {{{ name }}} {{>p}}{{> * widget }}\n" +
+		"{{# items }}\n" +
+		"{{! a comment }}\n" +
+		"      {{#tags}}\n" +
+		"- {{ name }}\n" +
+		"{{/tags}}\n" +
+		"{{/ items }}\n" +
+		"   {{^ empty }}none{{/ empty }}\n"
+
+	// the text within sections is left as written for lambdas
+	formatted, err := String(template)
+	require.Nil(err)
+	require.Equal("{{name}} {{&name}} {{{name}}} {{> p}}{{>*widget}}\n"+
+		"{{#items}}\n"+
+		"{{! a comment }}\n"+
+		"      {{#tags}}\n"+
+		"- {{ name }}\n"+
+		"{{/tags}}\n"+
+		"{{/items}}\n"+
+		"   {{^empty}}none{{/empty}}\n", formatted)
+	require.Equal(renderString(t, template, values), renderString(t, formatted, values))
+
+	formatted, err = String(template, WithoutLambdas())
+	require.Nil(err)
+	require.Equal("{{name}} {{&name}} {{{name}}} {{> p}}{{>*widget}}\n"+
+		"{{#items}}\n"+
+		"{{! a comment }}\n"+
+		"  {{#tags}}\n"+
+		"- {{name}}\n"+
+		"{{/tags}}\n"+
+		"{{/items}}\n"+
+		"   {{^empty}}none{{/empty}}\n", formatted)
+	require.Equal(renderString(t, template, values), renderString(t, formatted, values))
+
+	again, err := String(formatted, WithoutLambdas())
+	require.Nil(err)
+	require.Equal(formatted, again)
+}
+
+func TestString_Lambdas(t *testing.T) {
+	_, require := testify.New(t)
+
+	verbatim := context.Lambda(func(text string, ctx *context.Context, render context.RenderFunc) (string, error) {
+		return text, nil
+	})
+	values := map[string]interface{}{"code": verbatim, "name": "n"}
+	template := "{{# code }}\n  {{ name }}\n    {{#a}}\nx\n    {{/a}}\n{{/ code }}\n"
+
+	formatted, err := String(template)
+	require.Nil(err)
+	require.Equal("{{#code}}\n  {{ name }}\n    {{#a}}\nx\n    {{/a}}\n{{/code}}\n", formatted)
+	require.Equal(renderString(t, template, values), renderString(t, formatted, values))
+
+	formatted, err = String(template, WithoutLambdas())
+	require.Nil(err)
+	require.NotEqual(renderString(t, template, values), renderString(t, formatted, values))
+}
+
+func TestString_KeepsOutput(t *testing.T) {
+	_, require := testify.New(t)
+
+	values := map[string]interface{}{"a": true, "b": true, "name": "n"}
+	for _, template := range []string{
+		"{{#a}}\n  {{#b}}\n  x\n  {{/b}}\n{{/a}}\n",
+		"{{#a}}\n{{#b}}\n{{name}}\n    {{/b}}\n{{/a}}",
+		"  {{! first }}\ntext {{ name }}x",
+		"{{#a}}\n\t{{! tab }}\n{{/a}}",
+		"{{#a}}\nx\n\t{{#b}}\ny\n{{/b}}\n{{/a}}",
+	} {
+		for _, options := range [][]Option{nil, {WithoutLambdas()}} {
+			formatted, err := String(template, options...)
+			require.Nil(err, template)
+			require.Equal(renderString(t, template, values), renderString(t, formatted, values), template)
+		}
+	}
+
+	formatted, err := String("{{#a}}\n  {{#b}}\nx\n{{/b}}\n{{/a}}\n", WithIndent(4), WithoutLambdas())
+	require.Nil(err)
+	require.Equal("{{#a}}\n    {{#b}}\nx\n{{/b}}\n{{/a}}\n", formatted)
+	_, err = String("", WithIndent(-1))
+	require.NotNil(err)
+}
+
+func TestSource(t *testing.T) {
+	_, require := testify.New(t)
+
+	src, err := source.FromString("<% name %> {{ kept }}\n<%#a%>\n    <%# b %>\nx\n<%/ b %>\n<%/a%>", source.WithName("d"))
+	require.Nil(err)
+	formatted, err := Source(src, WithDelimiters("<%", "%>"), WithoutLambdas())
+	require.Nil(err)
+	require.Equal("<%name%> {{ kept }}\n<%#a%>\n  <%#b%>\nx\n<%/b%>\n<%/a%>", formatted)
+
+	_, err = String("{{#a}}")
+	require.ErrorIs(err, parse.ErrMissingClose)
+	_, err = String("{{a")
+	require.ErrorIs(err, lexer.ErrMissingEndToken)
+}
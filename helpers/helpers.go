@@ -0,0 +1,314 @@
+package helpers
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mlctrez/mystace/context"
+	"github.com/mlctrez/mystace/locale"
+)
+
+// ArgSeparator separates the arguments inside a helper section, e.g. {{#default}}name|anonymous{{/default}}
+const ArgSeparator = "|"
+
+const (
+	DefaultJoinSeparator = ", "
+	DefaultDateLayout    = "2006-01-02"
+)
+
+var (
+	ErrMissingArgument = fmt.Errorf("missing argument")
+	ErrNotANumber      = fmt.Errorf("not a number")
+	ErrNotADate        = fmt.Errorf("not a date")
+	ErrNotAList        = fmt.Errorf("not a list")
+)
+
+// Map returns a new map of every helper by name, suitable for use as a root frame:
+//
+//	ctx := context.New(data, context.New(helpers.Map()))
+func Map() map[string]interface{} {
+	return map[string]interface{}{
+		"upper":     context.Lambda(Upper),
+		"lower":     context.Lambda(Lower),
+		"trim":      context.Lambda(Trim),
+		"markdown":  context.Lambda(Markdown),
+		"join":      context.Lambda(Join),
+		"default":   context.Lambda(Default),
+		"json":      context.Lambda(JSON),
+		"date":      context.Lambda(Date),
+		"pluralize": context.Lambda(Pluralize),
+		"number":    context.Lambda(Number),
+		"currency":  context.Lambda(Currency),
+	}
+}
+
+// Context returns a frame holding every helper, with an optional parent
+func Context(parent ...*context.Context) *context.Context {
+	return context.New(Map(), parent...)
+}
+
+// Upper renders the section body and converts it to upper case
+func Upper(text string, _ *context.Context, render context.RenderFunc) (string, error) {
+	return renderAnd(text, render, strings.ToUpper)
+}
+
+// Lower renders the section body and converts it to lower case
+func Lower(text string, _ *context.Context, render context.RenderFunc) (string, error) {
+	return renderAnd(text, render, strings.ToLower)
+}
+
+// Trim renders the section body and removes leading and trailing whitespace
+func Trim(text string, _ *context.Context, render context.RenderFunc) (string, error) {
+	return renderAnd(text, render, strings.TrimSpace)
+}
+
+// Markdown renders the section body and escapes characters that have meaning in markdown
+func Markdown(text string, _ *context.Context, render context.RenderFunc) (string, error) {
+	return renderAnd(text, render, markdownEscaper.Replace)
+}
+
+var markdownEscaper = strings.NewReplacer(
+	`\`, `\\`, "`", "\\`", `*`, `\*`, `_`, `\_`, `{`, `\{`, `}`, `\}`, `[`, `\[`, `]`, `\]`,
+	`(`, `\(`, `)`, `\)`, `#`, `\#`, `+`, `\+`, `-`, `\-`, `.`, `\.`, `!`, `\!`, `|`, `\|`,
+	`<`, `\<`, `>`, `\>`,
+)
+
+// Join joins the escaped items of the list at name with an optional separator: {{#join}}name|, {{/join}}
+func Join(text string, ctx *context.Context, _ context.RenderFunc) (result string, err error) {
+	args := splitArgs(text)
+	sep := DefaultJoinSeparator
+	if len(args) > 1 {
+		sep = args[1]
+	}
+	loc := localeOf(ctx)
+	v, _, err := ctx.Value(args[0])
+	if err != nil {
+		return "", err
+	}
+	switch vt := v.(type) {
+	case nil:
+	case []interface{}:
+		parts := make([]string, 0, len(vt))
+		for _, item := range vt {
+			parts = append(parts, ctx.Escape(toString(item, loc)))
+		}
+		result = strings.Join(parts, sep)
+	case []string:
+		parts := make([]string, 0, len(vt))
+		for _, item := range vt {
+			parts = append(parts, ctx.Escape(item))
+		}
+		result = strings.Join(parts, sep)
+	default:
+		err = fmt.Errorf("join %q : %w", args[0], ErrNotAList)
+	}
+	return
+}
+
+// Default returns the escaped value at name, or the fallback when it is missing or empty: {{#default}}name|fallback{{/default}}
+func Default(text string, ctx *context.Context, _ context.RenderFunc) (string, error) {
+	args := splitArgs(text)
+	v, ok, err := ctx.Value(args[0])
+	if err != nil {
+		return "", err
+	}
+	if ok {
+		if s := toString(v, localeOf(ctx)); s != "" {
+			return ctx.Escape(s), nil
+		}
+	}
+	if len(args) > 1 {
+		return args[1], nil
+	}
+	return "", nil
+}
+
+// JSON encodes the value at name as json: {{#json}}name{{/json}}
+func JSON(text string, ctx *context.Context, _ context.RenderFunc) (string, error) {
+	args := splitArgs(text)
+	v, _, err := ctx.Value(args[0])
+	if err != nil {
+		return "", err
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// Date formats the time at name with an optional go time layout: {{#date}}name|2006-01-02{{/date}}
+//
+// Values may be a time.Time, an RFC 3339 string or a number of seconds since the unix epoch.
+func Date(text string, ctx *context.Context, _ context.RenderFunc) (string, error) {
+	args := splitArgs(text)
+	layout := DefaultDateLayout
+	if len(args) > 1 {
+		layout = args[1]
+	}
+	v, ok, err := ctx.Value(args[0])
+	if err != nil || !ok || v == nil {
+		return "", err
+	}
+	t, err := toTime(v)
+	if err != nil {
+		return "", fmt.Errorf("date %q : %w", args[0], err)
+	}
+	return t.Format(layout), nil
+}
+
+// Pluralize chooses a word based on the count at name: {{#pluralize}}name|item|items{{/pluralize}}
+//
+// When the plural form is omitted, an "s" is appended to the singular form.
+func Pluralize(text string, ctx *context.Context, _ context.RenderFunc) (string, error) {
+	args := splitArgs(text)
+	if len(args) < 2 {
+		return "", fmt.Errorf("pluralize %q : %w", text, ErrMissingArgument)
+	}
+	singular, plural := args[1], args[1]+"s"
+	if len(args) > 2 {
+		plural = args[2]
+	}
+	v, _, err := ctx.Value(args[0])
+	if err != nil {
+		return "", err
+	}
+	n, err := toFloat(v)
+	if err != nil {
+		return "", fmt.Errorf("pluralize %q : %w", args[0], err)
+	}
+	if n == 1 {
+		return singular, nil
+	}
+	return plural, nil
+}
+
+// Number formats the number at name with grouping and an optional count of decimals: {{#number}}name|2{{/number}}
+//
+// Numbers are formatted in the locale of the renderer, or locale.Default when it has none.
+func Number(text string, ctx *context.Context, _ context.RenderFunc) (string, error) {
+	args := splitArgs(text)
+	decimals := -1
+	if len(args) > 1 {
+		var err error
+		if decimals, err = strconv.Atoi(args[1]); err != nil {
+			return "", fmt.Errorf("number decimals %q : %w", args[1], ErrNotANumber)
+		}
+	}
+	v, _, err := ctx.Value(args[0])
+	if err != nil {
+		return "", err
+	}
+	n, err := toFloat(v)
+	if err != nil {
+		return "", fmt.Errorf("number %q : %w", args[0], err)
+	}
+	return localeOf(ctx).FormatNumber(n, decimals), nil
+}
+
+// Currency formats the number at name as an amount in an ISO 4217 currency: {{#currency}}name|EUR{{/currency}}
+//
+// The currency code defaults to USD. Amounts are formatted in the locale of the renderer, or
+// locale.Default when it has none.
+func Currency(text string, ctx *context.Context, _ context.RenderFunc) (string, error) {
+	args := splitArgs(text)
+	code := "USD"
+	if len(args) > 1 {
+		code = strings.ToUpper(args[1])
+	}
+	v, _, err := ctx.Value(args[0])
+	if err != nil {
+		return "", err
+	}
+	n, err := toFloat(v)
+	if err != nil {
+		return "", fmt.Errorf("currency %q : %w", args[0], err)
+	}
+	return localeOf(ctx).FormatCurrency(n, code), nil
+}
+
+// FormatCurrency formats n with the symbol and decimals of the currency code in the default locale
+func FormatCurrency(n float64, code string) string {
+	return locale.Default.FormatCurrency(n, code)
+}
+
+// FormatNumber formats n with grouping in the default locale. When decimals is negative, up to two decimals are shown.
+func FormatNumber(n float64, decimals int) string {
+	return locale.Default.FormatNumber(n, decimals)
+}
+
+// localeOf returns the locale of the renderer invoking a helper, or locale.Default
+func localeOf(ctx *context.Context) locale.Locale {
+	if l, ok := ctx.Locale(); ok {
+		return l
+	}
+	return locale.Default
+}
+
+func renderAnd(text string, render context.RenderFunc, f func(string) string) (string, error) {
+	rendered, err := render(text)
+	if err != nil {
+		return "", err
+	}
+	return f(rendered), nil
+}
+
+func splitArgs(text string) (args []string) {
+	args = strings.Split(text, ArgSeparator)
+	args[0] = strings.TrimSpace(args[0])
+	return
+}
+
+func toString(v interface{}, loc locale.Locale) string {
+	switch vt := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return vt
+	case float64:
+		return loc.FormatNumber(vt, -1)
+	default:
+		return fmt.Sprint(vt)
+	}
+}
+
+func toFloat(v interface{}) (float64, error) {
+	switch vt := v.(type) {
+	case float64:
+		return vt, nil
+	case float32:
+		return float64(vt), nil
+	case int:
+		return float64(vt), nil
+	case int64:
+		return float64(vt), nil
+	case json.Number:
+		if f, err := vt.Float64(); err == nil {
+			return f, nil
+		}
+	case string:
+		if f, err := strconv.ParseFloat(strings.TrimSpace(vt), 64); err == nil {
+			return f, nil
+		}
+	}
+	return math.NaN(), ErrNotANumber
+}
+
+func toTime(v interface{}) (time.Time, error) {
+	switch vt := v.(type) {
+	case time.Time:
+		return vt, nil
+	case string:
+		if t, err := time.Parse(time.RFC3339, vt); err == nil {
+			return t, nil
+		}
+	case float64:
+		sec, frac := math.Modf(vt)
+		return time.Unix(int64(sec), int64(frac*1e9)).UTC(), nil
+	}
+	return time.Time{}, ErrNotADate
+}
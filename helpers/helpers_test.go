@@ -0,0 +1,222 @@
+package helpers
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mlctrez/mystace/context"
+	"github.com/mlctrez/mystace/internal/testify"
+	"github.com/mlctrez/mystace/locale"
+	"github.com/mlctrez/mystace/render"
+	"github.com/mlctrez/mystace/source"
+)
+
+func renderWithHelpers(template string, data map[string]interface{}, options ...render.Option) (string, error) {
+	src, err := source.FromString(template, source.WithName("test"))
+	if err != nil {
+		return "", err
+	}
+	r := render.New(options...)
+	buf := &bytes.Buffer{}
+	r.Writer(buf)
+	if err = r.AddSource(src); err != nil {
+		return "", err
+	}
+	err = r.Render("test", context.New(data, Context()))
+	return buf.String(), err
+}
+
+func TestMap(t *testing.T) {
+	_, require := testify.New(t)
+
+	m := Map()
+	for _, name := range []string{"upper", "lower", "trim", "markdown", "join", "default",
+		"json", "date", "pluralize", "number", "currency"} {
+		require.IsType(context.Lambda(nil), m[name], name)
+	}
+
+	// each call returns a map that is safe to modify
+	m["upper"] = nil
+	require.NotNil(Map()["upper"])
+}
+
+func TestHelpers(t *testing.T) {
+	_, require := testify.New(t)
+
+	created := time.Date(2022, 4, 5, 6, 7, 8, 0, time.UTC)
+	data := map[string]interface{}{
+		"name":    "World",
+		"padded":  "  padded  ",
+		"empty":   "",
+		"tags":    []interface{}{"a", "b", 3.0},
+		"user":    map[string]interface{}{"id": 1.0},
+		"created": created,
+		"stamp":   "2022-04-05T06:07:08Z",
+		"one":     1.0,
+		"many":    3.0,
+		"total":   1234567.5,
+		"neg":     -1234.5,
+	}
+
+	tests := []struct {
+		template string
+		expected string
+	}{
+		{"{{#upper}}Hello {{name}}{{/upper}}", "HELLO WORLD"},
+		{"{{#lower}}Hello {{name}}{{/lower}}", "hello world"},
+		{"[{{#trim}}{{padded}}{{/trim}}]", "[padded]"},
+		{"{{#markdown}}*bold* _it_{{/markdown}}", `\*bold\* \_it\_`},
+		{"{{#join}}tags{{/join}}", "a, b, 3"},
+		{"{{#join}}tags| / {{/join}}", "a / b / 3"},
+		{"{{#join}}missing{{/join}}", ""},
+		{"{{#default}}name|anonymous{{/default}}", "World"},
+		{"{{#default}}empty|anonymous{{/default}}", "anonymous"},
+		{"{{#default}}missing|anonymous{{/default}}", "anonymous"},
+		{"{{#json}}user{{/json}}", `{"id":1}`},
+		{"{{#date}}created{{/date}}", "2022-04-05"},
+		{"{{#date}}stamp|Jan 2 15:04{{/date}}", "Apr 5 06:07"},
+		{"{{#pluralize}}one|item{{/pluralize}}", "item"},
+		{"{{#pluralize}}many|item{{/pluralize}}", "items"},
+		{"{{#pluralize}}many|person|people{{/pluralize}}", "people"},
+		{"{{#number}}total{{/number}}", "1,234,567.50"},
+		{"{{#number}}total|0{{/number}}", "1,234,568"},
+		{"{{#currency}}total{{/currency}}", "$1,234,567.50"},
+		{"{{#currency}}neg|eur{{/currency}}", "-€1,234.50"},
+		{"{{#currency}}total|JPY{{/currency}}", "¥1,234,568"},
+		{"{{#currency}}total|XYZ{{/currency}}", "XYZ\u00a01,234,567.50"},
+		{"{{^upper}}not rendered{{/upper}}", ""},
+	}
+
+	for _, test := range tests {
+		actual, err := renderWithHelpers(test.template, data)
+		require.Nil(err, test.template)
+		require.Equal(test.expected, actual, test.template)
+	}
+
+}
+
+func TestHelpers_Escaping(t *testing.T) {
+	_, require := testify.New(t)
+
+	data := map[string]interface{}{
+		"name":    "<script>x</script>",
+		"tags":    []interface{}{"a&b", "<i>"},
+		"strings": []string{"<b>", "&"},
+	}
+	tests := []struct {
+		template string
+		expected string
+	}{
+		{"{{#default}}name|x{{/default}}", "&lt;script&gt;x&lt;/script&gt;"},
+		{"{{#default}}missing|<em>none</em>{{/default}}", "<em>none</em>"},
+		{"{{#join}}tags|<br>{{/join}}", "a&amp;b<br>&lt;i&gt;"},
+		{"{{#join}}strings{{/join}}", "&lt;b&gt;, &amp;"},
+	}
+	for _, test := range tests {
+		actual, err := renderWithHelpers(test.template, data)
+		require.Nil(err, test.template)
+		require.Equal(test.expected, actual, test.template)
+	}
+
+	// values are escaped by the escaper of the renderer
+	actual, err := renderWithHelpers("{{#default}}name{{/default}}-{{#join}}tags{{/join}}", data,
+		render.WithEscaper(strings.ToUpper))
+	require.Nil(err)
+	require.Equal("<SCRIPT>X</SCRIPT>-A&B, <I>", actual)
+
+	// and html escaped when called outside a renderer
+	actual, err = Default("name", context.New(data), nil)
+	require.Nil(err)
+	require.Equal("&lt;script&gt;x&lt;/script&gt;", actual)
+}
+
+func TestHelpers_Locale(t *testing.T) {
+	_, require := testify.New(t)
+
+	de, err := locale.Lookup("de-DE")
+	require.Nil(err)
+	data := map[string]interface{}{"total": 1234567.5, "amounts": []interface{}{1234.5, 2.0}}
+
+	actual, err := renderWithHelpers("{{#number}}total{{/number}} / {{#currency}}total|EUR{{/currency}} / {{#join}}amounts|; {{/join}}",
+		data, render.WithLocale(de))
+	require.Nil(err)
+	require.Equal("1.234.567,50 / 1.234.567,50\u00a0€ / 1.234,50; 2", actual)
+}
+
+func TestHelpers_LookupOptions(t *testing.T) {
+	_, require := testify.New(t)
+
+	calls := 0
+	data := map[string]interface{}{
+		"name":  "outer",
+		"user":  map[string]interface{}{"name": "inner"},
+		"items": []interface{}{map[string]interface{}{"tags": []interface{}{"a", "<b>"}}},
+		"lazy": context.Lazy(func() (interface{}, error) {
+			calls++
+			return 2.0, nil
+		}),
+		"failing": context.Lazy(func() (interface{}, error) { return nil, ErrNotADate }),
+	}
+
+	// names are looked up as tags are, with the options of the renderer
+	template := "{{#user}}{{#default}}../name|none{{/default}}{{/user}} / {{#join}}items.0.tags{{/join}}"
+	actual, err := renderWithHelpers(template, data, render.WithParentPaths(), render.WithNumericIndexes())
+	require.Nil(err)
+	require.Equal("outer / a, &lt;b&gt;", actual)
+	actual, err = renderWithHelpers(template, data)
+	require.Nil(err)
+	require.Equal("none / ", actual)
+
+	// lazy values are evaluated once per render and their errors fail the render
+	actual, err = renderWithHelpers("{{lazy}}-{{#default}}lazy{{/default}}-{{#number}}lazy{{/number}}", data)
+	require.Nil(err)
+	require.Equal("2-2-2", actual)
+	require.Equal(1, calls)
+	_, err = renderWithHelpers("{{#default}}failing|x{{/default}}", data)
+	require.ErrorIs(err, ErrNotADate)
+
+	// section text is rendered with the delimiters of the template
+	actual, err = renderWithHelpers("<%#upper%>hi <%name%> {{name}}<%/upper%>", data, render.WithDelimiters("<%", "%>"))
+	require.Nil(err)
+	require.Equal("HI OUTER {{NAME}}", actual)
+}
+
+func TestHelpers_Errors(t *testing.T) {
+	_, require := testify.New(t)
+
+	data := map[string]interface{}{"name": "World"}
+
+	_, err := renderWithHelpers("{{#join}}name{{/join}}", data)
+	require.ErrorIs(err, ErrNotAList)
+
+	_, err = renderWithHelpers("{{#date}}name{{/date}}", data)
+	require.ErrorIs(err, ErrNotADate)
+
+	_, err = renderWithHelpers("{{#pluralize}}name{{/pluralize}}", data)
+	require.ErrorIs(err, ErrMissingArgument)
+
+	_, err = renderWithHelpers("{{#pluralize}}name|item{{/pluralize}}", data)
+	require.ErrorIs(err, ErrNotANumber)
+
+	_, err = renderWithHelpers("{{#number}}name{{/number}}", data)
+	require.ErrorIs(err, ErrNotANumber)
+
+	_, err = renderWithHelpers("{{#number}}name|x{{/number}}", data)
+	require.ErrorIs(err, ErrNotANumber)
+
+	_, err = renderWithHelpers("{{#currency}}name{{/currency}}", data)
+	require.ErrorIs(err, ErrNotANumber)
+
+}
+
+func TestFormatNumber(t *testing.T) {
+	_, require := testify.New(t)
+
+	require.Equal("0", FormatNumber(0, -1))
+	require.Equal("999", FormatNumber(999, -1))
+	require.Equal("1,000", FormatNumber(1000, -1))
+	require.Equal("-12,345.68", FormatNumber(-12345.678, 2))
+	require.Equal("1,234.5000", FormatNumber(1234.5, 4))
+}
@@ -0,0 +1,373 @@
+package i18n
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrNilReadCloser   = fmt.Errorf("nil readCloser")
+	ErrMissingLocale   = fmt.Errorf("missing locale")
+	ErrMessageNotFound = fmt.Errorf("message not found")
+	ErrInvalidMessages = fmt.Errorf("invalid messages")
+)
+
+// PluralArgument is the argument that selects the plural form of gettext entries with msgid_plural
+const PluralArgument = "count"
+
+// Messages are the translations for a single locale
+type Messages struct {
+	Locale   string
+	messages map[string]*Message
+}
+
+type Option func(m *Messages) error
+
+// WithLocale sets the locale of the loaded messages, overriding any locale found in the file
+func WithLocale(tag string) Option {
+	return func(m *Messages) error {
+		if tag == "" {
+			return ErrMissingLocale
+		}
+		m.Locale = tag
+		return nil
+	}
+}
+
+// NewMessages parses a map of message key to ICU style message text
+func NewMessages(tag string, texts map[string]string) (m *Messages, err error) {
+	if tag == "" {
+		return nil, ErrMissingLocale
+	}
+	m = &Messages{Locale: tag, messages: map[string]*Message{}}
+	for key, text := range texts {
+		if m.messages[key], err = Parse(text); err != nil {
+			return nil, fmt.Errorf("key %q : %w", key, err)
+		}
+	}
+	return
+}
+
+// Keys returns the sorted message keys
+func (m *Messages) Keys() (keys []string) {
+	for key := range m.messages {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return
+}
+
+// Message returns the message for key
+func (m *Messages) Message(key string) (msg *Message, ok bool) {
+	msg, ok = m.messages[key]
+	return
+}
+
+// FromJSON loads messages from a json object of keys to ICU style messages.
+// Nested objects are flattened into dotted keys. The locale must be set with WithLocale.
+func FromJSON(r io.ReadCloser, options ...Option) (m *Messages, err error) {
+	if r == nil {
+		return nil, ErrNilReadCloser
+	}
+	var raw map[string]interface{}
+	err = json.NewDecoder(r).Decode(&raw)
+	if closeErr := r.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return
+	}
+
+	texts := map[string]string{}
+	if err = flatten("", raw, texts); err != nil {
+		return
+	}
+	return newMessages(texts, "", options)
+}
+
+func flatten(prefix string, raw map[string]interface{}, texts map[string]string) error {
+	for key, value := range raw {
+		switch vt := value.(type) {
+		case string:
+			texts[prefix+key] = vt
+		case map[string]interface{}:
+			if err := flatten(prefix+key+".", vt, texts); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("key %q : %w", prefix+key, ErrInvalidMessages)
+		}
+	}
+	return nil
+}
+
+func newMessages(texts map[string]string, tag string, options []Option) (m *Messages, err error) {
+	m = &Messages{Locale: tag}
+	for _, option := range options {
+		if err = option(m); err != nil {
+			return nil, err
+		}
+	}
+	return NewMessages(m.Locale, texts)
+}
+
+type poEntry struct {
+	started bool
+	fuzzy   bool
+	context string
+	id      string
+	plural  string
+	strs    map[int]string
+}
+
+// FromPO loads messages from a gettext po file. The locale is read from the Language
+// header unless set with WithLocale. Fuzzy and untranslated entries are skipped, msgctxt
+// is joined to msgid with a dot, and plural forms are assigned to the CLDR categories of
+// the locale in order, selected by the PluralArgument.
+func FromPO(r io.ReadCloser, options ...Option) (m *Messages, err error) {
+	if r == nil {
+		return nil, ErrNilReadCloser
+	}
+
+	var entries []*poEntry
+	current := &poEntry{}
+	flush := func() {
+		if current.started {
+			entries = append(entries, current)
+		}
+		current = &poEntry{}
+	}
+
+	var appendTo func(s string)
+	scanner := bufio.NewScanner(r)
+	lineNumber := 0
+	for scanner.Scan() && err == nil {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			flush()
+			continue
+		}
+		if strings.HasPrefix(line, "#") {
+			if current.strs != nil {
+				flush()
+			}
+			if strings.HasPrefix(line, "#,") && strings.Contains(line, "fuzzy") {
+				current.fuzzy = true
+			}
+			continue
+		}
+
+		keyword, quoted := "", line
+		if !strings.HasPrefix(line, `"`) {
+			keyword, quoted, _ = strings.Cut(line, " ")
+		}
+		var str string
+		if str, err = strconv.Unquote(strings.TrimSpace(quoted)); err != nil {
+			err = fmt.Errorf("line %d : %w", lineNumber, ErrInvalidMessages)
+			break
+		}
+
+		if (keyword == "msgctxt" || keyword == "msgid") && current.strs != nil {
+			flush()
+		}
+		entry := current
+		switch {
+		case keyword == "":
+			if appendTo == nil {
+				err = fmt.Errorf("line %d : %w", lineNumber, ErrInvalidMessages)
+			} else {
+				appendTo(str)
+			}
+			continue
+		case keyword == "msgctxt":
+			appendTo = func(s string) { entry.context += s }
+		case keyword == "msgid":
+			appendTo = func(s string) { entry.id += s }
+		case keyword == "msgid_plural":
+			appendTo = func(s string) { entry.plural += s }
+		case keyword == "msgstr" || strings.HasPrefix(keyword, "msgstr["):
+			form := 0
+			if keyword != "msgstr" {
+				index := strings.TrimSuffix(strings.TrimPrefix(keyword, "msgstr["), "]")
+				if form, err = strconv.Atoi(index); err != nil {
+					err = fmt.Errorf("line %d : %w", lineNumber, ErrInvalidMessages)
+					continue
+				}
+			}
+			if entry.strs == nil {
+				entry.strs = map[int]string{}
+			}
+			appendTo = func(s string) { entry.strs[form] += s }
+		default:
+			err = fmt.Errorf("line %d : unknown keyword %q : %w", lineNumber, keyword, ErrInvalidMessages)
+			continue
+		}
+		entry.started = true
+		appendTo(str)
+	}
+	if err == nil {
+		err = scanner.Err()
+	}
+	if closeErr := r.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return
+	}
+	flush()
+
+	m = &Messages{messages: map[string]*Message{}}
+	for _, e := range entries {
+		if e.id == "" && e.context == "" {
+			m.Locale = strings.ReplaceAll(parseHeader(e.strs[0])["Language"], "_", "-")
+		}
+	}
+	for _, option := range options {
+		if err = option(m); err != nil {
+			return nil, err
+		}
+	}
+	if m.Locale == "" {
+		return nil, ErrMissingLocale
+	}
+
+	_, categories := Plural(m.Locale)
+	for _, e := range entries {
+		if e.id == "" || e.fuzzy || untranslated(e.strs) {
+			continue
+		}
+		key := e.id
+		if e.context != "" {
+			key = e.context + "." + e.id
+		}
+		var msg *Message
+		if e.plural == "" {
+			msg, err = Parse(e.strs[0])
+		} else {
+			msg, err = pluralMessage(e.strs, categories)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("msgid %q : %w", e.id, err)
+		}
+		m.messages[key] = msg
+	}
+	return
+}
+
+func untranslated(strs map[int]string) bool {
+	for _, s := range strs {
+		if s != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// pluralMessage assigns gettext plural forms to the categories of a locale, the last form is also other
+// and categories of missing forms use it
+func pluralMessage(strs map[int]string, categories []string) (msg *Message, err error) {
+	pp := &pluralPart{name: PluralArgument, exact: map[float64][]part{}, cases: map[string][]part{}}
+	last := -1
+	for form := range strs {
+		if form > last {
+			last = form
+		}
+	}
+	for form := 0; form <= last; form++ {
+		str, ok := strs[form]
+		if !ok {
+			continue
+		}
+		p := &parser{text: []rune(str)}
+		var parts []part
+		if parts, err = p.message(true, 0); err != nil {
+			return
+		}
+		if form < len(categories) {
+			pp.cases[categories[form]] = parts
+		}
+		pp.cases[Other] = parts
+	}
+	return &Message{parts: []part{pp}}, nil
+}
+
+func parseHeader(s string) map[string]string {
+	header := map[string]string{}
+	for _, line := range strings.Split(s, "\n") {
+		if key, value, ok := strings.Cut(line, ":"); ok {
+			header[strings.TrimSpace(key)] = strings.TrimSpace(value)
+		}
+	}
+	return header
+}
+
+// Catalog holds messages for many locales. A Catalog is safe for concurrent
+// use by renderers once all messages have been added.
+type Catalog struct {
+	locales map[string]map[string]*Message
+}
+
+func NewCatalog(messages ...*Messages) *Catalog {
+	c := &Catalog{locales: map[string]map[string]*Message{}}
+	for _, m := range messages {
+		c.Add(m)
+	}
+	return c
+}
+
+// Add merges messages into the catalog, replacing any existing keys of the same locale
+func (c *Catalog) Add(m *Messages) {
+	existing, ok := c.locales[m.Locale]
+	if !ok {
+		existing = map[string]*Message{}
+		c.locales[m.Locale] = existing
+	}
+	for key, msg := range m.messages {
+		existing[key] = msg
+	}
+}
+
+// Chain expands locale tags into the order they are searched, each tag followed by its parents:
+// "de-CH", "en-GB" searches de-CH, de, en-GB, en
+func Chain(tags ...string) (chain []string) {
+	seen := map[string]bool{}
+	for _, tag := range tags {
+		for tag != "" {
+			if !seen[tag] {
+				seen[tag] = true
+				chain = append(chain, tag)
+			}
+			i := strings.LastIndex(tag, "-")
+			if i < 0 {
+				break
+			}
+			tag = tag[:i]
+		}
+	}
+	return
+}
+
+// Message finds key in the first locale of the chain that has it
+func (c *Catalog) Message(key string, tags ...string) (msg *Message, tag string, ok bool) {
+	for _, tag = range Chain(tags...) {
+		if msg, ok = c.locales[tag][key]; ok {
+			return
+		}
+	}
+	return nil, "", false
+}
+
+// Translate formats the message for key in the first locale of the chain that has it
+func (c *Catalog) Translate(key string, tags []string, lookup LookupFunc) (string, error) {
+	msg, tag, ok := c.Message(key, tags...)
+	if !ok {
+		return "", fmt.Errorf("key %q locales %v : %w", key, tags, ErrMessageNotFound)
+	}
+	return msg.Format(tag, lookup)
+}
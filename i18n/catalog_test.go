@@ -0,0 +1,203 @@
+package i18n
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+
+	"github.com/mlctrez/mystace/internal/mocks"
+	"github.com/mlctrez/mystace/internal/testify"
+)
+
+func readCloser(s string) *mockReadCloser {
+	return &mockReadCloser{Buffer: bytes.NewBufferString(s)}
+}
+
+type mockReadCloser struct {
+	*bytes.Buffer
+	closed bool
+}
+
+func (m *mockReadCloser) Close() error {
+	m.closed = true
+	return nil
+}
+
+func TestFromJSON(t *testing.T) {
+	_, require := testify.New(t)
+
+	rc := readCloser(`{"greeting": "Hello {name}", "inbox": {"count": "{count, plural, one {# message} other {# messages}}"}}`)
+	m, err := FromJSON(rc, WithLocale("en"))
+	require.Nil(err)
+	require.True(rc.closed)
+	require.Equal("en", m.Locale)
+	require.Equal([]string{"greeting", "inbox.count"}, m.Keys())
+
+	msg, ok := m.Message("inbox.count")
+	require.True(ok)
+	actual, err := msg.Format("en", lookupMap(map[string]interface{}{"count": 2.0}))
+	require.Nil(err)
+	require.Equal("2 messages", actual)
+
+	_, err = FromJSON(nil)
+	require.ErrorIs(err, ErrNilReadCloser)
+
+	_, err = FromJSON(readCloser(`{"greeting": "Hello"}`))
+	require.ErrorIs(err, ErrMissingLocale)
+
+	_, err = FromJSON(readCloser(`{"greeting": "Hello"}`), WithLocale(""))
+	require.ErrorIs(err, ErrMissingLocale)
+
+	_, err = FromJSON(readCloser(`{"greeting": 1}`), WithLocale("en"))
+	require.ErrorIs(err, ErrInvalidMessages)
+
+	_, err = FromJSON(readCloser(`{"nested": {"greeting": 1}}`), WithLocale("en"))
+	require.ErrorIs(err, ErrInvalidMessages)
+
+	_, err = FromJSON(readCloser(`{"greeting": "{"}`), WithLocale("en"))
+	require.ErrorIs(err, ErrSyntax)
+
+	_, err = FromJSON(readCloser(`not json`), WithLocale("en"))
+	require.NotNil(err)
+
+	_, err = FromJSON(ioutil.NopCloser(&mocks.BadReader{ReadErr: mocks.ErrBadReaderMockError}), WithLocale("en"))
+	require.ErrorIs(err, mocks.ErrBadReaderMockError)
+}
+
+const testPO = `# translator comment
+msgid ""
+msgstr ""
+"Language: ru_RU\n"
+"Plural-Forms: nplurals=3;\n"
+
+#: template.mustache:1
+msgid "greeting"
+msgstr "Привет, {name}"
+
+msgctxt "menu"
+msgid "open"
+msgstr "Открыть"
+
+msgid "files"
+msgid_plural "files"
+msgstr[0] "# файл"
+msgstr[1] "# файла"
+msgstr[2] "# файлов"
+
+#, fuzzy
+msgid "fuzzy"
+msgstr "skipped"
+
+msgid "untranslated"
+msgstr ""
+msgid "multi"
+msgstr ""
+"one "
+"two"
+`
+
+func TestFromPO(t *testing.T) {
+	_, require := testify.New(t)
+
+	m, err := FromPO(readCloser(testPO))
+	require.Nil(err)
+	require.Equal("ru-RU", m.Locale)
+	require.Equal([]string{"files", "greeting", "menu.open", "multi"}, m.Keys())
+
+	format := func(key string, values map[string]interface{}) string {
+		msg, ok := m.Message(key)
+		require.True(ok, key)
+		actual, formatErr := msg.Format(m.Locale, lookupMap(values))
+		require.Nil(formatErr)
+		return actual
+	}
+
+	require.Equal("Привет, Ана", format("greeting", map[string]interface{}{"name": "Ана"}))
+	require.Equal("Открыть", format("menu.open", nil))
+	require.Equal("one two", format("multi", nil))
+	require.Equal("1 файл", format("files", map[string]interface{}{"count": 1.0}))
+	require.Equal("3 файла", format("files", map[string]interface{}{"count": 3.0}))
+	require.Equal("5 файлов", format("files", map[string]interface{}{"count": 5.0}))
+	require.Equal("1,50 файлов", format("files", map[string]interface{}{"count": 1.5}))
+
+	m, err = FromPO(readCloser(testPO), WithLocale("uk"))
+	require.Nil(err)
+	require.Equal("uk", m.Locale)
+
+	_, err = FromPO(nil)
+	require.ErrorIs(err, ErrNilReadCloser)
+
+	_, err = FromPO(readCloser("msgid \"a\"\nmsgstr \"b\"\n"))
+	require.ErrorIs(err, ErrMissingLocale)
+
+	m, err = FromPO(readCloser("msgid \"a\"\nmsgid_plural \"b\"\nmsgstr[0] \"# файл\"\nmsgstr[2] \"# файлов\"\n"), WithLocale("ru"))
+	require.Nil(err)
+	require.Equal("1 файл", format("a", map[string]interface{}{"count": 1.0}))
+	require.Equal("3 файлов", format("a", map[string]interface{}{"count": 3.0}))
+	require.Equal("5 файлов", format("a", map[string]interface{}{"count": 5.0}))
+
+	_, err = FromPO(readCloser("msgid \"a\"\nmsgstr \"b\"\n"), WithLocale(""))
+	require.ErrorIs(err, ErrMissingLocale)
+
+	for _, bad := range []string{
+		"\"orphan\"\n",
+		"msgid a\n",
+		"msgstr[x] \"a\"\n",
+		"unknown \"a\"\n",
+	} {
+		_, err = FromPO(readCloser(bad), WithLocale("en"))
+		require.ErrorIs(err, ErrInvalidMessages, bad)
+	}
+
+	_, err = FromPO(readCloser("msgid \"a\"\nmsgstr \"{\"\n"), WithLocale("en"))
+	require.ErrorIs(err, ErrSyntax)
+
+	_, err = FromPO(readCloser("msgid \"a\"\nmsgid_plural \"b\"\nmsgstr[0] \"{\"\n"), WithLocale("en"))
+	require.ErrorIs(err, ErrSyntax)
+}
+
+func TestCatalog(t *testing.T) {
+	_, require := testify.New(t)
+
+	en, err := NewMessages("en", map[string]string{"greeting": "Hello {name}", "bye": "Bye"})
+	require.Nil(err)
+	de, err := NewMessages("de", map[string]string{"greeting": "Hallo {name}"})
+	require.Nil(err)
+	deCH, err := NewMessages("de-CH", map[string]string{"greeting": "Grüezi {name}"})
+	require.Nil(err)
+
+	_, err = NewMessages("", nil)
+	require.ErrorIs(err, ErrMissingLocale)
+
+	_, err = NewMessages("en", map[string]string{"bad": "{"})
+	require.ErrorIs(err, ErrSyntax)
+
+	c := NewCatalog(en, de)
+	c.Add(deCH)
+
+	lookup := lookupMap(map[string]interface{}{"name": "Ana"})
+
+	actual, err := c.Translate("greeting", []string{"de-CH"}, lookup)
+	require.Nil(err)
+	require.Equal("Grüezi Ana", actual)
+
+	actual, err = c.Translate("greeting", []string{"de-AT"}, lookup)
+	require.Nil(err)
+	require.Equal("Hallo Ana", actual)
+
+	actual, err = c.Translate("bye", []string{"de-CH", "en"}, lookup)
+	require.Nil(err)
+	require.Equal("Bye", actual)
+
+	_, err = c.Translate("bye", []string{"de-CH"}, lookup)
+	require.ErrorIs(err, ErrMessageNotFound)
+
+	replacement, err := NewMessages("en", map[string]string{"bye": "Goodbye"})
+	require.Nil(err)
+	c.Add(replacement)
+	actual, err = c.Translate("bye", []string{"en"}, lookup)
+	require.Nil(err)
+	require.Equal("Goodbye", actual)
+
+	require.Equal([]string{"de-CH", "de", "en-GB", "en"}, Chain("de-CH", "de", "en-GB", "en"))
+}
@@ -0,0 +1,362 @@
+package i18n
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/mlctrez/mystace/locale"
+)
+
+var (
+	ErrSyntax       = fmt.Errorf("message syntax error")
+	ErrMissingOther = fmt.Errorf("missing other case")
+	ErrNotANumber   = fmt.Errorf("plural argument is not a number")
+)
+
+// LookupFunc resolves the value of an argument used in a message, context.Context.Lookup satisfies it
+type LookupFunc func(name string) (interface{}, bool)
+
+// Message is a parsed ICU style message such as
+//
+//	Hello {name}, you have {count, plural, =0 {no messages} one {# message} other {# messages}}
+//
+// Arguments are looked up by name, plural arguments choose a case by exact value or by
+// the CLDR plural category of the locale, and # is replaced with the formatted count.
+type Message struct {
+	parts []part
+}
+
+type part interface{}
+
+type textPart string
+
+type argPart string
+
+type hashPart struct{}
+
+type pluralPart struct {
+	name   string
+	offset float64
+	exact  map[float64][]part
+	cases  map[string][]part
+}
+
+type selectPart struct {
+	name  string
+	cases map[string][]part
+}
+
+// Parse parses an ICU style message
+func Parse(text string) (m *Message, err error) {
+	p := &parser{text: []rune(text)}
+	var parts []part
+	if parts, err = p.message(false, 0); err != nil {
+		return
+	}
+	m = &Message{parts: parts}
+	return
+}
+
+// Format formats the message in the locale tag using lookup to resolve arguments
+func (m *Message) Format(tag string, lookup LookupFunc) (string, error) {
+	l, err := locale.Lookup(tag)
+	if err != nil {
+		l = locale.Default
+	}
+	rule, _ := Plural(tag)
+	f := &formatter{locale: l, rule: rule, lookup: lookup}
+	var sb strings.Builder
+	if err = f.format(&sb, m.parts, nil); err != nil {
+		return "", err
+	}
+	return sb.String(), nil
+}
+
+type formatter struct {
+	locale locale.Locale
+	rule   PluralRule
+	lookup LookupFunc
+}
+
+func (f *formatter) format(sb *strings.Builder, parts []part, count *float64) error {
+	for _, p := range parts {
+		switch pt := p.(type) {
+		case textPart:
+			sb.WriteString(string(pt))
+		case hashPart:
+			sb.WriteString(f.locale.FormatNumber(*count, -1))
+		case argPart:
+			if v, ok := f.lookup(string(pt)); ok {
+				sb.WriteString(f.value(v))
+			}
+		case *pluralPart:
+			v, _ := f.lookup(pt.name)
+			n, ok := toFloat(v)
+			if !ok {
+				return fmt.Errorf("argument %q : %w", pt.name, ErrNotANumber)
+			}
+			selected, found := pt.exact[n]
+			if !found {
+				if selected, found = pt.cases[f.rule(n-pt.offset)]; !found {
+					selected = pt.cases[Other]
+				}
+			}
+			shown := n - pt.offset
+			if err := f.format(sb, selected, &shown); err != nil {
+				return err
+			}
+		case *selectPart:
+			v, _ := f.lookup(pt.name)
+			selected, found := pt.cases[f.value(v)]
+			if !found {
+				selected = pt.cases[Other]
+			}
+			if err := f.format(sb, selected, count); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (f *formatter) value(v interface{}) string {
+	switch vt := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return vt
+	case float64:
+		return f.locale.FormatNumber(vt, -1)
+	default:
+		return fmt.Sprint(vt)
+	}
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch vt := v.(type) {
+	case float64:
+		return vt, true
+	case float32:
+		return float64(vt), true
+	case int:
+		return float64(vt), true
+	case int64:
+		return float64(vt), true
+	case json.Number:
+		if f, err := vt.Float64(); err == nil {
+			return f, true
+		}
+	case string:
+		if f, err := strconv.ParseFloat(strings.TrimSpace(vt), 64); err == nil {
+			return f, true
+		}
+	}
+	return 0, false
+}
+
+type parser struct {
+	text []rune
+	pos  int
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("%w at offset %d : %s", ErrSyntax, p.pos, fmt.Sprintf(format, args...))
+}
+
+func (p *parser) more() bool {
+	return p.pos < len(p.text)
+}
+
+func (p *parser) skipSpace() {
+	for p.more() && unicode.IsSpace(p.text[p.pos]) {
+		p.pos++
+	}
+}
+
+// word reads up to the next space or syntax character
+func (p *parser) word() string {
+	start := p.pos
+	for p.more() && !unicode.IsSpace(p.text[p.pos]) && !strings.ContainsRune("{},", p.text[p.pos]) {
+		p.pos++
+	}
+	return string(p.text[start:p.pos])
+}
+
+// message parses text and arguments up to the end of input, or the closing brace of a nested message
+func (p *parser) message(inPlural bool, depth int) (parts []part, err error) {
+	var text strings.Builder
+	flush := func() {
+		if text.Len() > 0 {
+			parts = append(parts, textPart(text.String()))
+			text.Reset()
+		}
+	}
+	for p.more() {
+		r := p.text[p.pos]
+		switch {
+		case r == '\'':
+			p.quoted(&text)
+			continue
+		case r == '#' && inPlural:
+			flush()
+			parts = append(parts, hashPart{})
+		case r == '{':
+			flush()
+			p.pos++
+			var arg part
+			if arg, err = p.argument(inPlural); err != nil {
+				return
+			}
+			parts = append(parts, arg)
+			continue
+		case r == '}':
+			if depth == 0 {
+				err = p.errorf("unexpected }")
+				return
+			}
+			flush()
+			return
+		default:
+			text.WriteRune(r)
+		}
+		p.pos++
+	}
+	if depth > 0 {
+		err = p.errorf("missing }")
+		return
+	}
+	flush()
+	return
+}
+
+// quoted handles apostrophes, a doubled apostrophe is literal and '{...}' is literal text
+func (p *parser) quoted(text *strings.Builder) {
+	p.pos++
+	if !p.more() {
+		text.WriteRune('\'')
+		return
+	}
+	switch p.text[p.pos] {
+	case '\'':
+		text.WriteRune('\'')
+		p.pos++
+	case '{', '}', '#':
+		for p.more() && p.text[p.pos] != '\'' {
+			text.WriteRune(p.text[p.pos])
+			p.pos++
+		}
+		p.pos++
+	default:
+		text.WriteRune('\'')
+	}
+}
+
+// argument parses the inside of {name}, {name, plural, ...} or {name, select, ...}, the
+// cases of a select within a plural replace # like the plural
+func (p *parser) argument(inPlural bool) (arg part, err error) {
+	p.skipSpace()
+	name := p.word()
+	if name == "" {
+		err = p.errorf("missing argument name")
+		return
+	}
+	p.skipSpace()
+	if !p.more() {
+		err = p.errorf("missing }")
+		return
+	}
+	if p.text[p.pos] == '}' {
+		p.pos++
+		arg = argPart(name)
+		return
+	}
+	if p.text[p.pos] != ',' {
+		err = p.errorf("expected , or } after %q", name)
+		return
+	}
+	p.pos++
+	p.skipSpace()
+	kind := p.word()
+	p.skipSpace()
+	if !p.more() || p.text[p.pos] != ',' {
+		err = p.errorf("expected , after %q", kind)
+		return
+	}
+	p.pos++
+
+	switch kind {
+	case "plural":
+		pp := &pluralPart{name: name, exact: map[float64][]part{}, cases: map[string][]part{}}
+		p.skipSpace()
+		if strings.HasPrefix(string(p.text[p.pos:]), "offset:") {
+			p.pos += len("offset:")
+			if pp.offset, err = strconv.ParseFloat(p.word(), 64); err != nil {
+				err = p.errorf("invalid offset")
+				return
+			}
+		}
+		err = p.cases(true, func(selector string, parts []part) error {
+			if strings.HasPrefix(selector, "=") {
+				n, parseErr := strconv.ParseFloat(selector[1:], 64)
+				if parseErr != nil {
+					return p.errorf("invalid selector %q", selector)
+				}
+				pp.exact[n] = parts
+				return nil
+			}
+			pp.cases[selector] = parts
+			return nil
+		})
+		if _, ok := pp.cases[Other]; err == nil && !ok {
+			err = fmt.Errorf("argument %q : %w", name, ErrMissingOther)
+		}
+		arg = pp
+	case "select":
+		sp := &selectPart{name: name, cases: map[string][]part{}}
+		err = p.cases(inPlural, func(selector string, parts []part) error {
+			sp.cases[selector] = parts
+			return nil
+		})
+		if _, ok := sp.cases[Other]; err == nil && !ok {
+			err = fmt.Errorf("argument %q : %w", name, ErrMissingOther)
+		}
+		arg = sp
+	default:
+		err = p.errorf("unsupported argument type %q", kind)
+	}
+	return
+}
+
+// cases parses selector {message} pairs up to the closing brace of the argument
+func (p *parser) cases(inPlural bool, add func(selector string, parts []part) error) (err error) {
+	for {
+		p.skipSpace()
+		if !p.more() {
+			return p.errorf("missing }")
+		}
+		if p.text[p.pos] == '}' {
+			p.pos++
+			return
+		}
+		selector := p.word()
+		if selector == "" {
+			return p.errorf("missing selector")
+		}
+		p.skipSpace()
+		if !p.more() || p.text[p.pos] != '{' {
+			return p.errorf("expected { after %q", selector)
+		}
+		p.pos++
+		var parts []part
+		if parts, err = p.message(inPlural, 1); err != nil {
+			return
+		}
+		p.pos++
+		if err = add(selector, parts); err != nil {
+			return
+		}
+	}
+}
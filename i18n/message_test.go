@@ -0,0 +1,99 @@
+package i18n
+
+import (
+	"testing"
+
+	"github.com/mlctrez/mystace/internal/testify"
+)
+
+func lookupMap(values map[string]interface{}) LookupFunc {
+	return func(name string) (v interface{}, ok bool) {
+		v, ok = values[name]
+		return
+	}
+}
+
+func TestMessage_Format(t *testing.T) {
+	_, require := testify.New(t)
+
+	values := lookupMap(map[string]interface{}{
+		"name":   "Ana",
+		"none":   0.0,
+		"one":    1.0,
+		"many":   1234.0,
+		"few":    3,
+		"text":   "2",
+		"gender": "female",
+	})
+
+	inbox := "{count, plural, =0 {no messages} one {# message} other {# messages}}"
+
+	tests := []struct {
+		tag      string
+		message  string
+		expected string
+	}{
+		{"en", "Hello {name}!", "Hello Ana!"},
+		{"en", "Hello { name }", "Hello Ana"},
+		{"en", "Hello {missing}", "Hello "},
+		{"en", "It''s '{literal}' #", "It's {literal} #"},
+		{"en", "don't", "don't"},
+		{"en", "{none, plural, =0 {no messages} other {# messages}}", "no messages"},
+		{"en", "{one, plural, one {# message} other {# messages}}", "1 message"},
+		{"en", "{many, plural, one {# message} other {# messages}}", "1,234 messages"},
+		{"de", "{many, plural, one {# Nachricht} other {# Nachrichten}}", "1.234 Nachrichten"},
+		{"ru", "{few, plural, one {# файл} few {# файла} many {# файлов} other {# файла}}", "3 файла"},
+		{"en", "{text, plural, one {#} other {# items}}", "2 items"},
+		{"en", "{many, plural, offset:1 one {you and # other} other {you and # others}}", "you and 1,233 others"},
+		{"en", "{gender, select, female {she} male {he} other {they}} said", "she said"},
+		{"en", "{name, select, female {she} other {they}}", "they"},
+		{"en", "{gender, select, female {{one, plural, one {# #} other {x}}} other {y}}", "1 1"},
+		{"en", "{many, plural, one {#} other {{gender, select, female {# for her} other {# for them}}}}", "1,234 for her"},
+		{"en", "{gender, select, female {#} other {y}}", "#"},
+		{"en", "{many}", "1,234"},
+		{"en", "{few}", "3"},
+	}
+
+	for _, test := range tests {
+		m, err := Parse(test.message)
+		require.Nil(err, test.message)
+		actual, err := m.Format(test.tag, values)
+		require.Nil(err, test.message)
+		require.Equal(test.expected, actual, test.message)
+	}
+
+	m, err := Parse(inbox)
+	require.Nil(err)
+	_, err = m.Format("en", values)
+	require.ErrorIs(err, ErrNotANumber)
+}
+
+func TestParse_Errors(t *testing.T) {
+	_, require := testify.New(t)
+
+	for _, message := range []string{
+		"unbalanced }",
+		"{",
+		"{name",
+		"{name extra}",
+		"{}",
+		"{count, plural}",
+		"{count, plural, one {x}",
+		"{count, plural, one x}",
+		"{count, plural, {x}}",
+		"{count, plural, =x {x} other {y}}",
+		"{count, plural, offset:x other {y}}",
+		"{count, ordinal, other {y}}",
+		"{count, plural, other {x}",
+		"{count, plural, other {x",
+	} {
+		_, err := Parse(message)
+		require.ErrorIs(err, ErrSyntax, message)
+	}
+
+	_, err := Parse("{count, plural, one {x}}")
+	require.ErrorIs(err, ErrMissingOther)
+
+	_, err = Parse("{gender, select, male {x}}")
+	require.ErrorIs(err, ErrMissingOther)
+}
@@ -0,0 +1,113 @@
+package i18n
+
+import (
+	"math"
+	"strings"
+)
+
+// Plural categories as defined by CLDR
+const (
+	Zero  = "zero"
+	One   = "one"
+	Two   = "two"
+	Few   = "few"
+	Many  = "many"
+	Other = "other"
+)
+
+// PluralRule returns the CLDR cardinal plural category of n
+type PluralRule func(n float64) string
+
+type pluralRules struct {
+	rule       PluralRule
+	categories []string
+}
+
+var plurals = map[string]pluralRules{
+	"en": {oneIfExactlyOne, []string{One, Other}},
+	"de": {oneIfExactlyOne, []string{One, Other}},
+	"nl": {oneIfExactlyOne, []string{One, Other}},
+	"sv": {oneIfExactlyOne, []string{One, Other}},
+	"it": {oneIfExactlyOne, []string{One, Other}},
+	"es": {oneIfExactlyOne, []string{One, Other}},
+	"fr": {oneIfZeroOrOne, []string{One, Other}},
+	"pt": {oneIfZeroOrOne, []string{One, Other}},
+	"ru": {east, []string{One, Few, Many, Other}},
+	"uk": {east, []string{One, Few, Many, Other}},
+	"pl": {polish, []string{One, Few, Many, Other}},
+	"ja": {always, []string{Other}},
+	"zh": {always, []string{Other}},
+}
+
+// Plural returns the plural rule and the ordered categories used by a locale tag,
+// falling back to the language and finally to the English rule.
+func Plural(tag string) (rule PluralRule, categories []string) {
+	for tag != "" {
+		if p, ok := plurals[tag]; ok {
+			return p.rule, p.categories
+		}
+		i := strings.LastIndex(tag, "-")
+		if i < 0 {
+			break
+		}
+		tag = tag[:i]
+	}
+	p := plurals["en"]
+	return p.rule, p.categories
+}
+
+// integer returns the integer digits of n and whether n has visible fraction digits
+func integer(n float64) (i int64, fraction bool) {
+	n = math.Abs(n)
+	return int64(n), n != math.Trunc(n)
+}
+
+func oneIfExactlyOne(n float64) string {
+	if i, fraction := integer(n); i == 1 && !fraction {
+		return One
+	}
+	return Other
+}
+
+func oneIfZeroOrOne(n float64) string {
+	if i, _ := integer(n); i == 0 || i == 1 {
+		return One
+	}
+	return Other
+}
+
+func east(n float64) string {
+	i, fraction := integer(n)
+	if fraction {
+		return Other
+	}
+	mod10, mod100 := i%10, i%100
+	switch {
+	case mod10 == 1 && mod100 != 11:
+		return One
+	case mod10 >= 2 && mod10 <= 4 && (mod100 < 12 || mod100 > 14):
+		return Few
+	default:
+		return Many
+	}
+}
+
+func polish(n float64) string {
+	i, fraction := integer(n)
+	if fraction {
+		return Other
+	}
+	mod10, mod100 := i%10, i%100
+	switch {
+	case i == 1:
+		return One
+	case mod10 >= 2 && mod10 <= 4 && (mod100 < 12 || mod100 > 14):
+		return Few
+	default:
+		return Many
+	}
+}
+
+func always(float64) string {
+	return Other
+}
@@ -0,0 +1,51 @@
+package i18n
+
+import (
+	"testing"
+
+	"github.com/mlctrez/mystace/internal/testify"
+)
+
+func TestPlural(t *testing.T) {
+	_, require := testify.New(t)
+
+	tests := []struct {
+		tag      string
+		n        float64
+		expected string
+	}{
+		{"en", 0, Other},
+		{"en", 1, One},
+		{"en", 1.5, Other},
+		{"en", 2, Other},
+		{"en-GB", 1, One},
+		{"fr", 0, One},
+		{"fr", 1.5, One},
+		{"fr", 2, Other},
+		{"pt-BR", 0, One},
+		{"ru", 1, One},
+		{"ru", 11, Many},
+		{"ru", 21, One},
+		{"ru", 3, Few},
+		{"ru", 13, Many},
+		{"ru", 5, Many},
+		{"ru", 1.5, Other},
+		{"pl", 1, One},
+		{"pl", 21, Many},
+		{"pl", 22, Few},
+		{"pl", 12, Many},
+		{"pl", 0.5, Other},
+		{"ja", 1, Other},
+		{"xx", 1, One},
+	}
+
+	for _, test := range tests {
+		rule, _ := Plural(test.tag)
+		require.Equal(test.expected, rule(test.n), "%s %v", test.tag, test.n)
+	}
+
+	_, categories := Plural("ru")
+	require.Equal([]string{One, Few, Many, Other}, categories)
+	_, categories = Plural("")
+	require.Equal([]string{One, Other}, categories)
+}
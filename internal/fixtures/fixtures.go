@@ -0,0 +1,60 @@
+// Package fixtures holds data types shared by tests that need a named Go type,
+// such as generated code and type checks.
+package fixtures
+
+import "time"
+
+type Invoice struct {
+	Number   int64     `json:"number"`
+	Issued   time.Time `json:"issued"`
+	Customer *Customer `json:"customer"`
+	Lines    []Line    `json:"lines"`
+	Notes    []string  `json:"notes"`
+	Paid     bool      `json:"paid"`
+	Total    float64   `json:"total"`
+	Discount *float64  `json:"discount"`
+	Memo     string    `mystace:"memo" json:"-"`
+	Audit
+}
+
+type Audit struct {
+	Author string `json:"author"`
+}
+
+type Customer struct {
+	Name    string   `json:"name"`
+	Email   string   `json:"email"`
+	Address *Address `json:"address"`
+}
+
+type Address struct {
+	City string `json:"city"`
+}
+
+type Line struct {
+	Item     string  `json:"item"`
+	Quantity uint    `json:"quantity"`
+	Price    float64 `json:"price"`
+	Tax      *Tax    `json:"tax"`
+}
+
+type Tax struct {
+	Rate float64 `json:"rate"`
+}
+
+// SampleInvoice returns an invoice using every field
+func SampleInvoice() *Invoice {
+	return &Invoice{
+		Number:   1042,
+		Issued:   time.Date(2022, 5, 13, 9, 30, 0, 0, time.UTC),
+		Customer: &Customer{Name: "Ana <Ltd>", Email: "ana@example.com"},
+		Lines: []Line{
+			{Item: "Widget", Quantity: 2, Price: 12.5, Tax: &Tax{Rate: 0.2}},
+			{Item: "Gadget & Co", Quantity: 1, Price: 1234.5},
+		},
+		Notes: []string{"fragile"},
+		Total: 1259.5,
+		Memo:  "net 30",
+		Audit: Audit{Author: "ops"},
+	}
+}
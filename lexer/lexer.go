@@ -8,12 +8,15 @@ import (
 )
 
 var (
-	ErrMissingEndToken  = fmt.Errorf("missing end token }}")
-	ErrMaxLoopsExceeded = fmt.Errorf("max loops exceeded")
+	ErrMissingEndToken   = fmt.Errorf("missing end token }}")
+	ErrMaxLoopsExceeded  = fmt.Errorf("max loops exceeded")
+	ErrInvalidDelimiters = fmt.Errorf("invalid delimiters")
 )
 
 const (
 	DefaultMaxLoops = 500
+	OpenDelimiter   = "{{"
+	CloseDelimiter  = "}}"
 )
 
 type Lexer interface {
@@ -23,21 +26,31 @@ type Lexer interface {
 type lexer struct {
 	source   source.Source
 	maxLoops int
+	open     string
+	close    string
+	// err is the first error returned by an option
+	err error
 }
 
 func New(source source.Source, options ...Option) Lexer {
-	l := &lexer{source: source}
+	l := &lexer{source: source, open: OpenDelimiter, close: CloseDelimiter}
 	for _, option := range options {
-		option(l)
+		if err := option(l); err != nil && l.err == nil {
+			l.err = err
+		}
 	}
 	return l
 }
 
 func (l *lexer) Parse() (tokens []Token, err error) {
 
+	if l.err != nil {
+		return nil, l.err
+	}
 	if l.maxLoops == 0 {
 		l.maxLoops = DefaultMaxLoops
 	}
+	custom := l.open != OpenDelimiter || l.close != CloseDelimiter
 
 	loops := 0
 	for {
@@ -51,23 +64,31 @@ func (l *lexer) Parse() (tokens []Token, err error) {
 			break
 		}
 
-		if start := strings.Index(peek.Str, "{{"); start > 0 {
+		if start := strings.Index(peek.Str, l.open); start > 0 {
 			tokens = append(tokens, Token{Data: l.source.Read(start)})
 			continue
 		}
-		if start := strings.Index(peek.Str, "{{"); start == 0 {
-			end := strings.Index(peek.Str, "}}")
+		if start := strings.Index(peek.Str, l.open); start == 0 {
+			end := strings.Index(peek.Str[len(l.open):], l.close)
 			if end == -1 {
 				err = ErrMissingEndToken
 				return
 			}
-			if len(peek.Str) > end+2 && peek.Str[end:end+3] == "}}}" {
+			end += len(l.open)
+			if !custom && len(peek.Str) > end+2 && peek.Str[end:end+3] == "}}}" {
 				end++
 			}
-			tokens = append(tokens, Token{Data: l.source.Read(end + 2)})
+			token := Token{Kind: TagKind, Data: l.source.Read(end + len(l.close))}
+			if custom {
+				// tokens always use the default delimiters, the range locates the tag in the source
+				token.Written = token.Data.Str
+				inner := strings.TrimSuffix(strings.TrimPrefix(token.Data.Str, l.open), l.close)
+				token.Data.Str = OpenDelimiter + inner + CloseDelimiter
+			}
+			tokens = append(tokens, token)
 			continue
 		}
-		if start := strings.Index(peek.Str, "{{"); start < 0 {
+		if start := strings.Index(peek.Str, l.open); start < 0 {
 			tokens = append(tokens, Token{Data: l.source.Read(len(peek.Str))})
 		}
 
@@ -84,3 +105,17 @@ func WithMaxLoops(maxLoops int) Option {
 		return nil
 	}
 }
+
+// WithDelimiters replaces the {{ and }} tag delimiters, for templates of languages using braces.
+// Tokens still hold the tag with the default delimiters, so {{{name}}} becomes open{name}close.
+func WithDelimiters(open, close string) Option {
+	return func(s *lexer) error {
+		for _, d := range []string{open, close} {
+			if d == "" || strings.ContainsAny(d, " \t\r\n=") {
+				return fmt.Errorf("%q %q : %w", open, close, ErrInvalidDelimiters)
+			}
+		}
+		s.open, s.close = open, close
+		return nil
+	}
+}
@@ -64,3 +64,45 @@ func TestWithMaxLoops(t *testing.T) {
 	require.ErrorIs(ErrMaxLoopsExceeded, err)
 
 }
+
+func TestWithDelimiters(t *testing.T) {
+	_, require := testify.New(t)
+
+	src, err := source.FromString("a <%name%> {{b}} <%{raw}%>\n<%#s%>x<%/s%>")
+	require.Nil(err)
+
+	tokens, err := New(src, WithDelimiters("<%", "%>")).Parse()
+	require.Nil(err)
+	require.Len(tokens, 8)
+	require.Equal("{{name}}", tokens[1].Data.Str)
+	require.Equal(3, tokens[1].Data.Range.Start.Column)
+	require.Equal(" {{b}} ", tokens[2].Data.Str)
+	require.True(tokens[3].IsThreeBracket())
+	require.Equal("{{#s}}", tokens[5].Data.Str)
+	require.Equal(2, tokens[5].Line())
+
+	// text right after a tag is never a tag, although it starts with the default delimiter
+	src, err = source.FromString("<%name%>{{not}}{{{raw}}}")
+	require.Nil(err)
+	tokens, err = New(src, WithDelimiters("<%", "%>")).Parse()
+	require.Nil(err)
+	require.Len(tokens, 2)
+	require.True(tokens[0].IsTwoBracket())
+	require.True(tokens[1].IsChar())
+	require.False(tokens[1].IsThreeBracket())
+	_, value := tokens[1].Value()
+	require.Equal("{{not}}{{{raw}}}", value)
+	require.Equal("{{name}}", tokens[0].Data.Str)
+	require.Equal("<%name%>", tokens[0].Written)
+	require.Equal("<%name%>{{not}}{{{raw}}}", RawText(tokens))
+
+	src, err = source.FromString("<%name")
+	require.Nil(err)
+	_, err = New(src, WithDelimiters("<%", "%>")).Parse()
+	require.ErrorIs(err, ErrMissingEndToken)
+
+	for _, delimiters := range [][2]string{{"", "%>"}, {"<%", "% >"}, {"=", "="}} {
+		_, err = New(src, WithDelimiters(delimiters[0], delimiters[1])).Parse()
+		require.ErrorIs(err, ErrInvalidDelimiters)
+	}
+}
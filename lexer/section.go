@@ -0,0 +1,82 @@
+package lexer
+
+import "strings"
+
+// TrimStandalone returns the text of the char token tokens[current] as rendered: the newline
+// following and the spaces preceding a comment or section tag on another line are removed
+func TrimStandalone(tokens []Token, current int) string {
+	_, value := tokens[current].Value()
+	if canRemoveWhitespace(tokens, current, current-1) && strings.HasPrefix(value, "\n") {
+		value = strings.TrimPrefix(value, "\n")
+	}
+	if canRemoveWhitespace(tokens, current, current+1) && strings.HasSuffix(value, " ") {
+		value = strings.TrimRight(value, " ")
+	}
+	return value
+}
+
+// canRemoveWhitespace determins if a comment exists at position <at> is on a different line
+func canRemoveWhitespace(tokens []Token, current int, at int) bool {
+	currentToken := tokens[current]
+	if at > -1 && at < len(tokens) {
+		maybe := tokens[at]
+		mods, _ := maybe.Value()
+		if mods.HasModifier(CommentModifier, HashModifier) {
+			if maybe.Line() != currentToken.Line() {
+				return true
+			}
+			_, value := currentToken.Value()
+			if current > at {
+				return len(value) > 1 && strings.HasPrefix(value, "\n")
+			}
+			return strings.TrimSpace(value) == ""
+		}
+	}
+	return false
+}
+
+// CloseOf returns the index of the tag closing the section opened at tokens[open], or -1
+// when the section is not closed
+func CloseOf(tokens []Token, open int) int {
+	_, value := tokens[open].Value()
+	openModifiers := 1
+	for j := open + 1; j < len(tokens); j++ {
+		aheadMods, aheadValue := tokens[j].Value()
+		if aheadMods.HasModifier(HashModifier, InvertedModifier) {
+			openModifiers++
+		}
+		if aheadMods.HasModifier(CloseModifier) {
+			openModifiers--
+			if openModifiers == 0 && aheadValue == value {
+				return j
+			}
+		}
+	}
+	return -1
+}
+
+// SectionBody returns the tokens between the section tags tokens[open] and tokens[end],
+// without a newline following the open tag or preceding the close tag
+func SectionBody(tokens []Token, open, end int) []Token {
+	nested := tokens[open+1 : end]
+	if len(nested) > 0 && nested[0].Data.Str == "\n" {
+		nested = nested[1:]
+	}
+	if len(nested) > 2 && nested[len(nested)-1].Data.Str == "\n" {
+		nested = nested[:len(nested)-1]
+	}
+	return nested
+}
+
+// RawText joins the unrendered text of tokens as written, as passed to the lambda of a section
+func RawText(tokens []Token) string {
+	var text strings.Builder
+	for _, t := range tokens {
+		if t.Written != "" {
+			text.WriteString(t.Written)
+		} else {
+			text.WriteString(t.Data.Str)
+		}
+	}
+	return text.String()
+}
@@ -0,0 +1,70 @@
+package lexer
+
+import (
+	"testing"
+
+	"github.com/mlctrez/mystace/internal/testify"
+	"github.com/mlctrez/mystace/source"
+)
+
+func parseString(t *testing.T, template string) []Token {
+	src, err := source.FromString(template)
+	testify.Require(t).Nil(err)
+	tokens, err := New(src).Parse()
+	testify.Require(t).Nil(err)
+	return tokens
+}
+
+func Test_canRemoveWhitespace(t *testing.T) {
+	require := testify.Require(t)
+
+	tokens := parseString(t, `some data{{!comment}}other data
+more data
+{{!comment}}
+more more data
+`)
+
+	// out of range should not blow up
+	require.False(canRemoveWhitespace(tokens, 1, -1))
+	require.False(canRemoveWhitespace(tokens, 1, 10))
+
+	// comments on same line should not be treated as whitespace removal
+	require.False(canRemoveWhitespace(tokens, 0, 1))
+	require.False(canRemoveWhitespace(tokens, 2, 1))
+
+	// comment on different line
+	require.True(canRemoveWhitespace(tokens, 2, 3))
+	require.True(canRemoveWhitespace(tokens, 4, 3))
+
+	// comparison with non comments
+	require.False(canRemoveWhitespace(tokens, 0, 0))
+}
+
+func TestTrimStandalone(t *testing.T) {
+	require := testify.Require(t)
+
+	tokens := parseString(t, "a\n  {{#s}}\nb {{/s}} c")
+	require.Equal("a\n", TrimStandalone(tokens, 0))
+	require.Equal("b ", TrimStandalone(tokens, 2))
+	require.Equal(" c", TrimStandalone(tokens, 4))
+}
+
+func TestCloseOf(t *testing.T) {
+	require := testify.Require(t)
+
+	tokens := parseString(t, "{{#a}}{{#a}}x{{/a}}{{^b}}{{/b}}{{/a}}{{#c}}")
+	require.Equal(6, CloseOf(tokens, 0))
+	require.Equal(3, CloseOf(tokens, 1))
+	require.Equal(5, CloseOf(tokens, 4))
+	require.Equal(-1, CloseOf(tokens, 7))
+}
+
+func TestSectionBody(t *testing.T) {
+	require := testify.Require(t)
+
+	tokens := parseString(t, "{{#a}}\n{{x}} {{y}}\n{{/a}}")
+	require.Equal("{{x}} {{y}}", RawText(SectionBody(tokens, 0, CloseOf(tokens, 0))))
+
+	tokens = parseString(t, "{{#a}}{{b}} {{c}}{{/a}}")
+	require.Equal("{{b}} {{c}}", RawText(SectionBody(tokens, 0, 4)))
+}
@@ -7,8 +7,21 @@ import (
 	"github.com/mlctrez/mystace/source"
 )
 
+// Kind tells template text from tags, text is never read as a tag even when it holds {{
+type Kind int
+
+const (
+	// CharKind is template text
+	CharKind Kind = iota
+	// TagKind is a tag, held with the default delimiters
+	TagKind
+)
+
 type Token struct {
+	Kind Kind
 	Data source.Data
+	// Written is the tag as written in the source when it uses custom delimiters
+	Written string
 }
 
 func (t Token) Line() int {
@@ -16,15 +29,15 @@ func (t Token) Line() int {
 }
 
 func (t Token) IsChar() bool {
-	return !strings.HasPrefix(t.Data.Str, "{{")
+	return t.Kind == CharKind
 }
 
 func (t Token) IsTwoBracket() bool {
-	return strings.HasPrefix(t.Data.Str, "{{") && !t.IsThreeBracket()
+	return t.Kind == TagKind && !t.IsThreeBracket()
 }
 
 func (t Token) IsThreeBracket() bool {
-	return strings.HasPrefix(t.Data.Str, "{{{")
+	return t.Kind == TagKind && strings.HasPrefix(t.Data.Str, "{{{")
 }
 
 func (t Token) String() string {
@@ -55,6 +68,18 @@ func (t Token) Value() (mods Modifiers, value string) {
 	return
 }
 
+// After returns the location following the last of tokens, where lexing stopped
+func After(tokens []Token) source.Location {
+	if len(tokens) == 0 {
+		return source.Location{Line: 1, Column: 1}
+	}
+	last := tokens[len(tokens)-1].Data
+	if strings.HasSuffix(last.Str, "\n") {
+		return source.Location{Line: last.Range.End.Line + 1, Column: 1}
+	}
+	return source.Location{Line: last.Range.End.Line, Column: last.Range.End.Column + 1}
+}
+
 type Modifier string
 
 const (
@@ -65,6 +90,8 @@ const (
 	CloseModifier    Modifier = "/"
 	CommentModifier  Modifier = "!"
 	InvertedModifier Modifier = "^"
+	// TranslateModifier requires the trailing space so names like {{_private}} are not translated
+	TranslateModifier Modifier = "_ "
 )
 
 type Modifiers []Modifier
@@ -80,6 +107,19 @@ func (mods Modifiers) HasModifier(list ...Modifier) bool {
 	return false
 }
 
+// DynamicPrefix marks a partial named by a value of the context: {{>*name}}
+const DynamicPrefix = "*"
+
+// PartialName returns the name of a partial tag value and whether it is dynamic, the name
+// of a dynamic partial is the name of the context value holding the partial name
+func PartialName(value string) (name string, dynamic bool) {
+	name = strings.TrimSpace(value)
+	if strings.HasPrefix(name, DynamicPrefix) {
+		return strings.TrimSpace(strings.TrimPrefix(name, DynamicPrefix)), true
+	}
+	return name, false
+}
+
 var (
-	AllModifiers = []Modifier{HashModifier, AmpModifier, ImportModifier, TildeModifier, CloseModifier, CommentModifier, InvertedModifier}
+	AllModifiers = []Modifier{HashModifier, AmpModifier, ImportModifier, TildeModifier, CloseModifier, CommentModifier, InvertedModifier, TranslateModifier}
 )
@@ -1,13 +1,18 @@
 package lexer
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/mlctrez/mystace/internal/testify"
 	"github.com/mlctrez/mystace/source"
 )
 
+// makeToken reads s as a tag when it starts with the default delimiter, as the lexer does
 func makeToken(s string) Token {
+	if strings.HasPrefix(s, OpenDelimiter) {
+		return Token{Kind: TagKind, Data: source.Data{Str: s}}
+	}
 	return Token{Data: source.Data{Str: s}}
 }
 
@@ -25,6 +30,10 @@ func TestToken_IsChar(t *testing.T) {
 	require.True(makeToken("{a}").IsChar())
 	require.False(makeToken("{{a}}").IsChar())
 
+	// text is never a tag, whatever it holds
+	require.True(Token{Data: source.Data{Str: "{{a}}"}}.IsChar())
+	require.False(Token{Data: source.Data{Str: "{{{a}}}"}}.IsThreeBracket())
+
 }
 
 func TestToken_IsTwoBracket(t *testing.T) {
@@ -68,6 +77,15 @@ func TestToken_Value(t *testing.T) {
 	expectedMods = Modifiers{AmpModifier}
 	require.Equal(expectedMods, mods)
 
+	mods, v = makeToken("{{_ greeting}}").Value()
+	require.Equal("greeting", v)
+	expectedMods = Modifiers{TranslateModifier}
+	require.Equal(expectedMods, mods)
+
+	mods, v = makeToken("{{_private}}").Value()
+	require.Equal("_private", v)
+	require.Nil(mods)
+
 }
 
 func TestModifiers_HasModifier(t *testing.T) {
@@ -81,3 +99,15 @@ func TestModifiers_HasModifier(t *testing.T) {
 	require.False(Modifiers{HashModifier}.HasModifier(AmpModifier))
 
 }
+
+func TestPartialName(t *testing.T) {
+	require := testify.Require(t)
+
+	name, dynamic := PartialName(" card ")
+	require.Equal("card", name)
+	require.False(dynamic)
+
+	name, dynamic = PartialName("* widget.kind ")
+	require.Equal("widget.kind", name)
+	require.True(dynamic)
+}
@@ -0,0 +1,333 @@
+// Package lint reports problems in templates from the output of the lexer, so templates
+// that cannot be parsed are still analyzed. Each rule can be enabled or disabled.
+package lint
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/mlctrez/mystace/lexer"
+	"github.com/mlctrez/mystace/source"
+)
+
+var ErrUnknownRule = fmt.Errorf("unknown rule")
+
+// Severity is the importance of a problem
+type Severity string
+
+const (
+	SeverityError   Severity = "error"
+	SeverityWarning Severity = "warning"
+)
+
+// Rule names
+const (
+	RuleSyntax            = "syntax"
+	RuleUnclosedSection   = "unclosed-section"
+	RuleMismatchedSection = "mismatched-section"
+	RuleUnusedPartial     = "unused-partial"
+	RuleMissingPartial    = "missing-partial"
+	RuleShadowedName      = "shadowed-name"
+	RuleUnescapedHTML     = "unescaped-html"
+	RuleEmptySection      = "empty-section"
+	RuleUnknownModifier   = "unknown-modifier"
+)
+
+// Rule describes a check
+type Rule struct {
+	Name        string
+	Description string
+	Severity    Severity
+}
+
+// Rules are the checks of the linter, all enabled by default
+var Rules = []Rule{
+	{RuleSyntax, "the template cannot be read by the lexer", SeverityError},
+	{RuleUnclosedSection, "a section is never closed", SeverityError},
+	{RuleMismatchedSection, "a close tag does not match the innermost open section", SeverityError},
+	{RuleUnusedPartial, "a template is not included by the roots or the partials they include", SeverityWarning},
+	{RuleMissingPartial, "a partial tag names a template that does not exist", SeverityError},
+	{RuleShadowedName, "a section has the name of an enclosing section", SeverityWarning},
+	{RuleUnescapedHTML, "a {{{name}}} or {{&name}} tag writes a value unescaped in a template containing html", SeverityWarning},
+	{RuleEmptySection, "a section contains nothing but whitespace", SeverityWarning},
+	{RuleUnknownModifier, "a tag starts with a character that is not a modifier or part of a name", SeverityError},
+}
+
+func rule(name string) (Rule, bool) {
+	for _, r := range Rules {
+		if r.Name == name {
+			return r, true
+		}
+	}
+	return Rule{}, false
+}
+
+// Problem is a problem found by a rule
+type Problem struct {
+	Rule     string   `json:"rule"`
+	Severity Severity `json:"severity"`
+	// Source is the name of the template
+	Source  string       `json:"source"`
+	Range   source.Range `json:"range"`
+	Tag     string       `json:"tag,omitempty"`
+	Message string       `json:"message"`
+}
+
+func (p Problem) Error() string {
+	return fmt.Sprintf("%s:%d:%d: %s %s : %s", p.Source, p.Range.Start.Line, p.Range.Start.Column, p.Severity, p.Rule, p.Message)
+}
+
+type Option func(l *linter) error
+
+// WithRules enables only the rules named
+func WithRules(names ...string) Option {
+	return func(l *linter) error {
+		l.enabled = map[string]bool{}
+		for _, name := range names {
+			if _, ok := rule(name); !ok {
+				return fmt.Errorf("%q : %w", name, ErrUnknownRule)
+			}
+			l.enabled[name] = true
+		}
+		return nil
+	}
+}
+
+// WithoutRules disables the rules named
+func WithoutRules(names ...string) Option {
+	return func(l *linter) error {
+		for _, name := range names {
+			if _, ok := rule(name); !ok {
+				return fmt.Errorf("%q : %w", name, ErrUnknownRule)
+			}
+			l.enabled[name] = false
+		}
+		return nil
+	}
+}
+
+// WithRoots names the templates rendered directly, enabling the unused-partial rule for the others
+func WithRoots(names ...string) Option {
+	return func(l *linter) error {
+		l.roots = append(l.roots, names...)
+		return nil
+	}
+}
+
+// WithLexerOptions reads the templates with options, such as lexer.WithDelimiters
+func WithLexerOptions(options ...lexer.Option) Option {
+	return func(l *linter) error {
+		l.lexerOptions = append(l.lexerOptions, options...)
+		return nil
+	}
+}
+
+type linter struct {
+	enabled      map[string]bool
+	roots        []string
+	lexerOptions []lexer.Option
+	problems     []Problem
+	// partials are the partial names included by each template
+	partials map[string][]string
+	// dynamic are the templates with partials named by context values
+	dynamic map[string]bool
+}
+
+// Lint checks the templates of sources, the names of sources are the names of partials.
+// Problems are sorted by source and position.
+func Lint(sources []source.Source, options ...Option) (problems []Problem, err error) {
+	l := &linter{enabled: map[string]bool{}, partials: map[string][]string{}, dynamic: map[string]bool{}}
+	for _, r := range Rules {
+		l.enabled[r.Name] = true
+	}
+	for _, option := range options {
+		if err = option(l); err != nil {
+			return
+		}
+	}
+	for _, src := range sources {
+		l.partials[src.Name()] = nil
+	}
+	for _, src := range sources {
+		l.template(src)
+	}
+	l.unused()
+	sort.SliceStable(l.problems, func(i, j int) bool {
+		a, b := l.problems[i], l.problems[j]
+		if a.Source != b.Source {
+			return a.Source < b.Source
+		}
+		if a.Range.Start.Line != b.Range.Start.Line {
+			return a.Range.Start.Line < b.Range.Start.Line
+		}
+		return a.Range.Start.Column < b.Range.Start.Column
+	})
+	return l.problems, nil
+}
+
+func (l *linter) report(ruleName, name string, token lexer.Token, format string, args ...interface{}) {
+	if !l.enabled[ruleName] {
+		return
+	}
+	r, _ := rule(ruleName)
+	l.problems = append(l.problems, Problem{Rule: ruleName, Severity: r.Severity, Source: name,
+		Range: token.Data.Range, Tag: token.Data.Str, Message: fmt.Sprintf(format, args...)})
+}
+
+// htmlTag matches the start of an html element, end tag, comment or doctype
+var htmlTag = regexp.MustCompile(`<[a-zA-Z/!]`)
+
+// open is a section waiting for its close tag
+type open struct {
+	name  string
+	token lexer.Token
+	index int
+}
+
+func (l *linter) template(src source.Source) {
+	name := src.Name()
+	tokens, err := lexer.New(src, l.lexerOptions...).Parse()
+	if err != nil {
+		at := lexer.After(tokens)
+		l.report(RuleSyntax, name, lexer.Token{Data: source.Data{Range: source.Range{Start: at, End: at}}}, "%s", err)
+		return
+	}
+
+	var html bool
+	var unescaped []lexer.Token
+	var stack []open
+	for i, token := range tokens {
+		if token.IsChar() {
+			html = html || htmlTag.MatchString(token.Data.Str)
+			continue
+		}
+		mods, value := token.Value()
+		if mods.HasModifier(lexer.CommentModifier) {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		if mods.HasModifier(lexer.ImportModifier) {
+			var dynamic bool
+			if value, dynamic = lexer.PartialName(value); dynamic {
+				// the partial is only known when rendering
+				l.dynamic[name] = true
+				continue
+			}
+		}
+		if r := firstRune(value); r != 0 && !isNameRune(r) {
+			l.report(RuleUnknownModifier, name, token, "unknown modifier %q", r)
+			continue
+		}
+		switch {
+		case token.IsThreeBracket() || mods.HasModifier(lexer.AmpModifier):
+			unescaped = append(unescaped, token)
+		case mods.HasModifier(lexer.ImportModifier):
+			l.partials[name] = append(l.partials[name], value)
+			if _, ok := l.partials[value]; !ok {
+				l.report(RuleMissingPartial, name, token, "partial %q not found", value)
+			}
+		case mods.HasModifier(lexer.HashModifier, lexer.InvertedModifier):
+			for _, o := range stack {
+				if o.name == value {
+					l.report(RuleShadowedName, name, token, "section %q is inside a section of the same name at %d:%d",
+						value, o.token.Data.Range.Start.Line, o.token.Data.Range.Start.Column)
+					break
+				}
+			}
+			stack = append(stack, open{name: value, token: token, index: i})
+		case mods.HasModifier(lexer.CloseModifier):
+			stack = l.close(name, tokens, i, value, stack)
+		}
+	}
+	for _, o := range stack {
+		l.report(RuleUnclosedSection, name, o.token, "section %q is not closed", o.name)
+	}
+	if html {
+		for _, token := range unescaped {
+			l.report(RuleUnescapedHTML, name, token, "value written without html escaping")
+		}
+	}
+}
+
+// close matches the close tag tokens[i] with the open sections of stack, returning the sections still open
+func (l *linter) close(name string, tokens []lexer.Token, i int, value string, stack []open) []open {
+	token := tokens[i]
+	match := -1
+	for s := len(stack) - 1; s >= 0; s-- {
+		if stack[s].name == value {
+			match = s
+			break
+		}
+	}
+	switch {
+	case match == -1:
+		l.report(RuleMismatchedSection, name, token, "no open section %q", value)
+		return stack
+	case match != len(stack)-1:
+		l.report(RuleMismatchedSection, name, token, "closes %q while %q is open", value, stack[len(stack)-1].name)
+		for _, o := range stack[match+1:] {
+			l.report(RuleUnclosedSection, name, o.token, "section %q is not closed", o.name)
+		}
+	}
+	o := stack[match]
+	empty := true
+	for _, t := range tokens[o.index+1 : i] {
+		if !t.IsChar() || strings.TrimSpace(t.Data.Str) != "" {
+			empty = false
+			break
+		}
+	}
+	if empty {
+		l.report(RuleEmptySection, name, o.token, "section %q is empty", o.name)
+	}
+	return stack[:match]
+}
+
+// unused reports the templates not reachable from the roots
+func (l *linter) unused() {
+	if len(l.roots) == 0 {
+		return
+	}
+	used := map[string]bool{}
+	var visit func(name string)
+	visit = func(name string) {
+		if used[name] {
+			return
+		}
+		used[name] = true
+		for _, p := range l.partials[name] {
+			visit(p)
+		}
+	}
+	for _, root := range l.roots {
+		visit(root)
+	}
+	for name := range used {
+		if l.dynamic[name] {
+			// any template may be included by a dynamic partial
+			return
+		}
+	}
+	for name := range l.partials {
+		if !used[name] {
+			start := source.Location{Line: 1, Column: 1}
+			l.report(RuleUnusedPartial, name, lexer.Token{Data: source.Data{Range: source.Range{Start: start, End: start}}},
+				"template %q is not used by %s", name, strings.Join(l.roots, ", "))
+		}
+	}
+}
+
+func firstRune(s string) rune {
+	for _, r := range s {
+		return r
+	}
+	return 0
+}
+
+// isNameRune reports whether r can start a name, including . and ../
+func isNameRune(r rune) bool {
+	return r == '_' || r == '.' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
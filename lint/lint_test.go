@@ -0,0 +1,80 @@
+package lint
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/mlctrez/mystace/internal/testify"
+	"github.com/mlctrez/mystace/lexer"
+	"github.com/mlctrez/mystace/source"
+)
+
+// sources creates sources from pairs of name and template
+func sources(t *testing.T, templates ...string) (srcs []source.Source) {
+	for i := 0; i < len(templates); i += 2 {
+		src, err := source.FromString(templates[i+1], source.WithName(templates[i]))
+		testify.Require(t).Nil(err)
+		srcs = append(srcs, src)
+	}
+	return
+}
+
+// found formats problems as source:line:column rule
+func found(problems []Problem) (result []string) {
+	for _, p := range problems {
+		result = append(result, fmt.Sprintf("%s:%d:%d %s", p.Source, p.Range.Start.Line, p.Range.Start.Column, p.Rule))
+	}
+	return
+}
+
+func TestLint(t *testing.T) {
+	_, require := testify.New(t)
+
+	problems, err := Lint(sources(t,
+		"page", "<ul>\n{{#items}}{{#items}}{{{name}}}{{/items}}{{/items}}\n{{#empty}} \n{{/empty}}{{> card}}{{> missing}}</ul>",
+		"card", "{{&name}} {{! <p> }}{{%name}} {{_ key}} {{../name}}",
+		"broken", "{{#a}}{{#b}}{{/a}}{{/c}}{{#d}}",
+		"unreadable", "text\n{{name",
+	))
+	require.Nil(err)
+	require.Equal([]string{
+		"broken:1:7 unclosed-section",
+		"broken:1:13 mismatched-section",
+		"broken:1:19 mismatched-section",
+		"broken:1:25 unclosed-section",
+		"card:1:21 unknown-modifier",
+		"page:2:11 shadowed-name",
+		"page:2:21 unescaped-html",
+		"page:3:1 empty-section",
+		"page:4:21 missing-partial",
+		"unreadable:2:1 syntax",
+	}, found(problems))
+	require.Equal(SeverityWarning, problems[5].Severity)
+	require.Equal("{{#items}}", problems[5].Tag)
+	require.Equal(`page:2:11: warning shadowed-name : section "items" is inside a section of the same name at 2:1`, problems[5].Error())
+	require.Equal(`closes "a" while "b" is open`, problems[1].Message)
+	require.Equal("missing end token }}", problems[9].Message)
+
+	problems, err = Lint(sources(t, "page", "{{> card}}", "card", "{{> row}}", "row", "", "orphan", "{{#a}}{{/a}}"),
+		WithRoots("page"), WithoutRules(RuleEmptySection))
+	require.Nil(err)
+	require.Equal([]string{"orphan:1:1 unused-partial"}, found(problems))
+
+	// a dynamic partial may include any template
+	problems, err = Lint(sources(t, "page", "{{>*widget}}", "chart", ""), WithRoots("page"))
+	require.Nil(err)
+	require.Empty(problems)
+
+	problems, err = Lint(sources(t, "page", "<p>{{{a}}}{{#b}}{{/b}}</p>"), WithRules(RuleUnescapedHTML))
+	require.Nil(err)
+	require.Equal([]string{"page:1:4 unescaped-html"}, found(problems))
+
+	problems, err = Lint(sources(t, "page", "{{{a}}} <%#b%><%/b%>"), WithLexerOptions(lexer.WithDelimiters("<%", "%>")))
+	require.Nil(err)
+	require.Equal([]string{"page:1:9 empty-section"}, found(problems))
+
+	_, err = Lint(nil, WithRules("nope"))
+	require.ErrorIs(err, ErrUnknownRule)
+	_, err = Lint(nil, WithoutRules("nope"))
+	require.ErrorIs(err, ErrUnknownRule)
+}
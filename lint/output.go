@@ -0,0 +1,126 @@
+package lint
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// WriteText writes one line per problem
+func WriteText(w io.Writer, problems []Problem) error {
+	for _, p := range problems {
+		if _, err := fmt.Fprintln(w, p.Error()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteJSON writes the problems as a json array
+func WriteJSON(w io.Writer, problems []Problem) error {
+	if problems == nil {
+		problems = []Problem{}
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(problems)
+}
+
+// SARIFVersion is the version of the Static Analysis Results Interchange Format written by WriteSARIF
+const SARIFVersion = "2.1.0"
+
+const sarifSchema = "https://json.schemastore.org/sarif-2.1.0.json"
+
+type sarifLog struct {
+	Version string     `json:"version"`
+	Schema  string     `json:"$schema"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID               string       `json:"id"`
+	ShortDescription sarifMessage `json:"shortDescription"`
+	DefaultConfig    sarifConfig  `json:"defaultConfiguration"`
+}
+
+type sarifConfig struct {
+	Level Severity `json:"level"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID    string          `json:"ruleId"`
+	Level     Severity        `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifact `json:"artifactLocation"`
+	Region           sarifRegion   `json:"region"`
+}
+
+type sarifArtifact struct {
+	URI string `json:"uri"`
+}
+
+// sarifRegion columns are 1 based, the end column is the one after the region
+type sarifRegion struct {
+	StartLine   int `json:"startLine"`
+	StartColumn int `json:"startColumn"`
+	EndLine     int `json:"endLine,omitempty"`
+	EndColumn   int `json:"endColumn,omitempty"`
+}
+
+// WriteSARIF writes the problems as a SARIF log for code scanning tools, the source
+// names of the problems are the artifact uris
+func WriteSARIF(w io.Writer, problems []Problem) error {
+	run := sarifRun{
+		Tool:    sarifTool{Driver: sarifDriver{Name: "mystace", InformationURI: "https://github.com/mlctrez/mystace"}},
+		Results: []sarifResult{},
+	}
+	for _, r := range Rules {
+		run.Tool.Driver.Rules = append(run.Tool.Driver.Rules, sarifRule{
+			ID: r.Name, ShortDescription: sarifMessage{Text: r.Description}, DefaultConfig: sarifConfig{Level: r.Severity}})
+	}
+	for _, p := range problems {
+		region := sarifRegion{StartLine: p.Range.Start.Line, StartColumn: p.Range.Start.Column}
+		if p.Range.End.Line > 0 {
+			region.EndLine, region.EndColumn = p.Range.End.Line, p.Range.End.Column+1
+		}
+		run.Results = append(run.Results, sarifResult{
+			RuleID:  p.Rule,
+			Level:   p.Severity,
+			Message: sarifMessage{Text: p.Message},
+			Locations: []sarifLocation{{PhysicalLocation: sarifPhysicalLocation{
+				ArtifactLocation: sarifArtifact{URI: p.Source},
+				Region:           region,
+			}}},
+		})
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(sarifLog{Version: SARIFVersion, Schema: sarifSchema, Runs: []sarifRun{run}})
+}
@@ -0,0 +1,60 @@
+package lint
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/mlctrez/mystace/internal/testify"
+	"github.com/mlctrez/mystace/source"
+)
+
+var outputProblems = []Problem{{
+	Rule: RuleEmptySection, Severity: SeverityWarning, Source: "templates/page.mustache", Tag: "{{#a}}",
+	Range:   source.Range{Start: source.Location{Line: 2, Column: 3}, End: source.Location{Line: 2, Column: 8}},
+	Message: `section "a" is empty`,
+}}
+
+func TestWriteText(t *testing.T) {
+	_, require := testify.New(t)
+	buf := &bytes.Buffer{}
+	require.Nil(WriteText(buf, outputProblems))
+	require.Equal("templates/page.mustache:2:3: warning empty-section : section \"a\" is empty\n", buf.String())
+}
+
+func TestWriteJSON(t *testing.T) {
+	_, require := testify.New(t)
+	buf := &bytes.Buffer{}
+	require.Nil(WriteJSON(buf, nil))
+	require.Equal("[]\n", buf.String())
+
+	buf.Reset()
+	require.Nil(WriteJSON(buf, outputProblems))
+	var decoded []Problem
+	require.Nil(json.Unmarshal(buf.Bytes(), &decoded))
+	require.Equal(outputProblems, decoded)
+	require.Contains(buf.String(), `"rule": "empty-section"`)
+}
+
+func TestWriteSARIF(t *testing.T) {
+	_, require := testify.New(t)
+	buf := &bytes.Buffer{}
+	require.Nil(WriteSARIF(buf, outputProblems))
+
+	var log sarifLog
+	require.Nil(json.Unmarshal(buf.Bytes(), &log))
+	require.Equal(SARIFVersion, log.Version)
+	require.Len(log.Runs, 1)
+	require.Len(log.Runs[0].Tool.Driver.Rules, len(Rules))
+	require.Len(log.Runs[0].Results, 1)
+	result := log.Runs[0].Results[0]
+	require.Equal(RuleEmptySection, result.RuleID)
+	require.Equal(SeverityWarning, result.Level)
+	location := result.Locations[0].PhysicalLocation
+	require.Equal("templates/page.mustache", location.ArtifactLocation.URI)
+	require.Equal(sarifRegion{StartLine: 2, StartColumn: 3, EndLine: 2, EndColumn: 9}, location.Region)
+
+	buf.Reset()
+	require.Nil(WriteSARIF(buf, nil))
+	require.Contains(buf.String(), `"results": []`)
+}
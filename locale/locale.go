@@ -0,0 +1,218 @@
+package locale
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+var ErrUnknownLocale = fmt.Errorf("unknown locale")
+
+// Locale holds the CLDR number, currency and date conventions for a language tag
+type Locale struct {
+	Tag     string
+	Decimal string
+	Group   string
+	// Grouping is the size of the first group left of the decimal separator
+	Grouping int
+	// SecondaryGrouping is the size of the remaining groups, zero when equal to Grouping
+	SecondaryGrouping int
+	// CurrencyFormat places the currency symbol ¤ relative to the number #
+	CurrencyFormat string
+	DateLayout     string
+	TimeLayout     string
+	DateTimeLayout string
+}
+
+const (
+	nbsp       = "\u00a0"
+	narrowNbsp = "\u202f"
+)
+
+var locales = map[string]Locale{
+	"en":    {"en", ".", ",", 3, 0, "¤#", "1/2/2006", "3:04 PM", "1/2/2006, 3:04 PM"},
+	"en-GB": {"en-GB", ".", ",", 3, 0, "¤#", "02/01/2006", "15:04", "02/01/2006, 15:04"},
+	"en-IN": {"en-IN", ".", ",", 3, 2, "¤#", "2/1/2006", "3:04 PM", "2/1/2006, 3:04 PM"},
+	"de":    {"de", ",", ".", 3, 0, "#" + nbsp + "¤", "02.01.2006", "15:04", "02.01.2006, 15:04"},
+	"de-CH": {"de-CH", ".", "’", 3, 0, "¤" + nbsp + "#", "02.01.2006", "15:04", "02.01.2006, 15:04"},
+	"fr":    {"fr", ",", narrowNbsp, 3, 0, "#" + nbsp + "¤", "02/01/2006", "15:04", "02/01/2006 15:04"},
+	"es":    {"es", ",", ".", 3, 0, "#" + nbsp + "¤", "2/1/2006", "15:04", "2/1/2006, 15:04"},
+	"it":    {"it", ",", ".", 3, 0, "#" + nbsp + "¤", "02/01/2006", "15:04", "02/01/2006, 15:04"},
+	"nl":    {"nl", ",", ".", 3, 0, "¤" + nbsp + "#", "2-1-2006", "15:04", "2-1-2006, 15:04"},
+	"pt":    {"pt", ",", ".", 3, 0, "¤" + nbsp + "#", "02/01/2006", "15:04", "02/01/2006, 15:04"},
+	"sv":    {"sv", ",", nbsp, 3, 0, "#" + nbsp + "¤", "2006-01-02", "15:04", "2006-01-02 15:04"},
+	"pl":    {"pl", ",", nbsp, 3, 0, "#" + nbsp + "¤", "02.01.2006", "15:04", "02.01.2006, 15:04"},
+	"ru":    {"ru", ",", nbsp, 3, 0, "#" + nbsp + "¤", "02.01.2006", "15:04", "02.01.2006, 15:04"},
+	"ja":    {"ja", ".", ",", 3, 0, "¤#", "2006/01/02", "15:04", "2006/01/02 15:04"},
+	"zh":    {"zh", ".", ",", 3, 0, "¤#", "2006/1/2", "15:04", "2006/1/2 15:04"},
+}
+
+// aliases map region tags onto the locale bundled for them
+var aliases = map[string]string{
+	"en-US": "en",
+	"pt-BR": "pt",
+}
+
+// Default is the locale used when no other locale is configured
+var Default = locales["en"]
+
+type currency struct {
+	symbol   string
+	decimals int
+}
+
+var currencies = map[string]currency{
+	"USD": {"$", 2},
+	"EUR": {"€", 2},
+	"GBP": {"£", 2},
+	"JPY": {"¥", 0},
+	"CNY": {"¥", 2},
+	"INR": {"₹", 2},
+	"CHF": {"CHF", 2},
+	"BRL": {"R$", 2},
+	"SEK": {"kr", 2},
+	"PLN": {"zł", 2},
+	"RUB": {"₽", 2},
+}
+
+// Lookup returns the locale for a BCP 47 tag such as "de" or "en-GB",
+// falling back to the language when the region is not bundled.
+func Lookup(name string) (l Locale, err error) {
+	tag := strings.ReplaceAll(strings.TrimSpace(name), "_", "-")
+	for tag != "" {
+		key := tag
+		if alias, ok := aliases[key]; ok {
+			key = alias
+		}
+		var ok bool
+		if l, ok = locales[key]; ok {
+			return
+		}
+		if i := strings.LastIndex(tag, "-"); i > 0 {
+			tag = tag[:i]
+			continue
+		}
+		break
+	}
+	err = fmt.Errorf("locale %q : %w", name, ErrUnknownLocale)
+	return
+}
+
+// Tags returns the tags of all bundled locales
+func Tags() (tags []string) {
+	for tag := range locales {
+		tags = append(tags, tag)
+	}
+	for tag := range aliases {
+		tags = append(tags, tag)
+	}
+	return
+}
+
+// FormatNumber formats f with the locale separators. When decimals is negative,
+// two decimals are shown unless the fraction is zero. Numbers rounding to zero have
+// no sign, NaN and infinities are written NaN, ∞ and -∞.
+func (l Locale) FormatNumber(f float64, decimals int) string {
+	switch {
+	case math.IsNaN(f):
+		return "NaN"
+	case math.IsInf(f, 1):
+		return "∞"
+	case math.IsInf(f, -1):
+		return "-∞"
+	}
+	var s string
+	if decimals < 0 {
+		s = strings.TrimSuffix(strconv.FormatFloat(f, 'f', 2, 64), ".00")
+	} else {
+		s = strconv.FormatFloat(f, 'f', decimals, 64)
+	}
+
+	sign := ""
+	if strings.HasPrefix(s, "-") {
+		s = s[1:]
+		if strings.Trim(s, "0.") != "" {
+			sign = "-"
+		}
+	}
+	whole, fraction := s, ""
+	if i := strings.Index(s, "."); i >= 0 {
+		whole, fraction = s[:i], l.Decimal+s[i+1:]
+	}
+	return sign + l.group(whole) + fraction
+}
+
+// FormatInt formats i with the locale group separator
+func (l Locale) FormatInt(i int64) string {
+	if i < 0 {
+		return "-" + l.group(strconv.FormatUint(uint64(-(i+1))+1, 10))
+	}
+	return l.group(strconv.FormatInt(i, 10))
+}
+
+// FormatUint formats u with the locale group separator
+func (l Locale) FormatUint(u uint64) string {
+	return l.group(strconv.FormatUint(u, 10))
+}
+
+func (l Locale) group(whole string) string {
+	size := l.Grouping
+	if size < 1 || len(whole) <= size {
+		return whole
+	}
+	secondary := l.SecondaryGrouping
+	if secondary < 1 {
+		secondary = size
+	}
+	groups := []string{whole[len(whole)-size:]}
+	whole = whole[:len(whole)-size]
+	for len(whole) > secondary {
+		groups = append([]string{whole[len(whole)-secondary:]}, groups...)
+		whole = whole[:len(whole)-secondary]
+	}
+	groups = append([]string{whole}, groups...)
+	return strings.Join(groups, l.Group)
+}
+
+// FormatCurrency formats f as an amount in the ISO 4217 currency code
+func (l Locale) FormatCurrency(f float64, code string) string {
+	code = strings.ToUpper(code)
+	c, ok := currencies[code]
+	if !ok {
+		c = currency{symbol: code, decimals: 2}
+	}
+	number, sign := l.FormatNumber(f, c.decimals), ""
+	if strings.HasPrefix(number, "-") {
+		number, sign = number[1:], "-"
+	}
+	pattern := l.CurrencyFormat
+	if pattern == "" {
+		pattern = "¤#"
+	}
+	symbol := c.symbol
+	if last, _ := utf8.DecodeLastRuneInString(symbol); unicode.IsLetter(last) && strings.HasPrefix(pattern, "¤#") {
+		// alphabetic symbols are separated from the number: CHF 1,234.50
+		symbol += nbsp
+	}
+	formatted := strings.Replace(pattern, "#", number, 1)
+	return sign + strings.Replace(formatted, "¤", symbol, 1)
+}
+
+// FormatDate formats the date portion of t
+func (l Locale) FormatDate(t time.Time) string {
+	return t.Format(l.DateLayout)
+}
+
+// FormatTime formats the time portion of t
+func (l Locale) FormatTime(t time.Time) string {
+	return t.Format(l.TimeLayout)
+}
+
+// FormatDateTime formats both the date and time of t
+func (l Locale) FormatDateTime(t time.Time) string {
+	return t.Format(l.DateTimeLayout)
+}
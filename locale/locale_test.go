@@ -0,0 +1,149 @@
+package locale
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/mlctrez/mystace/internal/testify"
+)
+
+func TestLookup(t *testing.T) {
+	_, require := testify.New(t)
+
+	l, err := Lookup("de")
+	require.Nil(err)
+	require.Equal("de", l.Tag)
+
+	l, err = Lookup("de_AT")
+	require.Nil(err)
+	require.Equal("de", l.Tag)
+
+	l, err = Lookup("de-CH")
+	require.Nil(err)
+	require.Equal("de-CH", l.Tag)
+
+	l, err = Lookup("en-US")
+	require.Nil(err)
+	require.Equal("en", l.Tag)
+
+	l, err = Lookup("pt-BR")
+	require.Nil(err)
+	require.Equal("pt", l.Tag)
+
+	_, err = Lookup("xx-YY")
+	require.ErrorIs(err, ErrUnknownLocale)
+
+	_, err = Lookup("")
+	require.ErrorIs(err, ErrUnknownLocale)
+
+	for _, tag := range Tags() {
+		_, err = Lookup(tag)
+		require.Nil(err, tag)
+	}
+}
+
+func TestLocale_FormatNumber(t *testing.T) {
+	_, require := testify.New(t)
+
+	tests := []struct {
+		tag      string
+		value    float64
+		decimals int
+		expected string
+	}{
+		{"en", 1234567.891, -1, "1,234,567.89"},
+		{"en", 1234567, -1, "1,234,567"},
+		{"en", -1234.5, 1, "-1,234.5"},
+		{"en", 123, 2, "123.00"},
+		{"de", 1234567.891, -1, "1.234.567,89"},
+		{"de-CH", 1234567.891, -1, "1’234’567.89"},
+		{"fr", 1234567.891, -1, "1 234 567,89"},
+		{"ru", 1234.5, 2, "1 234,50"},
+		{"en-IN", 123456789.5, 2, "12,34,56,789.50"},
+		{"en-IN", 1234, 0, "1,234"},
+		{"ja", 1234567, 0, "1,234,567"},
+	}
+
+	for _, test := range tests {
+		l, err := Lookup(test.tag)
+		require.Nil(err)
+		require.Equal(test.expected, l.FormatNumber(test.value, test.decimals), test.tag)
+	}
+
+	require.Equal("1234567", Locale{Decimal: "."}.FormatNumber(1234567, 0))
+
+	en, err := Lookup("en")
+	require.Nil(err)
+	require.Equal("0.00", en.FormatNumber(-0.001, 2))
+	require.Equal("0", en.FormatNumber(-0.001, -1))
+	require.Equal("0", en.FormatNumber(math.Copysign(0, -1), 0))
+	require.Equal("-0.01", en.FormatNumber(-0.005001, 2))
+	require.Equal("NaN", en.FormatNumber(math.NaN(), 2))
+	require.Equal("∞", en.FormatNumber(math.Inf(1), 2))
+	require.Equal("-∞", en.FormatNumber(math.Inf(-1), -1))
+}
+
+func TestLocale_FormatInt(t *testing.T) {
+	_, require := testify.New(t)
+
+	de, err := Lookup("de")
+	require.Nil(err)
+	require.Equal("9.007.199.254.740.993", de.FormatInt(9007199254740993))
+	require.Equal("-9.223.372.036.854.775.808", de.FormatInt(math.MinInt64))
+	require.Equal("0", de.FormatInt(0))
+	require.Equal("18.446.744.073.709.551.615", de.FormatUint(math.MaxUint64))
+
+	in, err := Lookup("en-IN")
+	require.Nil(err)
+	require.Equal("-12,34,567", in.FormatInt(-1234567))
+}
+
+func TestLocale_FormatCurrency(t *testing.T) {
+	_, require := testify.New(t)
+
+	tests := []struct {
+		tag      string
+		value    float64
+		code     string
+		expected string
+	}{
+		{"en", 1234.5, "USD", "$1,234.50"},
+		{"en", -1234.5, "usd", "-$1,234.50"},
+		{"en", 1234.5, "CHF", "CHF 1,234.50"},
+		{"en", 1234.5, "XYZ", "XYZ 1,234.50"},
+		{"de", 1234.5, "EUR", "1.234,50 €"},
+		{"de-CH", 1234.5, "CHF", "CHF 1’234.50"},
+		{"nl", 1234.5, "EUR", "€ 1.234,50"},
+		{"pt-BR", 1234.5, "BRL", "R$ 1.234,50"},
+		{"ja", 1234.6, "JPY", "¥1,235"},
+		{"en-IN", 1234567.5, "INR", "₹12,34,567.50"},
+		{"en", -0.001, "USD", "$0.00"},
+		{"en", math.Inf(-1), "USD", "-$∞"},
+		{"en", math.NaN(), "USD", "$NaN"},
+	}
+
+	for _, test := range tests {
+		l, err := Lookup(test.tag)
+		require.Nil(err)
+		require.Equal(test.expected, l.FormatCurrency(test.value, test.code), test.tag)
+	}
+
+	require.Equal("$1.00", Locale{Decimal: "."}.FormatCurrency(1, "USD"))
+}
+
+func TestLocale_FormatTime(t *testing.T) {
+	_, require := testify.New(t)
+
+	at := time.Date(2022, 3, 4, 17, 6, 0, 0, time.UTC)
+
+	require.Equal("3/4/2022", Default.FormatDate(at))
+	require.Equal("5:06 PM", Default.FormatTime(at))
+	require.Equal("3/4/2022, 5:06 PM", Default.FormatDateTime(at))
+
+	l, err := Lookup("de")
+	require.Nil(err)
+	require.Equal("04.03.2022", l.FormatDate(at))
+	require.Equal("17:06", l.FormatTime(at))
+	require.Equal("04.03.2022, 17:06", l.FormatDateTime(at))
+}
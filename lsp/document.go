@@ -0,0 +1,202 @@
+package lsp
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/mlctrez/mystace/lexer"
+	"github.com/mlctrez/mystace/lint"
+	"github.com/mlctrez/mystace/parse"
+	"github.com/mlctrez/mystace/source"
+)
+
+// document is an open template, tokens are those read before any lexer error
+type document struct {
+	uri     string
+	name    string
+	version int
+	text    string
+	tokens  []lexer.Token
+	err     error
+}
+
+func newDocument(uri, name, text string, version int, options []lexer.Option) *document {
+	d := &document{uri: uri, name: name, text: text, version: version}
+	var src source.Source
+	if src, d.err = source.FromString(text, source.WithName(name)); d.err == nil {
+		d.tokens, d.err = lexer.New(src, options...).Parse()
+	}
+	return d
+}
+
+// before reports whether a is before b
+func before(a, b source.Location) bool {
+	return a.Line < b.Line || a.Line == b.Line && a.Column < b.Column
+}
+
+// tokenAt returns the index of the token containing l or -1
+func (d *document) tokenAt(l source.Location) int {
+	for i, t := range d.tokens {
+		if !before(l, t.Data.Range.Start) && !before(t.Data.Range.End, l) {
+			return i
+		}
+	}
+	return -1
+}
+
+// sectionName returns the trimmed name of a section tag and whether it opens, inverts or closes a section
+func sectionName(t lexer.Token) (name string, mods lexer.Modifiers, ok bool) {
+	if t.IsChar() {
+		return
+	}
+	mods, name = t.Value()
+	return strings.TrimSpace(name), mods, mods.HasModifier(lexer.HashModifier, lexer.InvertedModifier, lexer.CloseModifier)
+}
+
+// openSections returns the indexes of the sections open before the token end, outermost first
+func (d *document) openSections(end int) (open []int) {
+	for i := 0; i < end && i < len(d.tokens); i++ {
+		name, mods, ok := sectionName(d.tokens[i])
+		switch {
+		case !ok:
+		case mods.HasModifier(lexer.CloseModifier):
+			for s := len(open) - 1; s >= 0; s-- {
+				if openName, _, _ := sectionName(d.tokens[open[s]]); openName == name {
+					open = open[:s]
+					break
+				}
+			}
+		default:
+			open = append(open, i)
+		}
+	}
+	return
+}
+
+// scopes returns the names of the open sections, outermost first
+func (d *document) scopes(open []int) (names []string) {
+	for _, i := range open {
+		name, _, _ := sectionName(d.tokens[i])
+		names = append(names, name)
+	}
+	return
+}
+
+// symbols returns the sections as a tree of symbols, unclosed sections cover their open tag
+func (d *document) symbols() []DocumentSymbol {
+	type pending struct {
+		symbol DocumentSymbol
+		name   string
+	}
+	root := &pending{}
+	stack := []*pending{root}
+	for _, t := range d.tokens {
+		name, mods, ok := sectionName(t)
+		if !ok {
+			continue
+		}
+		if !mods.HasModifier(lexer.CloseModifier) {
+			s := DocumentSymbol{Name: name, Detail: "section", Kind: symbolNamespace,
+				Range: toRange(t.Data.Range), SelectionRange: toRange(t.Data.Range)}
+			if mods.HasModifier(lexer.InvertedModifier) {
+				s.Detail, s.Kind = "inverted section", symbolBoolean
+			}
+			stack = append(stack, &pending{symbol: s, name: name})
+			continue
+		}
+		for s := len(stack) - 1; s > 0; s-- {
+			if stack[s].name != name {
+				continue
+			}
+			// close the matching section and any unclosed sections inside it
+			for len(stack) > s {
+				top := stack[len(stack)-1]
+				if len(stack)-1 == s {
+					top.symbol.Range.End = toRange(t.Data.Range).End
+				}
+				stack = stack[:len(stack)-1]
+				parent := stack[len(stack)-1]
+				parent.symbol.Children = append(parent.symbol.Children, top.symbol)
+			}
+			break
+		}
+	}
+	for len(stack) > 1 {
+		top := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		stack[len(stack)-1].symbol.Children = append(stack[len(stack)-1].symbol.Children, top.symbol)
+	}
+	if root.symbol.Children == nil {
+		return []DocumentSymbol{}
+	}
+	return root.symbol.Children
+}
+
+// diagnostics reports the lint problems of the document, and the parse error when there are
+// no lint errors, with partials resolved in names
+func (d *document) diagnostics(names []string, options []lexer.Option) (diagnostics []Diagnostic) {
+	diagnostics = []Diagnostic{}
+	sources := make([]source.Source, 0, len(names)+1)
+	for _, name := range names {
+		if name == d.name {
+			continue
+		}
+		if src, err := source.FromString("", source.WithName(name)); err == nil {
+			sources = append(sources, src)
+		}
+	}
+	src, err := source.FromString(d.text, source.WithName(d.name))
+	if err != nil {
+		return
+	}
+	problems, err := lint.Lint(append(sources, src), lint.WithoutRules(lint.RuleUnusedPartial), lint.WithLexerOptions(options...))
+	if err != nil {
+		return
+	}
+	failed := 0
+	for _, p := range problems {
+		if p.Source != d.name {
+			continue
+		}
+		severity := SeverityWarning
+		if p.Severity == lint.SeverityError {
+			severity = SeverityError
+			failed++
+		}
+		r := toRange(p.Range)
+		if p.Rule == lint.RuleSyntax {
+			r.End = Position{Line: r.Start.Line, Character: r.Start.Character + 1}
+		}
+		diagnostics = append(diagnostics, Diagnostic{Range: r, Severity: severity, Code: p.Rule, Source: "mystace", Message: p.Message})
+	}
+	if failed > 0 || d.err != nil {
+		return
+	}
+	if _, err = parse.Tokens(d.name, d.tokens); err != nil {
+		var parseError *parse.Error
+		if errors.As(err, &parseError) {
+			diagnostics = append(diagnostics, Diagnostic{Range: toRange(parseError.Range), Severity: SeverityError,
+				Source: "mystace", Message: fmt.Sprintf("%s : %s", parseError.Tag, parseError.Err)})
+		}
+	}
+	return
+}
+
+// offset returns the byte offset of p in the text and the start of its line
+func (d *document) offset(p Position) (offset, lineStart int) {
+	for line := 0; line < p.Line; line++ {
+		next := strings.IndexByte(d.text[lineStart:], '\n')
+		if next == -1 {
+			return len(d.text), lineStart
+		}
+		lineStart += next + 1
+	}
+	offset = lineStart
+	for c := 0; c < p.Character && offset < len(d.text) && d.text[offset] != '\n'; c++ {
+		_, size := utf8.DecodeRuneInString(d.text[offset:])
+		offset += size
+	}
+	return
+}
@@ -0,0 +1,75 @@
+package lsp
+
+import (
+	"testing"
+
+	"github.com/mlctrez/mystace/internal/testify"
+	"github.com/mlctrez/mystace/lint"
+	"github.com/mlctrez/mystace/source"
+)
+
+func TestDocument_Scopes(t *testing.T) {
+	_, require := testify.New(t)
+
+	d := newDocument("file:///page.mustache", "page", "{{#items}}\n{{#tags}}{{name}}{{/tags}}{{price}}\n{{/items}}", 1, nil)
+	require.Nil(d.err)
+
+	name := d.tokenAt(source.Location{Line: 2, Column: 12})
+	require.Equal("{{name}}", d.tokens[name].Data.Str)
+	require.Equal([]string{"items", "tags"}, d.scopes(d.openSections(name)))
+
+	price := d.tokenAt(source.Location{Line: 2, Column: 33})
+	require.Equal("{{price}}", d.tokens[price].Data.Str)
+	require.Equal([]string{"items"}, d.scopes(d.openSections(price)))
+	require.Equal(-1, d.tokenAt(source.Location{Line: 9, Column: 1}))
+}
+
+func TestDocument_Symbols(t *testing.T) {
+	_, require := testify.New(t)
+
+	d := newDocument("file:///page.mustache", "page", "{{#items}}\n{{^empty}}none{{/empty}}\n{{/items}}{{#open}}", 1, nil)
+	symbols := d.symbols()
+	require.Len(symbols, 2)
+	require.Equal("items", symbols[0].Name)
+	require.Equal(Range{Start: Position{Line: 0, Character: 0}, End: Position{Line: 2, Character: 10}}, symbols[0].Range)
+	require.Len(symbols[0].Children, 1)
+	require.Equal("empty", symbols[0].Children[0].Name)
+	require.Equal(symbolBoolean, symbols[0].Children[0].Kind)
+	require.Equal("open", symbols[1].Name)
+
+	require.Equal([]DocumentSymbol{}, newDocument("file:///a", "a", "text", 1, nil).symbols())
+}
+
+func TestDocument_Diagnostics(t *testing.T) {
+	_, require := testify.New(t)
+
+	d := newDocument("file:///page.mustache", "page", "{{#a}}x{{/b}}\n{{> card}}{{> missing}}", 1, nil)
+	diagnostics := d.diagnostics([]string{"page", "card"}, nil)
+	var codes []string
+	for _, diagnostic := range diagnostics {
+		codes = append(codes, diagnostic.Code)
+	}
+	require.Equal([]string{lint.RuleUnclosedSection, lint.RuleMismatchedSection, lint.RuleMissingPartial}, codes)
+	require.Equal(SeverityError, diagnostics[0].Severity)
+
+	d = newDocument("file:///page.mustache", "page", "line\n{{name", 1, nil)
+	require.NotNil(d.err)
+	diagnostics = d.diagnostics(nil, nil)
+	require.Len(diagnostics, 1)
+	require.Equal(lint.RuleSyntax, diagnostics[0].Code)
+
+	require.Equal([]Diagnostic{}, newDocument("file:///a", "a", "{{#a}}x{{/a}}", 1, nil).diagnostics(nil, nil))
+}
+
+func TestDocument_Offset(t *testing.T) {
+	_, require := testify.New(t)
+
+	d := &document{text: "héllo\n{{na"}
+	offset, lineStart := d.offset(Position{Line: 1, Character: 4})
+	require.Equal(7, lineStart)
+	require.Equal("{{na", d.text[lineStart:offset])
+	offset, _ = d.offset(Position{Line: 0, Character: 2})
+	require.Equal("hé", d.text[:offset])
+	offset, _ = d.offset(Position{Line: 5, Character: 0})
+	require.Equal(len(d.text), offset)
+}
@@ -0,0 +1,142 @@
+package lsp
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+
+	"github.com/mlctrez/mystace/context"
+	"github.com/mlctrez/mystace/schema"
+)
+
+// dataSchema describes sample data as a schema, the items of a list combine the properties of all items
+func dataSchema(v interface{}) *schema.Schema {
+	switch vt := v.(type) {
+	case map[string]interface{}:
+		s := &schema.Schema{Type: schema.Types{schema.Object}, Properties: map[string]*schema.Schema{}}
+		for name, value := range vt {
+			s.Properties[name] = dataSchema(value)
+		}
+		return s
+	case []interface{}:
+		s := &schema.Schema{Type: schema.Types{schema.Array}}
+		for _, item := range vt {
+			s.Items = combine(s.Items, dataSchema(item))
+		}
+		return s
+	case bool:
+		return &schema.Schema{Type: schema.Types{schema.Boolean}}
+	case string:
+		return &schema.Schema{Type: schema.Types{schema.String}}
+	case json.Number, float64, float32, int, int64, uint64:
+		return &schema.Schema{Type: schema.Types{schema.Number}}
+	}
+	return &schema.Schema{}
+}
+
+// combine merges the types and properties of b into a
+func combine(a, b *schema.Schema) *schema.Schema {
+	if a == nil {
+		return b
+	}
+	for _, t := range b.Type {
+		if !a.Type.Has(t) {
+			a.Type = append(a.Type, t)
+		}
+	}
+	for name, p := range b.Properties {
+		if a.Properties == nil {
+			a.Properties = map[string]*schema.Schema{}
+		}
+		a.Properties[name] = combine(a.Properties[name], p)
+	}
+	if b.Items != nil {
+		a.Items = combine(a.Items, b.Items)
+	}
+	return a
+}
+
+// frame returns the schema of the frame a section over a value of schema s pushes
+func frame(s *schema.Schema) *schema.Schema {
+	if s == nil || s.Properties != nil || s.Items == nil {
+		return s
+	}
+	return s.Items
+}
+
+// frames returns the schemas of the frames in scope within the sections, outermost first.
+// A nil frame is a value without a known schema.
+func frames(root *schema.Schema, sections []string) []*schema.Schema {
+	result := []*schema.Schema{root}
+	for _, name := range sections {
+		result = append(result, frame(lookup(result, name)))
+	}
+	return result
+}
+
+// lookup finds the schema of name as the renderer would resolve it in frames
+func lookup(frames []*schema.Schema, name string) *schema.Schema {
+	if name == context.ImplicitIterator {
+		return frames[len(frames)-1]
+	}
+	names := strings.Split(name, ".")
+	for i := len(frames) - 1; i >= 0; i-- {
+		if frames[i] == nil {
+			continue
+		}
+		if s, ok := frames[i].Properties[names[0]]; ok {
+			for _, n := range names[1:] {
+				if s = s.Properties[n]; s == nil {
+					return nil
+				}
+			}
+			return s
+		}
+	}
+	return nil
+}
+
+// completions returns the names visible in frames, innermost first, or the properties of
+// the value named by the part of prefix before its last dot
+func completions(frames []*schema.Schema, prefix string) (items []CompletionItem) {
+	var properties []map[string]*schema.Schema
+	if dot := strings.LastIndex(prefix, "."); dot > 0 {
+		if s := lookup(frames, prefix[:dot]); s != nil {
+			properties = append(properties, s.Properties)
+		}
+	} else {
+		for i := len(frames) - 1; i >= 0; i-- {
+			if frames[i] != nil {
+				properties = append(properties, frames[i].Properties)
+			}
+		}
+	}
+	seen := map[string]bool{}
+	for _, p := range properties {
+		names := make([]string, 0, len(p))
+		for name := range p {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if seen[name] {
+				continue
+			}
+			seen[name] = true
+			kind := completionVariable
+			if p[name].Type.Has(schema.Object) || p[name].Type.Has(schema.Array) {
+				kind = completionStruct
+			}
+			items = append(items, CompletionItem{Label: name, Kind: kind, Detail: describe(p[name])})
+		}
+	}
+	return
+}
+
+// describe returns the types of a schema: string | number
+func describe(s *schema.Schema) string {
+	if s == nil || len(s.Type) == 0 {
+		return "any"
+	}
+	return strings.Join(s.Type, " | ")
+}
@@ -0,0 +1,54 @@
+package lsp
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/mlctrez/mystace/context"
+	"github.com/mlctrez/mystace/internal/testify"
+	"github.com/mlctrez/mystace/schema"
+)
+
+func TestDataSchema(t *testing.T) {
+	_, require := testify.New(t)
+
+	ctx, err := context.FromJSON(strings.NewReader(`{"title":"t","items":[{"name":"a"},{"name":"b","price":2}],"paid":true}`))
+	require.Nil(err)
+	v, _ := ctx.Lookup(context.ImplicitIterator)
+	s := dataSchema(v)
+
+	require.Equal("string", describe(s.Properties["title"]))
+	require.Equal("boolean", describe(s.Properties["paid"]))
+	items := s.Properties["items"]
+	require.True(items.Type.Has(schema.Array))
+	require.Equal("number", describe(items.Items.Properties["price"]))
+	require.Equal("string", describe(items.Items.Properties["name"]))
+}
+
+func TestCompletions(t *testing.T) {
+	_, require := testify.New(t)
+
+	root := dataSchema(map[string]interface{}{
+		"title": "t",
+		"user":  map[string]interface{}{"name": "n", "email": "e"},
+		"items": []interface{}{map[string]interface{}{"name": "a"}},
+	})
+
+	labels := func(items []CompletionItem) (names []string) {
+		for _, item := range items {
+			names = append(names, item.Label)
+		}
+		return
+	}
+
+	require.Equal([]string{"items", "title", "user"}, labels(completions(frames(root, nil), "")))
+	require.Equal([]string{"email", "name"}, labels(completions(frames(root, nil), "user.")))
+	// names of the item come first, shadowing the outer names
+	require.Equal([]string{"name", "items", "title", "user"}, labels(completions(frames(root, []string{"items"}), "")))
+	require.Nil(completions(frames(root, nil), "missing."))
+
+	require.Equal("string", describe(lookup(frames(root, []string{"user"}), "name")))
+	require.Equal("string", describe(lookup(frames(root, nil), "user.email")))
+	require.Nil(lookup(frames(root, nil), "user.missing"))
+	require.Equal("any", describe(nil))
+}
@@ -0,0 +1,41 @@
+package lsp
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/mlctrez/mystace/internal/testify"
+	"github.com/mlctrez/mystace/source"
+)
+
+func TestConn(t *testing.T) {
+	_, require := testify.New(t)
+
+	out := &bytes.Buffer{}
+	c := newConn(strings.NewReader("Content-Length: 40\r\n\r\n{\"jsonrpc\":\"2.0\",\"id\":1,\"method\":\"ping\"}"), out)
+	m, err := c.read()
+	require.Nil(err)
+	require.Equal("ping", m.Method)
+	require.Equal(json.RawMessage("1"), m.ID)
+
+	require.Nil(c.write(&message{ID: m.ID, Result: json.RawMessage("null")}))
+	require.Equal("Content-Length: 38\r\n\r\n{\"jsonrpc\":\"2.0\",\"id\":1,\"result\":null}", out.String())
+
+	_, err = newConn(strings.NewReader("Content-Type: text\r\n\r\n{}"), out).read()
+	require.ErrorIs(err, ErrMissingContentLength)
+
+	_, err = newConn(strings.NewReader("Content-Length: 2\r\n\r\n{]"), out).read()
+	var rpcError *responseError
+	require.ErrorAs(err, &rpcError)
+	require.Equal(codeParseError, rpcError.Code)
+}
+
+func TestToRange(t *testing.T) {
+	_, require := testify.New(t)
+
+	r := toRange(source.Range{Start: source.Location{Line: 2, Column: 3}, End: source.Location{Line: 2, Column: 10}})
+	require.Equal(Range{Start: Position{Line: 1, Character: 2}, End: Position{Line: 1, Character: 10}}, r)
+	require.Equal(source.Location{Line: 2, Column: 3}, toLocation(r.Start))
+}
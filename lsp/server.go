@@ -0,0 +1,507 @@
+// Package lsp is a language server for mustache templates speaking the Language Server
+// Protocol over a stream, such as stdio. It reports lexer, parser and lint problems as
+// diagnostics, finds the templates of {{> name}} tags, describes the section scope of a
+// tag on hover, completes names from a schema or sample data and lists sections as
+// document symbols.
+//
+// Templates are named as by the mystace command: the path relative to the workspace root
+// without the template extension, so partials/card.mustache is {{> partials/card}}.
+package lsp
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/mlctrez/mystace/context"
+	"github.com/mlctrez/mystace/lexer"
+	"github.com/mlctrez/mystace/schema"
+)
+
+var ErrNoShutdown = fmt.Errorf("exit without shutdown")
+
+// DefaultExtension is the extension of template files in the workspace
+const DefaultExtension = ".mustache"
+
+// maxLoops allows the lexer to read documents of any reasonable size
+const maxLoops = 1 << 20
+
+type Option func(s *Server) error
+
+// WithSchema completes names from a schema, such as one inferred by the schema package
+func WithSchema(sc *schema.Schema) Option {
+	return func(s *Server) error {
+		s.schema = sc
+		return nil
+	}
+}
+
+// WithData completes names from sample data, such as a context read by context.FromJSON
+func WithData(ctx *context.Context) Option {
+	return func(s *Server) error {
+		v, _ := ctx.Lookup(context.ImplicitIterator)
+		s.schema = dataSchema(v)
+		return nil
+	}
+}
+
+// WithExtension sets the extension of the template files in the workspace
+func WithExtension(ext string) Option {
+	return func(s *Server) error {
+		s.ext = ext
+		return nil
+	}
+}
+
+// WithDelimiters reads templates using open and close instead of {{ and }}
+func WithDelimiters(open, close string) Option {
+	return func(s *Server) error {
+		s.delimiter = open
+		s.lexerOptions = append(s.lexerOptions, lexer.WithDelimiters(open, close))
+		return nil
+	}
+}
+
+// WithLexerOptions reads templates with options, such as lexer.WithDelimiters
+func WithLexerOptions(options ...lexer.Option) Option {
+	return func(s *Server) error {
+		s.lexerOptions = append(s.lexerOptions, options...)
+		return nil
+	}
+}
+
+// Server is a language server, it handles one client
+type Server struct {
+	conn         *conn
+	root         string
+	ext          string
+	delimiter    string
+	schema       *schema.Schema
+	lexerOptions []lexer.Option
+	documents    map[string]*document
+	// files are the paths of the templates in the workspace by name
+	files    map[string]string
+	shutdown bool
+}
+
+func NewServer(options ...Option) (s *Server, err error) {
+	s = &Server{
+		ext:          DefaultExtension,
+		delimiter:    lexer.OpenDelimiter,
+		lexerOptions: []lexer.Option{lexer.WithMaxLoops(maxLoops)},
+		documents:    map[string]*document{},
+		files:        map[string]string{},
+	}
+	for _, option := range options {
+		if err = option(s); err != nil {
+			return nil, err
+		}
+	}
+	return
+}
+
+type handler func(s *Server, params json.RawMessage) (interface{}, error)
+
+var handlers = map[string]handler{
+	"initialize":                      (*Server).initialize,
+	"shutdown":                        (*Server).shutdownRequest,
+	"textDocument/definition":         (*Server).definition,
+	"textDocument/hover":              (*Server).hover,
+	"textDocument/completion":         (*Server).completion,
+	"textDocument/documentSymbol":     (*Server).documentSymbol,
+	"textDocument/didOpen":            (*Server).didOpen,
+	"textDocument/didChange":          (*Server).didChange,
+	"textDocument/didClose":           (*Server).didClose,
+	"workspace/didChangeWatchedFiles": (*Server).didChangeWatchedFiles,
+}
+
+// Serve handles the messages read from r, writing to w, until the exit notification.
+// It returns ErrNoShutdown when the client exits or disconnects without a shutdown request.
+func (s *Server) Serve(r io.Reader, w io.Writer) error {
+	s.conn = newConn(r, w)
+	for {
+		m, err := s.conn.read()
+		var rpcError *responseError
+		switch {
+		case errors.As(err, &rpcError):
+			if err = s.conn.write(&message{ID: json.RawMessage("null"), Error: rpcError}); err != nil {
+				return err
+			}
+			continue
+		case errors.Is(err, io.EOF) && !s.shutdown:
+			return ErrNoShutdown
+		case errors.Is(err, io.EOF):
+			return nil
+		case err != nil:
+			return err
+		}
+		if m.Method == "exit" {
+			if s.shutdown {
+				return nil
+			}
+			return ErrNoShutdown
+		}
+		if err = s.handle(m); err != nil {
+			return err
+		}
+	}
+}
+
+// handle calls the handler of a request or notification and writes the response to requests
+func (s *Server) handle(m *message) error {
+	h, ok := handlers[m.Method]
+	var result interface{}
+	var err error
+	if ok {
+		result, err = h(s, m.Params)
+	} else {
+		err = &responseError{Code: codeMethodNotFound, Message: fmt.Sprintf("method %q not found", m.Method)}
+	}
+	if m.ID == nil {
+		// notifications have no response
+		return nil
+	}
+	response := &message{ID: m.ID}
+	if err != nil {
+		var rpcError *responseError
+		if !errors.As(err, &rpcError) {
+			rpcError = &responseError{Code: codeInvalidParams, Message: err.Error()}
+		}
+		response.Error = rpcError
+		return s.conn.write(response)
+	}
+	if response.Result, err = json.Marshal(result); err != nil {
+		return err
+	}
+	return s.conn.write(response)
+}
+
+func decode(params json.RawMessage, v interface{}) error {
+	if err := json.Unmarshal(params, v); err != nil {
+		return &responseError{Code: codeInvalidParams, Message: err.Error()}
+	}
+	return nil
+}
+
+func (s *Server) initialize(params json.RawMessage) (interface{}, error) {
+	var p initializeParams
+	if err := decode(params, &p); err != nil {
+		return nil, err
+	}
+	rootURI := p.RootURI
+	if len(p.WorkspaceFolders) > 0 {
+		rootURI = p.WorkspaceFolders[0].URI
+	}
+	s.root = p.RootPath
+	if rootURI != "" {
+		s.root = uriPath(rootURI)
+	}
+	s.scan()
+	return map[string]interface{}{
+		"capabilities": map[string]interface{}{
+			"textDocumentSync":       1,
+			"definitionProvider":     true,
+			"hoverProvider":          true,
+			"documentSymbolProvider": true,
+			"completionProvider": map[string]interface{}{
+				"triggerCharacters": []string{"{", ".", "#", "^", "/", ">", "&"},
+			},
+		},
+		"serverInfo": map[string]string{"name": "mystace"},
+	}, nil
+}
+
+func (s *Server) shutdownRequest(json.RawMessage) (interface{}, error) {
+	s.shutdown = true
+	return nil, nil
+}
+
+// scan finds the template files of the workspace
+func (s *Server) scan() {
+	s.files = map[string]string{}
+	if s.root == "" {
+		return
+	}
+	_ = filepath.WalkDir(s.root, func(path string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() && filepath.Ext(path) == s.ext {
+			s.files[s.nameOf(path)] = path
+		}
+		return nil
+	})
+}
+
+// nameOf returns the template name of the file at path
+func (s *Server) nameOf(path string) string {
+	name := filepath.Base(path)
+	if s.root != "" {
+		if rel, err := filepath.Rel(s.root, path); err == nil && !strings.HasPrefix(rel, "..") {
+			name = rel
+		}
+	}
+	return filepath.ToSlash(strings.TrimSuffix(name, filepath.Ext(name)))
+}
+
+// names returns the names of the templates of the workspace and the open documents
+func (s *Server) names() []string {
+	seen := map[string]bool{}
+	for name := range s.files {
+		seen[name] = true
+	}
+	for _, d := range s.documents {
+		seen[d.name] = true
+	}
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// partial returns the uri of the template name
+func (s *Server) partial(name string) (string, bool) {
+	for _, d := range s.documents {
+		if d.name == name {
+			return d.uri, true
+		}
+	}
+	if path, ok := s.files[name]; ok {
+		return pathURI(path), true
+	}
+	return "", false
+}
+
+func uriPath(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "file" {
+		return uri
+	}
+	return filepath.FromSlash(u.Path)
+}
+
+func pathURI(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	return (&url.URL{Scheme: "file", Path: filepath.ToSlash(path)}).String()
+}
+
+// open replaces the document at uri and publishes its diagnostics
+func (s *Server) open(uri, text string, version int) error {
+	d := newDocument(uri, s.nameOf(uriPath(uri)), text, version, s.lexerOptions)
+	s.documents[uri] = d
+	return s.conn.notify("textDocument/publishDiagnostics", publishDiagnosticsParams{
+		URI: uri, Version: version, Diagnostics: d.diagnostics(s.names(), s.lexerOptions)})
+}
+
+func (s *Server) didOpen(params json.RawMessage) (interface{}, error) {
+	var p didOpenParams
+	if err := decode(params, &p); err != nil {
+		return nil, err
+	}
+	return nil, s.open(p.TextDocument.URI, p.TextDocument.Text, p.TextDocument.Version)
+}
+
+func (s *Server) didChange(params json.RawMessage) (interface{}, error) {
+	var p didChangeParams
+	if err := decode(params, &p); err != nil {
+		return nil, err
+	}
+	if len(p.ContentChanges) == 0 {
+		return nil, nil
+	}
+	// the server asks for full document sync, so the last change is the whole text
+	return nil, s.open(p.TextDocument.URI, p.ContentChanges[len(p.ContentChanges)-1].Text, p.TextDocument.Version)
+}
+
+func (s *Server) didClose(params json.RawMessage) (interface{}, error) {
+	var p didCloseParams
+	if err := decode(params, &p); err != nil {
+		return nil, err
+	}
+	delete(s.documents, p.TextDocument.URI)
+	return nil, s.conn.notify("textDocument/publishDiagnostics", publishDiagnosticsParams{
+		URI: p.TextDocument.URI, Diagnostics: []Diagnostic{}})
+}
+
+func (s *Server) didChangeWatchedFiles(json.RawMessage) (interface{}, error) {
+	s.scan()
+	return nil, nil
+}
+
+// at returns the document and the index of the token at the position of a request
+func (s *Server) at(params json.RawMessage) (d *document, p positionParams, token int, err error) {
+	if err = decode(params, &p); err != nil {
+		return
+	}
+	var ok bool
+	if d, ok = s.documents[p.TextDocument.URI]; !ok {
+		return nil, p, -1, &responseError{Code: codeInvalidParams, Message: fmt.Sprintf("document %q is not open", p.TextDocument.URI)}
+	}
+	return d, p, d.tokenAt(toLocation(p.Position)), nil
+}
+
+func (s *Server) definition(params json.RawMessage) (interface{}, error) {
+	d, _, i, err := s.at(params)
+	if err != nil || i == -1 {
+		return nil, err
+	}
+	mods, value := d.tokens[i].Value()
+	if d.tokens[i].IsChar() || !mods.HasModifier(lexer.ImportModifier) {
+		return nil, nil
+	}
+	name, dynamic := lexer.PartialName(value)
+	if dynamic {
+		return nil, nil
+	}
+	uri, ok := s.partial(name)
+	if !ok {
+		return nil, nil
+	}
+	return Location{URI: uri}, nil
+}
+
+func (s *Server) hover(params json.RawMessage) (interface{}, error) {
+	d, _, i, err := s.at(params)
+	if err != nil || i == -1 || d.tokens[i].IsChar() {
+		return nil, err
+	}
+	token := d.tokens[i]
+	mods, value := token.Value()
+	value = strings.TrimSpace(value)
+	open := d.openSections(i)
+	scopes := d.scopes(open)
+
+	var text strings.Builder
+	// named is set when value names a context value
+	named := !mods.HasModifier(lexer.ImportModifier, lexer.TranslateModifier)
+	switch {
+	case mods.HasModifier(lexer.CommentModifier):
+		return nil, nil
+	case mods.HasModifier(lexer.ImportModifier):
+		var dynamic bool
+		if value, dynamic = lexer.PartialName(value); dynamic {
+			named = true
+			fmt.Fprintf(&text, "dynamic partial named by `%s`", value)
+		} else if uri, ok := s.partial(value); ok {
+			fmt.Fprintf(&text, "partial `%s`\n\n%s", value, uriPath(uri))
+		} else {
+			fmt.Fprintf(&text, "partial `%s` not found", value)
+		}
+	case mods.HasModifier(lexer.CloseModifier):
+		fmt.Fprintf(&text, "end of section `%s`", value)
+		if len(open) > 0 {
+			open, scopes = open[:len(open)-1], scopes[:len(scopes)-1]
+		}
+	case mods.HasModifier(lexer.HashModifier):
+		fmt.Fprintf(&text, "section `%s`", value)
+	case mods.HasModifier(lexer.InvertedModifier):
+		fmt.Fprintf(&text, "inverted section `%s`", value)
+	case mods.HasModifier(lexer.TranslateModifier):
+		fmt.Fprintf(&text, "message `%s`", value)
+	case token.IsThreeBracket() || mods.HasModifier(lexer.AmpModifier):
+		fmt.Fprintf(&text, "unescaped variable `%s`", value)
+	default:
+		fmt.Fprintf(&text, "variable `%s`", value)
+	}
+	if s.schema != nil && named {
+		if sc := lookup(frames(s.schema, scopes), value); sc != nil {
+			fmt.Fprintf(&text, " : %s", describe(sc))
+		}
+	}
+	if len(scopes) == 0 {
+		text.WriteString("\n\nscope: top level")
+	} else {
+		var lines []string
+		for _, o := range open {
+			start := d.tokens[o].Data.Range.Start
+			lines = append(lines, fmt.Sprintf("`%s` %d:%d", d.tokens[o].Data.Str, start.Line, start.Column))
+		}
+		fmt.Fprintf(&text, "\n\nscope: %s", strings.Join(lines, " › "))
+	}
+	r := toRange(token.Data.Range)
+	return Hover{Contents: markupContent{Kind: "markdown", Value: text.String()}, Range: &r}, nil
+}
+
+func (s *Server) completion(params json.RawMessage) (interface{}, error) {
+	var p positionParams
+	if err := decode(params, &p); err != nil {
+		return nil, err
+	}
+	d, ok := s.documents[p.TextDocument.URI]
+	if !ok {
+		return []CompletionItem{}, nil
+	}
+	offset, lineStart := d.offset(p.Position)
+	line := d.text[lineStart:offset]
+	tag := strings.LastIndex(line, s.delimiter)
+	if tag == -1 {
+		return []CompletionItem{}, nil
+	}
+	prefix := strings.TrimLeft(line[tag+len(s.delimiter):], " ")
+	mode := ""
+	if prefix != "" && strings.ContainsRune("{&#^/>", rune(prefix[0])) {
+		mode, prefix = prefix[:1], strings.TrimLeft(prefix[1:], " ")
+	}
+	if strings.ContainsAny(prefix, " }") {
+		return []CompletionItem{}, nil
+	}
+
+	// the sections open before the tag being written, which is usually unclosed and would
+	// stop the lexer, are found in the text before it
+	written := newDocument(d.uri, d.name, d.text[:lineStart+tag], d.version, s.lexerOptions)
+	scopes := written.scopes(written.openSections(len(written.tokens)))
+
+	items := []CompletionItem{}
+	switch mode {
+	case ">":
+		for _, name := range s.names() {
+			if name != d.name {
+				items = append(items, CompletionItem{Label: name, Kind: completionFile, Detail: "partial"})
+			}
+		}
+	case "/":
+		for i := len(scopes) - 1; i >= 0; i-- {
+			items = append(items, CompletionItem{Label: scopes[i], Kind: completionStruct, Detail: "open section"})
+		}
+	default:
+		if s.schema != nil {
+			items = append(items, completions(frames(s.schema, scopes), prefix)...)
+		}
+	}
+	return items, nil
+}
+
+func (s *Server) documentSymbol(params json.RawMessage) (interface{}, error) {
+	var p struct {
+		TextDocument textDocumentIdentifier `json:"textDocument"`
+	}
+	if err := decode(params, &p); err != nil {
+		return nil, err
+	}
+	d, ok := s.documents[p.TextDocument.URI]
+	if !ok {
+		return []DocumentSymbol{}, nil
+	}
+	return d.symbols(), nil
+}
+
+// ReadSchema reads a JSON Schema file for WithSchema
+func ReadSchema(path string) (*schema.Schema, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	sc := &schema.Schema{}
+	if err = json.Unmarshal(data, sc); err != nil {
+		return nil, fmt.Errorf("%s : %w", path, err)
+	}
+	return sc, nil
+}
@@ -0,0 +1,190 @@
+package lsp
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mlctrez/mystace/internal/testify"
+	"github.com/mlctrez/mystace/schema"
+)
+
+// session writes the framed requests, ids are assigned in order starting at 1 for
+// requests, and returns the responses by id and the notifications read from the server
+type session struct {
+	t        *testing.T
+	in       bytes.Buffer
+	id       int
+	messages []*message
+}
+
+func (s *session) request(method string, params interface{}) int {
+	s.id++
+	s.send(method, json.RawMessage(fmtInt(s.id)), params)
+	return s.id
+}
+
+func (s *session) notify(method string, params interface{}) {
+	s.send(method, nil, params)
+}
+
+func (s *session) send(method string, id json.RawMessage, params interface{}) {
+	raw, err := json.Marshal(params)
+	testify.Require(s.t).Nil(err)
+	var out bytes.Buffer
+	c := newConn(nil, &out)
+	testify.Require(s.t).Nil(c.write(&message{ID: id, Method: method, Params: raw}))
+	s.in.Write(out.Bytes())
+}
+
+func (s *session) serve(server *Server) error {
+	var out bytes.Buffer
+	err := server.Serve(&s.in, &out)
+	c := newConn(&out, nil)
+	for {
+		m, readErr := c.read()
+		if readErr != nil {
+			break
+		}
+		s.messages = append(s.messages, m)
+	}
+	return err
+}
+
+func (s *session) result(id int, v interface{}) *responseError {
+	for _, m := range s.messages {
+		if string(m.ID) == fmtInt(id) {
+			if m.Error != nil {
+				return m.Error
+			}
+			testify.Require(s.t).Nil(json.Unmarshal(m.Result, v))
+			return nil
+		}
+	}
+	s.t.Fatalf("no response to request %d", id)
+	return nil
+}
+
+func (s *session) diagnostics(uri string) (params []publishDiagnosticsParams) {
+	for _, m := range s.messages {
+		if m.Method == "textDocument/publishDiagnostics" {
+			var p publishDiagnosticsParams
+			testify.Require(s.t).Nil(json.Unmarshal(m.Params, &p))
+			if p.URI == uri {
+				params = append(params, p)
+			}
+		}
+	}
+	return
+}
+
+func fmtInt(i int) string {
+	b, _ := json.Marshal(i)
+	return string(b)
+}
+
+func position(uri string, line, character int) positionParams {
+	return positionParams{TextDocument: textDocumentIdentifier{URI: uri}, Position: Position{Line: line, Character: character}}
+}
+
+func TestServer(t *testing.T) {
+	_, require := testify.New(t)
+
+	dir := t.TempDir()
+	require.Nil(os.MkdirAll(filepath.Join(dir, "partials"), 0755))
+	card := filepath.Join(dir, "partials", "card.mustache")
+	require.Nil(os.WriteFile(card, []byte("<b>{{name}}</b>"), 0644))
+	page := pathURI(filepath.Join(dir, "page.mustache"))
+
+	server, err := NewServer(WithSchema(&schema.Schema{Type: schema.Types{schema.Object}, Properties: map[string]*schema.Schema{
+		"title": {Type: schema.Types{schema.String}},
+		"items": {Type: schema.Types{schema.Array}, Items: &schema.Schema{Type: schema.Types{schema.Object},
+			Properties: map[string]*schema.Schema{"name": {Type: schema.Types{schema.String}}}}},
+	}}))
+	require.Nil(err)
+
+	s := &session{t: t}
+	initialize := s.request("initialize", map[string]string{"rootUri": pathURI(dir)})
+	s.notify("initialized", struct{}{})
+	s.notify("textDocument/didOpen", didOpenParams{TextDocument: textDocumentItem{URI: page, Version: 1,
+		Text: "{{#items}}\n{{> partials/card}}{{name}}\n{{/items}}{{#bad}}"}})
+	symbols := s.request("textDocument/documentSymbol", map[string]interface{}{"textDocument": textDocumentIdentifier{URI: page}})
+	definition := s.request("textDocument/definition", position(page, 1, 5))
+	hover := s.request("textDocument/hover", position(page, 1, 22))
+	s.notify("textDocument/didChange", map[string]interface{}{
+		"textDocument":   textDocumentIdentifier{URI: page, Version: 2},
+		"contentChanges": []map[string]string{{"text": "{{#items}}\n{{na\n{{/items}}"}},
+	})
+	inSection := s.request("textDocument/completion", position(page, 1, 4))
+	s.notify("textDocument/didChange", map[string]interface{}{
+		"textDocument":   textDocumentIdentifier{URI: page, Version: 3},
+		"contentChanges": []map[string]string{{"text": "{{#items}}{{/items}}{{> \n{{t"}},
+	})
+	partials := s.request("textDocument/completion", position(page, 0, 24))
+	topLevel := s.request("textDocument/completion", position(page, 1, 3))
+	unknown := s.request("textDocument/unknown", struct{}{})
+	s.notify("textDocument/didClose", didCloseParams{TextDocument: textDocumentIdentifier{URI: page}})
+	s.request("shutdown", nil)
+	s.notify("exit", nil)
+	require.Nil(s.serve(server))
+
+	var initialized struct {
+		Capabilities map[string]interface{} `json:"capabilities"`
+	}
+	require.Nil(s.result(initialize, &initialized))
+	require.Equal(true, initialized.Capabilities["hoverProvider"])
+
+	published := s.diagnostics(page)
+	require.Len(published, 4)
+	require.Len(published[0].Diagnostics, 1)
+	require.Equal("unclosed-section", published[0].Diagnostics[0].Code)
+	require.Len(published[1].Diagnostics, 1)
+	require.Equal("unclosed-section", published[1].Diagnostics[0].Code)
+	require.Equal(2, published[1].Version)
+	require.Empty(published[3].Diagnostics)
+
+	var documentSymbols []DocumentSymbol
+	require.Nil(s.result(symbols, &documentSymbols))
+	require.Len(documentSymbols, 2)
+	require.Equal("items", documentSymbols[0].Name)
+
+	var location Location
+	require.Nil(s.result(definition, &location))
+	require.Equal(pathURI(card), location.URI)
+
+	var described Hover
+	require.Nil(s.result(hover, &described))
+	require.Equal("variable `name` : string\n\nscope: `{{#items}}` 1:1", described.Contents.Value)
+
+	labels := func(id int) (names []string) {
+		var items []CompletionItem
+		require.Nil(s.result(id, &items))
+		for _, item := range items {
+			names = append(names, item.Label)
+		}
+		return
+	}
+	require.Equal([]string{"name", "items", "title"}, labels(inSection))
+	require.Equal([]string{"partials/card"}, labels(partials))
+	require.Equal([]string{"items", "title"}, labels(topLevel))
+
+	require.Equal(codeMethodNotFound, s.result(unknown, nil).Code)
+}
+
+func TestServer_NoShutdown(t *testing.T) {
+	_, require := testify.New(t)
+
+	server, err := NewServer()
+	require.Nil(err)
+	s := &session{t: t}
+	s.request("initialize", struct{}{})
+	require.ErrorIs(s.serve(server), ErrNoShutdown)
+
+	server, err = NewServer()
+	require.Nil(err)
+	s = &session{t: t}
+	s.notify("exit", nil)
+	require.ErrorIs(s.serve(server), ErrNoShutdown)
+}
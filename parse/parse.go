@@ -0,0 +1,192 @@
+package parse
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mlctrez/mystace/lexer"
+	"github.com/mlctrez/mystace/source"
+)
+
+var (
+	ErrMissingClose    = fmt.Errorf("missing close tag")
+	ErrUnexpectedClose = fmt.Errorf("unexpected close tag")
+	ErrUnsupportedTag  = fmt.Errorf("unsupported tag")
+)
+
+// Tree is the parsed form of a template. Text nodes hold the text as rendered, with the
+// whitespace around standalone tags already removed, so walking a Tree produces the same
+// output as the renderer.
+type Tree struct {
+	Name  string
+	Nodes []Node
+}
+
+// Node is an element of a Tree
+type Node interface {
+	// Range locates the node within the source
+	Range() source.Range
+}
+
+// TextNode is literal template text
+type TextNode struct {
+	Token lexer.Token
+	// Text is the text written, which may be empty when only standalone whitespace remains
+	Text string
+}
+
+// VariableNode is an interpolation: {{name}}, {{&name}} or {{{name}}}
+type VariableNode struct {
+	Token  lexer.Token
+	Name   string
+	Escape bool
+}
+
+// SectionNode is a section {{#name}}...{{/name}} or an inverted section {{^name}}...{{/name}}
+type SectionNode struct {
+	Token    lexer.Token
+	Close    lexer.Token
+	Name     string
+	Inverted bool
+	Nodes    []Node
+	// Raw is the unrendered text of the section passed to lambdas
+	Raw string
+}
+
+// CommentNode is a comment: {{! text}}
+type CommentNode struct {
+	Token lexer.Token
+}
+
+// PartialNode includes another template: {{> name}}. A dynamic partial, {{>*name}}, includes
+// the template named by the context value Name.
+type PartialNode struct {
+	Token   lexer.Token
+	Name    string
+	Dynamic bool
+}
+
+// TranslateNode is a translated message: {{_ key}}
+type TranslateNode struct {
+	Token lexer.Token
+	Key   string
+}
+
+func (n *TextNode) Range() source.Range      { return n.Token.Data.Range }
+func (n *VariableNode) Range() source.Range  { return n.Token.Data.Range }
+func (n *SectionNode) Range() source.Range   { return n.Token.Data.Range }
+func (n *CommentNode) Range() source.Range   { return n.Token.Data.Range }
+func (n *PartialNode) Range() source.Range   { return n.Token.Data.Range }
+func (n *TranslateNode) Range() source.Range { return n.Token.Data.Range }
+
+// Error locates a parse error at the tag that caused it
+type Error struct {
+	Name  string
+	Range source.Range
+	Tag   string
+	Err   error
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s:%d:%d: %s : %s", e.Name, e.Range.Start.Line, e.Range.Start.Column, e.Tag, e.Err)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Parse lexes and parses src
+func Parse(src source.Source, options ...lexer.Option) (t *Tree, err error) {
+	var tokens []lexer.Token
+	if tokens, err = lexer.New(src, options...).Parse(); err != nil {
+		return
+	}
+	return Tokens(src.Name(), tokens)
+}
+
+// Tokens parses the tokens of the source name
+func Tokens(name string, tokens []lexer.Token) (t *Tree, err error) {
+	p := &parser{name: name}
+	t = &Tree{Name: name}
+	if t.Nodes, err = p.nodes(tokens); err != nil {
+		return nil, err
+	}
+	return
+}
+
+// Walk calls f for each node in depth first order, descending into a section when f returns true
+func Walk(nodes []Node, f func(n Node) bool) {
+	for _, n := range nodes {
+		if f(n) {
+			if s, ok := n.(*SectionNode); ok {
+				Walk(s.Nodes, f)
+			}
+		}
+	}
+}
+
+type parser struct {
+	name string
+}
+
+func (p *parser) errorAt(token lexer.Token, err error) error {
+	return &Error{Name: p.name, Range: token.Data.Range, Tag: token.Data.Str, Err: err}
+}
+
+// nodes follows the token handling of the renderer, sharing its whitespace and section rules
+func (p *parser) nodes(tokens []lexer.Token) (nodes []Node, err error) {
+	for i := 0; i < len(tokens); i++ {
+		token := tokens[i]
+		mods, value := token.Value()
+
+		switch {
+		case mods.HasModifier(lexer.CommentModifier):
+			nodes = append(nodes, &CommentNode{Token: token})
+		case token.IsChar():
+			nodes = append(nodes, &TextNode{Token: token, Text: lexer.TrimStandalone(tokens, i)})
+		case token.IsThreeBracket():
+			nodes = append(nodes, &VariableNode{Token: token, Name: value})
+		case mods.HasModifier(lexer.ImportModifier):
+			partial := &PartialNode{Token: token}
+			partial.Name, partial.Dynamic = lexer.PartialName(value)
+			nodes = append(nodes, partial)
+		case mods.HasModifier(lexer.TranslateModifier):
+			nodes = append(nodes, &TranslateNode{Token: token, Key: strings.TrimSpace(value)})
+		case mods.HasModifier(lexer.HashModifier, lexer.InvertedModifier):
+			var section *SectionNode
+			if section, i, err = p.section(tokens, i); err != nil {
+				return
+			}
+			nodes = append(nodes, section)
+		case mods.HasModifier(lexer.CloseModifier):
+			return nil, p.errorAt(token, ErrUnexpectedClose)
+		default:
+			nodes = append(nodes, &VariableNode{Token: token, Name: value, Escape: !mods.HasModifier(lexer.AmpModifier)})
+		}
+	}
+	return
+}
+
+// section parses the section opened at tokens[open], returning the index of the close tag
+func (p *parser) section(tokens []lexer.Token, open int) (section *SectionNode, end int, err error) {
+	token := tokens[open]
+	mods, value := token.Value()
+
+	if end = lexer.CloseOf(tokens, open); end == -1 {
+		return nil, end, p.errorAt(token, ErrMissingClose)
+	}
+	if value == "if" {
+		return nil, end, p.errorAt(token, ErrUnsupportedTag)
+	}
+
+	nested := lexer.SectionBody(tokens, open, end)
+	section = &SectionNode{
+		Token:    token,
+		Close:    tokens[end],
+		Name:     value,
+		Inverted: mods.HasModifier(lexer.InvertedModifier),
+		Raw:      lexer.RawText(nested),
+	}
+	section.Nodes, err = p.nodes(nested)
+	return
+}
@@ -0,0 +1,103 @@
+package parse
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/mlctrez/mystace/internal/testify"
+	"github.com/mlctrez/mystace/lexer"
+	"github.com/mlctrez/mystace/source"
+)
+
+func parseString(template string) (*Tree, error) {
+	src, err := source.FromString(template, source.WithName("test"))
+	if err != nil {
+		return nil, err
+	}
+	return Parse(src)
+}
+
+func TestParse(t *testing.T) {
+	require := testify.Require(t)
+
+	tree, err := parseString("Hi {{name}} {{&raw}}{{{raw}}}\n{{! note }}\n{{#items}}\n{{.}}\n{{/items}}{{^items}}none{{/items}}{{> footer }}{{_ greeting }}")
+	require.Nil(err)
+	require.Equal("test", tree.Name)
+	require.Len(tree.Nodes, 12)
+
+	require.Equal("Hi ", tree.Nodes[0].(*TextNode).Text)
+	require.Equal(&VariableNode{Token: tree.Nodes[1].(*VariableNode).Token, Name: "name", Escape: true}, tree.Nodes[1])
+	require.False(tree.Nodes[3].(*VariableNode).Escape)
+	require.False(tree.Nodes[4].(*VariableNode).Escape)
+	require.Equal("raw", tree.Nodes[4].(*VariableNode).Name)
+
+	require.IsType(&CommentNode{}, tree.Nodes[6])
+	require.Equal("\n", tree.Nodes[7].(*TextNode).Text)
+
+	section := tree.Nodes[8].(*SectionNode)
+	require.Equal("items", section.Name)
+	require.False(section.Inverted)
+	require.Equal("{{.}}\n", section.Raw)
+	require.Equal("{{/items}}", section.Close.Data.Str)
+	require.Len(section.Nodes, 2)
+	require.Equal(3, section.Range().Start.Line)
+
+	require.True(tree.Nodes[9].(*SectionNode).Inverted)
+	require.Equal("footer", tree.Nodes[10].(*PartialNode).Name)
+	require.Equal("greeting", tree.Nodes[11].(*TranslateNode).Key)
+
+	tree, err = parseString("{{>*widget}}")
+	require.Nil(err)
+	require.Equal("widget", tree.Nodes[0].(*PartialNode).Name)
+	require.True(tree.Nodes[0].(*PartialNode).Dynamic)
+
+	// whitespace around a standalone comment is removed as the renderer does
+	tree, err = parseString("a\n{{! note }}\nb")
+	require.Nil(err)
+	require.Equal("a\n", tree.Nodes[0].(*TextNode).Text)
+	require.Equal("b", tree.Nodes[2].(*TextNode).Text)
+}
+
+func TestParse_Errors(t *testing.T) {
+	require := testify.Require(t)
+
+	_, err := parseString("a\n{{#open}}")
+	require.ErrorIs(err, ErrMissingClose)
+	var parseError *Error
+	require.True(errors.As(err, &parseError))
+	require.Equal("test", parseError.Name)
+	require.Equal(2, parseError.Range.Start.Line)
+	require.Equal("test:2:1: {{#open}} : missing close tag", err.Error())
+
+	_, err = parseString("{{/close}}")
+	require.ErrorIs(err, ErrUnexpectedClose)
+
+	_, err = parseString("{{#a}}{{/b}}{{/a}}")
+	require.ErrorIs(err, ErrMissingClose)
+
+	_, err = parseString("{{#if}}{{/if}}")
+	require.ErrorIs(err, ErrUnsupportedTag)
+
+	_, err = parseString("{{")
+	require.ErrorIs(err, lexer.ErrMissingEndToken)
+}
+
+func TestWalk(t *testing.T) {
+	require := testify.Require(t)
+
+	tree, err := parseString("{{#a}}{{#b}}{{c}}{{/b}}{{/a}}{{d}}")
+	require.Nil(err)
+
+	var names []string
+	Walk(tree.Nodes, func(n Node) bool {
+		switch nt := n.(type) {
+		case *SectionNode:
+			names = append(names, nt.Name)
+			return nt.Name != "b"
+		case *VariableNode:
+			names = append(names, nt.Name)
+		}
+		return true
+	})
+	require.Equal([]string{"a", "b", "d"}, names)
+}
@@ -0,0 +1,60 @@
+package render
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+)
+
+// DefaultFlushThreshold is the number of buffered bytes written to the writer of a render
+// at once, the default of bufio
+const DefaultFlushThreshold = 4096
+
+// WithFlushThreshold buffers the output of each render and writes it when at least size bytes
+// are buffered, and once more at the end of a successful render. 0 writes every token.
+func WithFlushThreshold(size int) Option {
+	return func(r *render) error {
+		if size < 0 {
+			return fmt.Errorf("negative flush threshold %d", size)
+		}
+		r.flushThreshold = size
+		return nil
+	}
+}
+
+// bufferedWriter coalesces the writes of a render
+type bufferedWriter struct {
+	w         io.Writer
+	buf       *bytes.Buffer
+	threshold int
+}
+
+func newBufferedWriter(w io.Writer, threshold int) *bufferedWriter {
+	return &bufferedWriter{w: w, buf: buffers.Get().(*bytes.Buffer), threshold: threshold}
+}
+
+func (bw *bufferedWriter) Write(p []byte) (int, error) {
+	bw.buf.Write(p)
+	if bw.buf.Len() >= bw.threshold {
+		if err := bw.flush(); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// flush writes the buffered output
+func (bw *bufferedWriter) flush() error {
+	if bw.buf.Len() == 0 {
+		return nil
+	}
+	_, err := bw.w.Write(bw.buf.Bytes())
+	bw.buf.Reset()
+	return err
+}
+
+// release discards the output not flushed
+func (bw *bufferedWriter) release() {
+	release(bw.buf)
+	bw.buf = nil
+}
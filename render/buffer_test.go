@@ -0,0 +1,81 @@
+package render
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/mlctrez/mystace/context"
+	"github.com/mlctrez/mystace/internal/testify"
+)
+
+// recordingWriter records each write
+type recordingWriter struct {
+	writes []string
+	err    error
+}
+
+func (w *recordingWriter) Write(p []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	w.writes = append(w.writes, string(p))
+	return len(p), nil
+}
+
+func TestWithFlushThreshold(t *testing.T) {
+	_, require := testify.New(t)
+
+	items := func(n int) *context.Context {
+		var list []interface{}
+		for i := 0; i < n; i++ {
+			list = append(list, map[string]interface{}{"name": "abcd"})
+		}
+		return context.New(map[string]interface{}{"items": list})
+	}
+	templates := []string{"list", "<{{#items}}{{name}},{{/items}}>"}
+
+	// small outputs are written at once
+	w := &recordingWriter{}
+	r := withTemplates(t, templates...)
+	r.Writer(w)
+	require.Nil(r.Render("list", items(3)))
+	require.Equal([]string{"<abcd,abcd,abcd,>"}, w.writes)
+
+	w = &recordingWriter{}
+	r = New(WithFlushThreshold(8))
+	require.Nil(addSources(r, templates...))
+	r.Writer(w)
+	require.Nil(r.Render("list", items(3)))
+	require.Equal([]string{"<abcd,abcd", ",abcd,>"}, w.writes)
+
+	w = &recordingWriter{}
+	r = New(WithFlushThreshold(0))
+	require.Nil(addSources(r, templates...))
+	r.Writer(w)
+	require.Nil(r.Render("list", items(1)))
+	require.Equal([]string{"<", "abcd", ",", ">"}, w.writes)
+
+	// a failed render writes the output flushed before the error only
+	fail := []string{"list", "{{#items}}{{name}}{{/items}}{{#missing}}{{/missing}}"}
+	w = &recordingWriter{}
+	r = New(WithFlushThreshold(6))
+	require.Nil(addSources(r, fail...))
+	r.Writer(w)
+	require.ErrorIs(r.Render("list", items(2)), ErrMissingName)
+	require.Equal([]string{"abcdabcd"}, w.writes)
+
+	w = &recordingWriter{}
+	r = withTemplates(t, fail...)
+	r.Writer(w)
+	require.ErrorIs(r.Render("list", items(2000)), ErrMissingName)
+	require.Equal(strings.Repeat("abcd", 2000)[:DefaultFlushThreshold], strings.Join(w.writes, ""))
+
+	// write errors are returned
+	w = &recordingWriter{err: fmt.Errorf("broken pipe")}
+	r = withTemplates(t, templates...)
+	r.Writer(w)
+	require.EqualError(r.Render("list", items(1)), "broken pipe")
+
+	require.NotNil(WithFlushThreshold(-1)(&render{}))
+}
@@ -0,0 +1,243 @@
+package render
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/mlctrez/mystace/lexer"
+)
+
+// DefaultMaxPartialDepth limits the nesting of partials when WithMaxPartialDepth is not used
+const DefaultMaxPartialDepth = 100
+
+var (
+	ErrPartialCycle = fmt.Errorf("partial cycle")
+	ErrPartialDepth = fmt.Errorf("partials nested too deeply")
+)
+
+// WithMaxPartialDepth allows partials that include themselves, directly or through others,
+// such as a tree view rendering the children of each node, and fails rendering partials
+// nested more than depth deep. Without it a source completing a cycle is rejected by AddSource.
+func WithMaxPartialDepth(depth int) Option {
+	return func(r *render) error {
+		if depth < 1 {
+			return fmt.Errorf("max partial depth %d is less than 1", depth)
+		}
+		r.maxPartialDepth = depth
+		return nil
+	}
+}
+
+// Graph is the partial dependency graph of the registered sources
+type Graph struct {
+	// Partials are the names of the partials each source includes, in order of first use
+	Partials map[string][]string `json:"partials"`
+	// Missing are the partials included but not registered
+	Missing []string `json:"missing,omitempty"`
+	// Cycles are the names of the sources of each cycle, starting with the first in order:
+	// [a b] is a including b including a
+	Cycles [][]string `json:"cycles,omitempty"`
+}
+
+// Graph returns the partial dependency graph of the sources registered with AddSource.
+// Sources with lexer errors include the partials read before the error. Dynamic partials
+// are named by the data and left out, their nesting is limited by the max partial depth.
+func (r *render) Graph() *Graph {
+	g := &Graph{Partials: map[string][]string{}}
+	missing := map[string]bool{}
+	for name := range r.sources {
+		partials := r.includes(name)
+		for _, p := range partials {
+			if _, ok := r.sources[p]; !ok {
+				missing[p] = true
+			}
+		}
+		g.Partials[name] = partials
+	}
+	for name := range missing {
+		g.Missing = append(g.Missing, name)
+	}
+	sort.Strings(g.Missing)
+	g.Cycles = g.cycles()
+	return g
+}
+
+// includes returns the names of the partials the source name includes, in order of first use
+func (r *render) includes(name string) []string {
+	tokens, _ := r.tokens(name)
+	partials := []string{}
+	seen := map[string]bool{}
+	for _, token := range tokens {
+		if token.IsChar() {
+			continue
+		}
+		mods, value := token.Value()
+		if !mods.HasModifier(lexer.ImportModifier) {
+			continue
+		}
+		value, dynamic := lexer.PartialName(value)
+		if dynamic || seen[value] {
+			continue
+		}
+		seen[value] = true
+		partials = append(partials, value)
+	}
+	return partials
+}
+
+// cycleError describes the shortest cycle through name. Only the sources name includes,
+// directly or through others, are searched, so adding a source does not lex every other.
+func (r *render) cycleError(name string) error {
+	from := map[string]string{}
+	queue := []string{name}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		for _, p := range r.includes(current) {
+			if p == name {
+				path := []string{current, name}
+				for path[0] != name {
+					path = append([]string{from[path[0]]}, path...)
+				}
+				return fmt.Errorf("%s : %w", strings.Join(path, " > "), ErrPartialCycle)
+			}
+			if _, registered := r.sources[p]; !registered {
+				continue
+			}
+			if _, seen := from[p]; !seen {
+				from[p] = current
+				queue = append(queue, p)
+			}
+		}
+	}
+	return nil
+}
+
+// names returns the registered sources in order
+func (g *Graph) names() []string {
+	names := make([]string, 0, len(g.Partials))
+	for name := range g.Partials {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// cycles returns the shortest cycle through the first source of each strongly connected
+// group of sources that include each other
+func (g *Graph) cycles() (cycles [][]string) {
+	index := map[string]int{}
+	low := map[string]int{}
+	onStack := map[string]bool{}
+	var stack []string
+	var groups [][]string
+
+	var connect func(name string)
+	connect = func(name string) {
+		index[name], low[name] = len(index), len(index)
+		stack = append(stack, name)
+		onStack[name] = true
+		for _, p := range g.Partials[name] {
+			if _, registered := g.Partials[p]; !registered {
+				continue
+			}
+			if _, visited := index[p]; !visited {
+				connect(p)
+				if low[p] < low[name] {
+					low[name] = low[p]
+				}
+			} else if onStack[p] && index[p] < low[name] {
+				low[name] = index[p]
+			}
+		}
+		if low[name] != index[name] {
+			return
+		}
+		var group []string
+		for {
+			top := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			onStack[top] = false
+			group = append(group, top)
+			if top == name {
+				break
+			}
+		}
+		groups = append(groups, group)
+	}
+	for _, name := range g.names() {
+		if _, visited := index[name]; !visited {
+			connect(name)
+		}
+	}
+
+	for _, group := range groups {
+		sort.Strings(group)
+		if cycle := g.shortestCycle(group); cycle != nil {
+			cycles = append(cycles, cycle)
+		}
+	}
+	sort.Slice(cycles, func(i, j int) bool { return cycles[i][0] < cycles[j][0] })
+	return
+}
+
+// shortestCycle searches breadth first for the shortest path from the first name of group back to it
+func (g *Graph) shortestCycle(group []string) []string {
+	start := group[0]
+	in := map[string]bool{}
+	for _, name := range group {
+		in[name] = true
+	}
+	from := map[string]string{}
+	queue := []string{start}
+	for len(queue) > 0 {
+		name := queue[0]
+		queue = queue[1:]
+		for _, p := range g.Partials[name] {
+			if p == start {
+				cycle := []string{name}
+				for cycle[0] != start {
+					cycle = append([]string{from[cycle[0]]}, cycle...)
+				}
+				return cycle
+			}
+			if _, seen := from[p]; !seen && in[p] {
+				from[p] = name
+				queue = append(queue, p)
+			}
+		}
+	}
+	return nil
+}
+
+// WriteDOT writes the graph in the Graphviz DOT language, missing partials are dashed
+// and the includes of cycles are red
+func (g *Graph) WriteDOT(w io.Writer) (err error) {
+	inCycle := map[[2]string]bool{}
+	for _, cycle := range g.Cycles {
+		for i, name := range cycle {
+			inCycle[[2]string{name, cycle[(i+1)%len(cycle)]}] = true
+		}
+	}
+	lines := []string{"digraph partials {"}
+	for _, name := range g.names() {
+		lines = append(lines, fmt.Sprintf("\t%q;", name))
+	}
+	for _, name := range g.Missing {
+		lines = append(lines, fmt.Sprintf("\t%q [style=dashed];", name))
+	}
+	for _, name := range g.names() {
+		for _, p := range g.Partials[name] {
+			if inCycle[[2]string{name, p}] {
+				lines = append(lines, fmt.Sprintf("\t%q -> %q [color=red];", name, p))
+			} else {
+				lines = append(lines, fmt.Sprintf("\t%q -> %q;", name, p))
+			}
+		}
+	}
+	lines = append(lines, "}\n")
+	_, err = io.WriteString(w, strings.Join(lines, "\n"))
+	return
+}
@@ -0,0 +1,91 @@
+package render
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/mlctrez/mystace/internal/testify"
+	"github.com/mlctrez/mystace/source"
+)
+
+// addSources adds the templates given as name and text pairs, returning the first error
+func addSources(r Render, templates ...string) error {
+	for i := 0; i < len(templates); i += 2 {
+		src, err := source.FromString(templates[i+1], source.WithName(templates[i]))
+		if err != nil {
+			return err
+		}
+		if err = r.AddSource(src); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestRender_Graph(t *testing.T) {
+	_, require := testify.New(t)
+
+	r := withTemplates(t, "page", "{{> header}}{{#items}}{{> card}}{{/items}}{{> header}}", "header", "{{> logo}}", "card", "{{name}}")
+	g := r.Graph()
+	require.Equal(map[string][]string{"page": {"header", "card"}, "header": {"logo"}, "card": {}}, g.Partials)
+	require.Equal([]string{"logo"}, g.Missing)
+	require.Empty(g.Cycles)
+
+	buf := &bytes.Buffer{}
+	require.Nil(g.WriteDOT(buf))
+	require.Equal("digraph partials {\n\t\"card\";\n\t\"header\";\n\t\"page\";\n\t\"logo\" [style=dashed];\n"+
+		"\t\"header\" -> \"logo\";\n\t\"page\" -> \"header\";\n\t\"page\" -> \"card\";\n}\n", buf.String())
+}
+
+func TestRender_AddSourceCycle(t *testing.T) {
+	_, require := testify.New(t)
+
+	r := New()
+	require.Nil(addSources(r, "a", "{{> b}}", "b", "{{> c}}"))
+	err := addSources(r, "c", "{{#x}}{{> a}}{{/x}}")
+	require.ErrorIs(err, ErrPartialCycle)
+	require.Equal("c > a > b > c : partial cycle", err.Error())
+	// the rejected source is not registered
+	require.Equal(map[string][]string{"a": {"b"}, "b": {"c"}}, r.Graph().Partials)
+	require.Nil(addSources(r, "c", "end"))
+
+	require.ErrorIs(addSources(New(), "self", "{{> self}}"), ErrPartialCycle)
+
+	// only the sources included by the added source are searched
+	r = New()
+	require.Nil(addSources(r, "x", "{{> y}}", "y", "{{> z}}", "unrelated", "{{> x}}"))
+	parsed := r.(*render).parsed.tokens
+	delete(parsed, "unrelated")
+	require.ErrorIs(addSources(r, "z", "{{> x}}"), ErrPartialCycle)
+	require.Contains(parsed, "x")
+	require.NotContains(parsed, "unrelated")
+}
+
+func TestWithMaxPartialDepth(t *testing.T) {
+	_, require := testify.New(t)
+
+	tree := map[string]interface{}{"name": "root", "children": []interface{}{
+		map[string]interface{}{"name": "a", "children": []interface{}{
+			map[string]interface{}{"name": "b", "children": []interface{}{}},
+		}},
+	}}
+	templates := []string{"page", "{{> node}}", "node", "<{{name}}{{#children}}{{> node}}{{/children}}>"}
+
+	r := New(WithMaxPartialDepth(3))
+	require.Nil(addSources(r, templates...))
+	require.Equal([][]string{{"node"}}, r.Graph().Cycles)
+	out, err := renderSources(r, "page", tree)
+	require.Nil(err)
+	require.Equal("<root<a<b>>>", out)
+
+	r = New(WithMaxPartialDepth(2))
+	require.Nil(addSources(r, templates...))
+	_, err = renderSources(r, "page", tree)
+	require.ErrorIs(err, ErrPartialDepth)
+	var renderError *RenderError
+	require.ErrorAs(err, &renderError)
+	require.Equal("node", renderError.Source)
+	require.Equal("{{> node}}", renderError.Tag)
+
+	require.NotNil(WithMaxPartialDepth(0)(&render{}))
+}
@@ -0,0 +1,110 @@
+package render
+
+import (
+	stdcontext "context"
+	"fmt"
+	"io"
+	"time"
+)
+
+var (
+	ErrSectionDepth = fmt.Errorf("sections nested too deeply")
+	ErrOutputSize   = fmt.Errorf("output too large")
+	ErrIterations   = fmt.Errorf("too many iterations")
+	ErrTimeout      = fmt.Errorf("render took too long")
+)
+
+// Limits bound the resources used by each call to Render, so templates and data from
+// untrusted users can be rendered safely. A zero field is no limit.
+type Limits struct {
+	// MaxSectionDepth limits the nesting of sections, counting those of including templates
+	MaxSectionDepth int
+	// MaxOutputBytes limits the bytes written
+	MaxOutputBytes int64
+	// MaxIterations limits the list items rendered by all sections
+	MaxIterations int
+	// MaxPartialDepth limits the nesting of partials below DefaultMaxPartialDepth
+	// or the depth set by WithMaxPartialDepth
+	MaxPartialDepth int
+	// MaxDuration limits the time spent rendering, checked before each tag and list item
+	MaxDuration time.Duration
+}
+
+// WithLimits fails rendering with ErrSectionDepth, ErrOutputSize, ErrIterations,
+// ErrPartialDepth or ErrTimeout when a limit is exceeded
+func WithLimits(limits Limits) Option {
+	return func(r *render) error {
+		if limits.MaxSectionDepth < 0 || limits.MaxOutputBytes < 0 || limits.MaxIterations < 0 ||
+			limits.MaxPartialDepth < 0 || limits.MaxDuration < 0 {
+			return fmt.Errorf("negative limit in %+v", limits)
+		}
+		r.limits = limits
+		return nil
+	}
+}
+
+// budget tracks the resources used by one call to Render
+type budget struct {
+	done       stdcontext.Context
+	limits     Limits
+	written    int64
+	iterations int
+	deadline   time.Time
+}
+
+func newBudget(done stdcontext.Context, limits Limits) *budget {
+	b := &budget{done: done, limits: limits}
+	if limits.MaxDuration > 0 {
+		b.deadline = time.Now().Add(limits.MaxDuration)
+	}
+	return b
+}
+
+// check fails once the render is cancelled or has run out of time
+func (b *budget) check() error {
+	if err := b.done.Err(); err != nil {
+		return err
+	}
+	if !b.deadline.IsZero() && time.Now().After(b.deadline) {
+		return fmt.Errorf("limit %s : %w", b.limits.MaxDuration, ErrTimeout)
+	}
+	return nil
+}
+
+// iterate counts a list item
+func (b *budget) iterate() error {
+	b.iterations++
+	if b.limits.MaxIterations > 0 && b.iterations > b.limits.MaxIterations {
+		return fmt.Errorf("limit %d : %w", b.limits.MaxIterations, ErrIterations)
+	}
+	return b.check()
+}
+
+// enter checks the depth of a section
+func (b *budget) enter(depth int) error {
+	if b.limits.MaxSectionDepth > 0 && depth > b.limits.MaxSectionDepth {
+		return fmt.Errorf("depth %d, limit %d : %w", depth, b.limits.MaxSectionDepth, ErrSectionDepth)
+	}
+	return nil
+}
+
+// limitWriter counts the bytes written to the writer of a render
+type limitWriter struct {
+	w io.Writer
+	b *budget
+}
+
+func (lw *limitWriter) Write(p []byte) (n int, err error) {
+	max := lw.b.limits.MaxOutputBytes
+	if max > 0 && lw.b.written+int64(len(p)) > max {
+		n, err = lw.w.Write(p[:max-lw.b.written])
+		lw.b.written += int64(n)
+		if err == nil {
+			err = fmt.Errorf("limit %d bytes : %w", max, ErrOutputSize)
+		}
+		return
+	}
+	n, err = lw.w.Write(p)
+	lw.b.written += int64(n)
+	return
+}
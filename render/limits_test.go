@@ -0,0 +1,88 @@
+package render
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mlctrez/mystace/context"
+	"github.com/mlctrez/mystace/internal/testify"
+)
+
+func withLimits(t *testing.T, limits Limits, templates ...string) Render {
+	_, require := testify.New(t)
+	r := New(WithLimits(limits), WithMaxPartialDepth(DefaultMaxPartialDepth))
+	require.Nil(addSources(r, templates...))
+	return r
+}
+
+func TestWithLimits(t *testing.T) {
+	_, require := testify.New(t)
+
+	items := func(n int) map[string]interface{} {
+		var list []interface{}
+		for i := 0; i < n; i++ {
+			list = append(list, map[string]interface{}{"name": "ab"})
+		}
+		return map[string]interface{}{"items": list, "a": map[string]interface{}{"b": map[string]interface{}{"c": true}}}
+	}
+	list := []string{"list", "{{#items}}{{name}}{{/items}}"}
+
+	out, err := renderSources(withLimits(t, Limits{MaxIterations: 3, MaxOutputBytes: 6}, list...), "list", items(3))
+	require.Nil(err)
+	require.Equal("ababab", out)
+
+	_, err = renderSources(withLimits(t, Limits{MaxIterations: 3}, list...), "list", items(4))
+	require.ErrorIs(err, ErrIterations)
+	require.Equal("list:1:1: {{#items}} : limit 3 : too many iterations", err.Error())
+
+	// iterations are counted across sections and renders start again
+	r := withLimits(t, Limits{MaxIterations: 3}, "twice", "{{#items}}{{/items}}{{#items}}{{/items}}")
+	_, err = renderSources(r, "twice", items(2))
+	require.ErrorIs(err, ErrIterations)
+	_, err = renderSources(r, "twice", items(1))
+	require.Nil(err)
+
+	out, err = renderSources(withLimits(t, Limits{MaxOutputBytes: 5}, list...), "list", items(3))
+	require.ErrorIs(err, ErrOutputSize)
+	// the buffered output of a failed render is discarded
+	require.Empty(out)
+
+	nested := []string{"nested", "{{#a}}{{#b}}{{> inner}}{{/b}}{{/a}}", "inner", "{{#c}}c{{/c}}"}
+	out, err = renderSources(withLimits(t, Limits{MaxSectionDepth: 3}, nested...), "nested", items(0))
+	require.Nil(err)
+	require.Equal("c", out)
+	_, err = renderSources(withLimits(t, Limits{MaxSectionDepth: 2}, nested...), "nested", items(0))
+	require.ErrorIs(err, ErrSectionDepth)
+	var renderError *RenderError
+	require.ErrorAs(err, &renderError)
+	require.Equal("inner", renderError.Source)
+
+	tree := []string{"node", "{{#child}}{{> node}}{{/child}}"}
+	deep := map[string]interface{}{"child": false}
+	for i := 0; i < 5; i++ {
+		deep = map[string]interface{}{"child": deep}
+	}
+	_, err = renderSources(withLimits(t, Limits{}, tree...), "node", deep)
+	require.Nil(err)
+	_, err = renderSources(withLimits(t, Limits{MaxPartialDepth: 3}, tree...), "node", deep)
+	require.ErrorIs(err, ErrPartialDepth)
+
+	require.NotNil(WithLimits(Limits{MaxIterations: -1})(&render{}))
+}
+
+func TestWithLimits_Timeout(t *testing.T) {
+	_, require := testify.New(t)
+
+	slow := context.Lambda(func(text string, ctx *context.Context, render context.RenderFunc) (string, error) {
+		time.Sleep(5 * time.Millisecond)
+		return "x", nil
+	})
+	r := withLimits(t, Limits{MaxDuration: 20 * time.Millisecond}, "slow", strings.Repeat("{{slow}}", 100))
+	buf := &bytes.Buffer{}
+	r.Writer(buf)
+	err := r.Render("slow", context.New(map[string]interface{}{"slow": slow}))
+	require.ErrorIs(err, ErrTimeout)
+	require.Less(buf.Len(), 100)
+}
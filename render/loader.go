@@ -0,0 +1,214 @@
+package render
+
+import (
+	stdcontext "context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"sync"
+	"time"
+
+	"github.com/mlctrez/mystace/lexer"
+	"github.com/mlctrez/mystace/source"
+)
+
+// PartialLoader loads the templates of names not registered with AddSource, such as from a
+// database or a file system. Load returns an error wrapping ErrSourceNameNotFound, or a nil
+// source, when it has no template for name, other errors fail the render.
+type PartialLoader interface {
+	Load(name string) (source.Source, error)
+}
+
+// ContextLoader is a PartialLoader that stops loading when the render needing the template
+// is, LoadContext is called instead of Load with the context given to RenderContext
+type ContextLoader interface {
+	PartialLoader
+	LoadContext(ctx stdcontext.Context, name string) (source.Source, error)
+}
+
+// PartialLoaderFunc adapts a function to a PartialLoader
+type PartialLoaderFunc func(name string) (source.Source, error)
+
+func (f PartialLoaderFunc) Load(name string) (source.Source, error) {
+	return f(name)
+}
+
+// ContextLoaderFunc adapts a function to a ContextLoader, Load passes context.Background
+type ContextLoaderFunc func(ctx stdcontext.Context, name string) (source.Source, error)
+
+func (f ContextLoaderFunc) Load(name string) (source.Source, error) {
+	return f(stdcontext.Background(), name)
+}
+
+func (f ContextLoaderFunc) LoadContext(ctx stdcontext.Context, name string) (source.Source, error) {
+	return f(ctx, name)
+}
+
+// FSLoader loads the file name followed by ext from fsys: {{> partials/card}} reads partials/card.mustache
+func FSLoader(fsys fs.FS, ext string) PartialLoader {
+	return PartialLoaderFunc(func(name string) (source.Source, error) {
+		path := name + ext
+		if !fs.ValidPath(path) {
+			return nil, fmt.Errorf("name %q : %w", name, ErrSourceNameNotFound)
+		}
+		data, err := fs.ReadFile(fsys, path)
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("file %q : %w", path, ErrSourceNameNotFound)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return source.FromString(string(data), source.WithName(name))
+	})
+}
+
+// CacheForever keeps the results of a loader until the renderer is discarded
+const CacheForever time.Duration = -1
+
+// CachePolicy sets how long the results of a loader are kept, 0 loads a name on every use
+type CachePolicy struct {
+	// TTL keeps loaded templates, and their lexer errors, for the duration or CacheForever
+	TTL time.Duration
+	// NegativeTTL remembers the names a loader has no template for, for the duration or CacheForever
+	NegativeTTL time.Duration
+}
+
+// DefaultCachePolicy keeps loaded templates and remembers missing names for a minute
+var DefaultCachePolicy = CachePolicy{TTL: CacheForever, NegativeTTL: time.Minute}
+
+// WithPartialLoader consults loader for partials and templates that are not registered with
+// AddSource, keeping its results as set by policy
+func WithPartialLoader(loader PartialLoader, policy CachePolicy) Option {
+	return func(r *render) error {
+		if loader == nil {
+			return fmt.Errorf("nil partial loader")
+		}
+		r.loader = &cachingLoader{loader: loader, policy: policy, now: time.Now,
+			cache: map[string]loaded{}, loading: map[string]*loading{}}
+		return nil
+	}
+}
+
+// cachingLoader is shared by the copies of a renderer
+type cachingLoader struct {
+	loader PartialLoader
+	policy CachePolicy
+	now    func() time.Time
+	mu     sync.Mutex
+	cache  map[string]loaded
+	// loading are the loads in progress by name, renders needing the same name wait for them
+	loading map[string]*loading
+}
+
+// loaded is the result of loading a name, the zero expiry never expires
+type loaded struct {
+	tokens  []lexer.Token
+	found   bool
+	err     error
+	expires time.Time
+}
+
+// loading is a load in progress, done is closed once its result is set
+type loading struct {
+	done   chan struct{}
+	result loaded
+	// err is a failure of the loader, which is not cached
+	err error
+	// stopped is set when the loader failed as the render that started the load stopped
+	stopped bool
+}
+
+// load returns the tokens of the template name and whether the loader has one. Loads run
+// in their own goroutine without holding the cache, so a slow load only delays the renders
+// needing the same name, and those stop waiting when done is. A load stopped with the render
+// that started it is started again by the renders waiting for it.
+func (l *cachingLoader) load(done stdcontext.Context, name string, options []lexer.Option) ([]lexer.Token, bool, error) {
+	for {
+		l.mu.Lock()
+		if e, ok := l.cache[name]; ok && (e.expires.IsZero() || l.now().Before(e.expires)) {
+			l.mu.Unlock()
+			return e.tokens, e.found, e.err
+		}
+		in, waiting := l.loading[name]
+		if !waiting {
+			delete(l.cache, name)
+			in = &loading{done: make(chan struct{})}
+			l.loading[name] = in
+			go l.fetch(done, in, name, options)
+		}
+		l.mu.Unlock()
+
+		select {
+		case <-in.done:
+		case <-done.Done():
+			return nil, false, done.Err()
+		}
+		if in.stopped && done.Err() == nil {
+			continue
+		}
+		if in.err != nil {
+			return nil, false, in.err
+		}
+		return in.result.tokens, in.result.found, in.result.err
+	}
+}
+
+// fetch loads and lexes name, caching the result unless the loader fails
+func (l *cachingLoader) fetch(done stdcontext.Context, in *loading, name string, options []lexer.Option) {
+	defer close(in.done)
+	var src source.Source
+	var err error
+	if cl, ok := l.loader.(ContextLoader); ok {
+		src, err = cl.LoadContext(done, name)
+	} else {
+		src, err = l.loader.Load(name)
+	}
+	ttl := l.policy.TTL
+	switch {
+	case errors.Is(err, ErrSourceNameNotFound) || err == nil && src == nil:
+		ttl = l.policy.NegativeTTL
+	case err != nil:
+		// failures are not cached, the next use tries again
+		in.err = fmt.Errorf("load %q : %w", name, err)
+		in.stopped = done.Err() != nil
+	default:
+		in.result.found = true
+		if in.result.tokens, in.result.err = lexer.New(src, options...).Parse(); in.result.err != nil {
+			in.result.err = &RenderError{Source: name, Range: source.Range{Start: lexer.After(in.result.tokens)},
+				Tag: lexer.OpenDelimiter, Err: in.result.err}
+		}
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.loading, name)
+	if in.err == nil {
+		l.store(name, in.result, ttl)
+	}
+}
+
+func (l *cachingLoader) store(name string, e loaded, ttl time.Duration) {
+	switch {
+	case ttl == 0:
+		return
+	case ttl > 0:
+		e.expires = l.now().Add(ttl)
+	}
+	l.cache[name] = e
+}
+
+// find returns the tokens of the registered or loaded template name and whether it exists
+func (r *render) find(name string) (tokens []lexer.Token, found bool, err error) {
+	if _, found = r.sources[name]; found {
+		tokens, err = r.tokens(name)
+		return
+	}
+	if r.loader == nil {
+		return nil, false, nil
+	}
+	done := stdcontext.Background()
+	if r.budget != nil {
+		done = r.budget.done
+	}
+	return r.loader.load(done, name, r.lexerOptions)
+}
@@ -0,0 +1,213 @@
+package render
+
+import (
+	"bytes"
+	stdcontext "context"
+	"fmt"
+	"sync"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/mlctrez/mystace/context"
+	"github.com/mlctrez/mystace/internal/testify"
+	"github.com/mlctrez/mystace/source"
+)
+
+// countingLoader loads templates from a map and counts the loads of each name
+type countingLoader struct {
+	templates map[string]string
+	loads     map[string]int
+	err       error
+}
+
+func (l *countingLoader) Load(name string) (source.Source, error) {
+	l.loads[name]++
+	if l.err != nil {
+		return nil, l.err
+	}
+	text, ok := l.templates[name]
+	if !ok {
+		return nil, fmt.Errorf("no row %q : %w", name, ErrSourceNameNotFound)
+	}
+	return source.FromString(text, source.WithName(name))
+}
+
+func TestWithPartialLoader(t *testing.T) {
+	_, require := testify.New(t)
+
+	l := &countingLoader{templates: map[string]string{"card": "<{{name}}>", "page": "{{> card}}"}, loads: map[string]int{}}
+	r := New(WithPartialLoader(l, DefaultCachePolicy))
+	require.Nil(addSources(r, "list", "{{#items}}{{> card}}{{/items}}{{> missing}}"))
+	values := map[string]interface{}{"items": []interface{}{map[string]interface{}{"name": "a"}, map[string]interface{}{"name": "b"}}, "name": "c"}
+
+	out, err := renderSources(r, "list", values)
+	require.Nil(err)
+	require.Equal("<a><b>", out)
+	out, err = renderSources(r, "list", values)
+	require.Nil(err)
+	require.Equal("<a><b>", out)
+	require.Equal(map[string]int{"card": 1, "missing": 1}, l.loads)
+
+	// templates rendered directly are loaded too
+	out, err = renderSources(r, "page", values)
+	require.Nil(err)
+	require.Equal("<c>", out)
+	_, err = renderSources(r, "nope", values)
+	require.ErrorIs(err, ErrSourceNameNotFound)
+
+	// failures are not cached
+	l.err = fmt.Errorf("database down")
+	_, err = renderSources(r, "other", values)
+	require.EqualError(err, `load "other" : database down`)
+	_, err = renderSources(r, "other", values)
+	require.NotNil(err)
+	require.Equal(2, l.loads["other"])
+	require.NotNil(WithPartialLoader(nil, DefaultCachePolicy)(&render{}))
+}
+
+func TestCachePolicy(t *testing.T) {
+	_, require := testify.New(t)
+
+	l := &countingLoader{templates: map[string]string{"card": "card"}, loads: map[string]int{}}
+	r := New(WithPartialLoader(l, CachePolicy{TTL: time.Minute, NegativeTTL: 0}))
+	now := time.Unix(0, 0)
+	r.(*render).loader.now = func() time.Time { return now }
+	require.Nil(addSources(r, "page", "{{> card}}{{> missing}}"))
+
+	check := func() {
+		out, err := renderSources(r, "page", nil)
+		require.Nil(err)
+		require.Equal("card", out)
+	}
+	check()
+	check()
+	require.Equal(map[string]int{"card": 1, "missing": 2}, l.loads)
+
+	now = now.Add(time.Minute)
+	check()
+	require.Equal(2, l.loads["card"])
+
+	// the negative cache keeps a name missing after the loader gains its template
+	r = New(WithPartialLoader(l, CachePolicy{NegativeTTL: CacheForever}))
+	require.Nil(addSources(r, "page", "{{> missing}}"))
+	check = func() {
+		_, err := renderSources(r, "page", nil)
+		require.Nil(err)
+	}
+	check()
+	l.templates["missing"] = "found"
+	check()
+	require.Equal(4, l.loads["missing"])
+}
+
+func TestWithPartialLoader_Concurrent(t *testing.T) {
+	_, require := testify.New(t)
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	var mu sync.Mutex
+	loads := map[string]int{}
+	loader := PartialLoaderFunc(func(name string) (source.Source, error) {
+		mu.Lock()
+		loads[name]++
+		mu.Unlock()
+		if name == "slow" {
+			close(started)
+			<-release
+		}
+		return source.FromString("<"+name+">", source.WithName(name))
+	})
+	page, err := NewTemplate("page", "{{#slow}}{{> slow}}{{/slow}}{{> card}}", WithPartialLoader(loader, DefaultCachePolicy))
+	require.Nil(err)
+
+	slowPage := make(chan string)
+	go func() {
+		out, _ := page.String(context.New(map[string]interface{}{"slow": true}))
+		slowPage <- out
+	}()
+	<-started
+
+	// other names load while slow is loading
+	out, err := page.String(context.New(map[string]interface{}{"slow": false}))
+	require.Nil(err)
+	require.Equal("<card>", out)
+
+	// renders needing slow wait for the load in progress until they are stopped
+	done, cancel := stdcontext.WithTimeout(stdcontext.Background(), 10*time.Millisecond)
+	defer cancel()
+	r := *page.r
+	r.Writer(&bytes.Buffer{})
+	err = r.RenderContext(done, "page", context.New(map[string]interface{}{"slow": true}))
+	require.ErrorIs(err, stdcontext.DeadlineExceeded)
+
+	close(release)
+	require.Equal("<slow><card>", <-slowPage)
+	out, err = page.String(context.New(map[string]interface{}{"slow": true}))
+	require.Nil(err)
+	require.Equal("<slow><card>", out)
+	require.Equal(map[string]int{"slow": 1, "card": 1}, loads)
+}
+
+func TestContextLoader(t *testing.T) {
+	_, require := testify.New(t)
+
+	started := make(chan struct{})
+	var mu sync.Mutex
+	loads := 0
+	loader := ContextLoaderFunc(func(ctx stdcontext.Context, name string) (source.Source, error) {
+		mu.Lock()
+		loads++
+		first := loads == 1
+		mu.Unlock()
+		if first {
+			close(started)
+			<-ctx.Done()
+			return nil, ctx.Err()
+		}
+		return source.FromString("<"+name+">", source.WithName(name))
+	})
+	page, err := NewTemplate("page", "{{> card}}", WithPartialLoader(loader, DefaultCachePolicy))
+	require.Nil(err)
+
+	// the load stops with the render that started it
+	done, cancel := stdcontext.WithCancel(stdcontext.Background())
+	stopped := make(chan error)
+	go func() {
+		r := *page.r
+		r.Writer(&bytes.Buffer{})
+		stopped <- r.RenderContext(done, "page", context.New(nil))
+	}()
+	<-started
+
+	// a render waiting for it loads again
+	waiting := make(chan string)
+	go func() {
+		out, _ := page.String(context.New(nil))
+		waiting <- out
+	}()
+	time.Sleep(time.Millisecond)
+	cancel()
+	require.ErrorIs(<-stopped, stdcontext.Canceled)
+	require.Equal("<card>", <-waiting)
+	require.Equal(2, loads)
+
+	src, err := loader.Load("plain")
+	require.Nil(err)
+	require.Equal("plain", src.Name())
+}
+
+func TestFSLoader(t *testing.T) {
+	_, require := testify.New(t)
+
+	fsys := fstest.MapFS{"partials/card.mustache": {Data: []byte("<{{name}}>")}}
+	r := New(WithPartialLoader(FSLoader(fsys, ".mustache"), DefaultCachePolicy))
+	require.Nil(addSources(r, "page", "{{> partials/card}}{{> ../escape}}{{>*kind}}"))
+
+	out, err := renderSources(r, "page", map[string]interface{}{"name": "a", "kind": "partials/card"})
+	require.Nil(err)
+	require.Equal("<a><a>", out)
+
+	_, err = renderSources(r, "page", map[string]interface{}{"kind": "partials/chart"})
+	require.ErrorIs(err, ErrSourceNameNotFound)
+}
@@ -1,14 +1,21 @@
 package render
 
 import (
+	"bytes"
+	stdcontext "context"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"html"
 	"io"
 	"reflect"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/mlctrez/mystace/context"
+	"github.com/mlctrez/mystace/i18n"
 	"github.com/mlctrez/mystace/lexer"
+	"github.com/mlctrez/mystace/locale"
 	"github.com/mlctrez/mystace/source"
 )
 
@@ -16,16 +23,134 @@ type Render interface {
 	AddSource(src source.Source) (err error)
 	Writer(writer io.Writer)
 	Render(name string, context *context.Context) (err error)
+	// RenderContext renders like Render and stops with ctx.Err() when ctx is done
+	RenderContext(ctx stdcontext.Context, name string, context *context.Context) (err error)
+	// Validate checks that ctx holds the data the template name uses, without rendering
+	Validate(name string, ctx *context.Context) []Problem
+	// Graph returns the partials included by each registered source
+	Graph() *Graph
 }
 
 type render struct {
 	writer  io.Writer
 	sources map[string]source.Source
+	// parsed holds the tokens of sources, which can only be read once
+	parsed *parsed
+	// locale controls number and time formatting, nil keeps the locale independent output
+	locale *locale.Locale
+	// catalog provides the messages for {{_ key}} tags
+	catalog   *i18n.Catalog
+	fallbacks []string
+	// lookupOptions enable extensions to the spec name resolution
+	lookupOptions []context.LookupOption
+	// name is the source being rendered
+	name string
+	// strict makes missing variables and partials errors
+	strict bool
+	// escape replaces html escaping of {{name}} tags when set
+	escape func(s string) string
+	// lexerOptions are used to read every source
+	lexerOptions []lexer.Option
+	// maxPartialDepth allows recursive partials nested up to its depth when set
+	maxPartialDepth int
+	// depth is the number of partials being rendered
+	depth int
+	// loader provides the templates missing from sources when set
+	loader *cachingLoader
+	// limits bound each render, budget tracks the resources used by the current render
+	limits Limits
+	budget *budget
+	// sectionDepth is the number of sections being rendered
+	sectionDepth int
+	// flushThreshold is the size of the output buffered by a render, 0 writes every token
+	flushThreshold int
 }
 
-func New() Render {
-	return &render{
-		sources: make(map[string]source.Source),
+func New(options ...Option) Render {
+	r, _ := build(options...)
+	return r
+}
+
+// build returns a renderer with options applied and the first option error
+func build(options ...Option) (r *render, err error) {
+	r = &render{
+		sources:        make(map[string]source.Source),
+		parsed:         &parsed{tokens: map[string][]lexer.Token{}, errs: map[string]error{}},
+		flushThreshold: DefaultFlushThreshold,
+	}
+	for _, option := range options {
+		if optionErr := option(r); optionErr != nil && err == nil {
+			err = optionErr
+		}
+	}
+	return
+}
+
+type Option func(r *render) error
+
+// WithParentPaths enables the ../ prefix in names to look up values in outer frames: {{../name}}
+func WithParentPaths() Option {
+	return func(r *render) error {
+		r.lookupOptions = append(r.lookupOptions, context.ParentPaths())
+		return nil
+	}
+}
+
+// WithNumericIndexes enables addressing list items by index in dotted names: {{items.0.name}}
+func WithNumericIndexes() Option {
+	return func(r *render) error {
+		r.lookupOptions = append(r.lookupOptions, context.NumericIndexes())
+		return nil
+	}
+}
+
+// WithCatalog translates {{_ key}} tags with messages from c
+func WithCatalog(c *i18n.Catalog) Option {
+	return func(r *render) error {
+		r.catalog = c
+		return nil
+	}
+}
+
+// WithFallbackLocales sets the locales searched, in order, for messages missing from the locale set with WithLocale
+func WithFallbackLocales(tags ...string) Option {
+	return func(r *render) error {
+		r.fallbacks = tags
+		return nil
+	}
+}
+
+// WithStrict makes variables and partials missing from the context and sources an error
+// instead of rendering nothing. Sections missing from the context are an error either way.
+func WithStrict() Option {
+	return func(r *render) error {
+		r.strict = true
+		return nil
+	}
+}
+
+// WithEscaper escapes the values of {{name}} tags with escape instead of html escaping,
+// pass a function returning its argument to write values unchanged
+func WithEscaper(escape func(s string) string) Option {
+	return func(r *render) error {
+		r.escape = escape
+		return nil
+	}
+}
+
+// WithDelimiters reads sources using open and close instead of {{ and }}
+func WithDelimiters(open, close string) Option {
+	return func(r *render) error {
+		r.lexerOptions = append(r.lexerOptions, lexer.WithDelimiters(open, close))
+		return nil
+	}
+}
+
+// WithLocale formats numeric and time values using the conventions of l
+func WithLocale(l locale.Locale) Option {
+	return func(r *render) error {
+		r.locale = &l
+		return nil
 	}
 }
 
@@ -40,55 +165,137 @@ func (r *render) AddSource(src source.Source) (err error) {
 		return
 	}
 	r.sources[name] = src
+	if r.maxPartialDepth == 0 {
+		if err = r.cycleError(name); err != nil {
+			r.remove(name)
+		}
+	}
 	return
 }
 
+// remove forgets the source name and its tokens
+func (r *render) remove(name string) {
+	delete(r.sources, name)
+	r.parsed.mu.Lock()
+	defer r.parsed.mu.Unlock()
+	delete(r.parsed.tokens, name)
+	delete(r.parsed.errs, name)
+}
+
 var (
 	ErrSourceNameNotFound = fmt.Errorf("source name not found")
 	ErrNoWriter           = fmt.Errorf("no writer")
+	ErrNoCatalog          = fmt.Errorf("no message catalog")
+	ErrMissingName        = fmt.Errorf("missing var")
+	ErrMissingClose       = fmt.Errorf("unable to find close")
 )
 
 func (r *render) Writer(writer io.Writer) {
 	r.writer = writer
 }
 
-func (r *render) Render(name string, context *context.Context) (err error) {
+func (r *render) Render(name string, ctx *context.Context) (err error) {
+	return r.RenderContext(stdcontext.Background(), name, ctx)
+}
+
+// RenderContext checks ctx before each tag and list item, a render stopped by ctx returns
+// ctx.Err(). ctx is passed to context.LazyContext values and to a ContextLoader, other lazy
+// values run to completion before the render stops. A render stops waiting for a load when
+// ctx is done, a load that does not take ctx completes for later renders. Output is buffered
+// as set by WithFlushThreshold: a failed render discards the output buffered since the last
+// flush, so it writes nothing when its output is smaller than the threshold and a prefix of
+// its output when larger.
+func (r *render) RenderContext(done stdcontext.Context, name string, ctx *context.Context) (err error) {
+
+	if err = done.Err(); err != nil {
+		return
+	}
 
 	if r.writer == nil {
 		err = ErrNoWriter
 		return
 	}
 
-	if s, ok := r.sources[name]; !ok {
+	current := *r
+	current.name = name
+	current.budget = newBudget(done, r.limits)
+	var tokens []lexer.Token
+	var found bool
+	if tokens, found, err = current.find(name); err != nil {
+		return
+	}
+	if !found {
 		err = ErrSourceNameNotFound
 	} else {
-		var tokens []lexer.Token
-		if tokens, err = lexer.New(s).Parse(); err != nil {
-			return
+		var buffered *bufferedWriter
+		if r.flushThreshold > 0 {
+			buffered = newBufferedWriter(r.writer, r.flushThreshold)
+			defer buffered.release()
+			current.writer = buffered
+		}
+		if r.limits.MaxOutputBytes > 0 {
+			current.writer = &limitWriter{w: current.writer, b: current.budget}
+		}
+		// lazy values are evaluated at most once per render, and stop with it
+		current.lookupOptions = append(append([]context.LookupOption{}, r.lookupOptions...),
+			context.Memoize(context.NewMemo()), context.Until(done))
+		err = current.render(tokens, ctx)
+		if err == nil && buffered != nil {
+			err = buffered.flush()
+		}
+		if doneErr := done.Err(); doneErr != nil && errors.Is(err, doneErr) {
+			err = doneErr
 		}
-		err = r.render(tokens, context)
 	}
 	return
 }
 
-// canRemoveWhitespace determins if a comment exists at position <at> is on a different line
-func canRemoveWhitespace(tokens []lexer.Token, current int, at int) bool {
-	currentToken := tokens[current]
-	if at > -1 && at < len(tokens) {
-		maybe := tokens[at]
-		mods, _ := maybe.Value()
-		if mods.HasModifier(lexer.CommentModifier, lexer.HashModifier) {
-			if maybe.Line() != currentToken.Line() {
-				return true
-			}
-			_, value := currentToken.Value()
-			if current > at {
-				return len(value) > 1 && strings.HasPrefix(value, "\n")
-			}
-			return strings.TrimSpace(value) == ""
-		}
+// parsed caches the result of lexing each source
+type parsed struct {
+	mu     sync.Mutex
+	tokens map[string][]lexer.Token
+	errs   map[string]error
+}
+
+// tokens lexes the source name on first use
+func (r *render) tokens(name string) (tokens []lexer.Token, err error) {
+	r.parsed.mu.Lock()
+	defer r.parsed.mu.Unlock()
+	var ok bool
+	if tokens, ok = r.parsed.tokens[name]; ok {
+		return tokens, r.parsed.errs[name]
 	}
-	return false
+	if tokens, err = lexer.New(r.sources[name], r.lexerOptions...).Parse(); err != nil {
+		err = &RenderError{Source: name, Range: source.Range{Start: lexer.After(tokens)}, Tag: lexer.OpenDelimiter, Err: err}
+	}
+	r.parsed.tokens[name], r.parsed.errs[name] = tokens, err
+	return
+}
+
+// RenderError locates an error at the tag that caused it
+type RenderError struct {
+	// Source is the name of the rendered source
+	Source string
+	Range  source.Range
+	Tag    string
+	Err    error
+}
+
+func (e *RenderError) Error() string {
+	return fmt.Sprintf("%s:%d:%d: %s : %s", e.Source, e.Range.Start.Line, e.Range.Start.Column, e.Tag, e.Err)
+}
+
+func (e *RenderError) Unwrap() error {
+	return e.Err
+}
+
+// errorAt wraps err in a RenderError for token unless it already locates an error
+func (r *render) errorAt(token lexer.Token, err error) error {
+	var renderError *RenderError
+	if errors.As(err, &renderError) {
+		return err
+	}
+	return &RenderError{Source: r.name, Range: token.Data.Range, Tag: token.Data.Str, Err: err}
 }
 
 func (r *render) render(tokens []lexer.Token, ctx *context.Context) (err error) {
@@ -103,15 +310,15 @@ func (r *render) render(tokens []lexer.Token, ctx *context.Context) (err error)
 			continue
 		}
 
-		if token.IsChar() {
-
-			if canRemoveWhitespace(tokens, i, i-1) && strings.HasPrefix(value, "\n") {
-				value = strings.TrimPrefix(value, "\n")
-			}
-			if canRemoveWhitespace(tokens, i, i+1) && strings.HasSuffix(value, " ") {
-				value = strings.TrimRight(value, " ")
+		if !token.IsChar() && r.budget != nil {
+			if err = r.budget.check(); err != nil {
+				return r.errorAt(token, err)
 			}
+		}
 
+		if token.IsChar() {
+
+			value = lexer.TrimStandalone(tokens, i)
 			if _, err = r.writer.Write([]byte(value)); err != nil {
 				return
 			}
@@ -119,111 +326,83 @@ func (r *render) render(tokens []lexer.Token, ctx *context.Context) (err error)
 		}
 
 		if token.IsThreeBracket() {
-			if v, ok := ctx.Lookup(value); ok {
+			v, ok, lookupErr := r.lookup(ctx, value)
+			if lookupErr != nil {
+				return r.errorAt(token, lookupErr)
+			}
+			if ok {
+				if l, isLambda := asLambda(v); isLambda {
+					if v, err = r.callLambda(l, "", ctx); err != nil {
+						return
+					}
+				}
 				if err = r.writeValue(v, false); err != nil {
 					return
 				}
+			} else if r.strict {
+				return r.errorAt(token, ErrMissingName)
 			}
 			continue
 		}
 
 		if token.IsTwoBracket() {
 			if mods.HasModifier(lexer.ImportModifier) {
-				err = fmt.Errorf("implement me")
-				return
+				name, dynamic := lexer.PartialName(value)
+				if dynamic {
+					err = r.dynamicPartial(token, name, ctx)
+				} else {
+					err = r.partial(token, name, ctx)
+				}
+				if err != nil {
+					return
+				}
+				continue
 			}
 
-			if mods.HasModifier(lexer.HashModifier, lexer.InvertedModifier) {
-				// find matching close token for *this* token
-				openModifiers := 1
-				nextToken := -1
-				for j := i + 1; j < totalTokens; j++ {
-					aheadMods, aheadValue := tokens[j].Value()
-					if aheadMods.HasModifier(lexer.HashModifier, lexer.InvertedModifier) {
-						openModifiers++
-					}
-					if aheadMods.HasModifier(lexer.CloseModifier) {
-						openModifiers--
-						if openModifiers == 0 && aheadValue == value {
-							nextToken = j
-							break
-						}
-					}
+			if mods.HasModifier(lexer.TranslateModifier) {
+				if err = r.translate(strings.TrimSpace(value), ctx); err != nil {
+					return r.errorAt(token, err)
 				}
+				continue
+			}
+
+			if mods.HasModifier(lexer.HashModifier, lexer.InvertedModifier) {
+				nextToken := lexer.CloseOf(tokens, i)
 				if nextToken == -1 {
-					return fmt.Errorf("unable to find close for %s", token)
+					return r.errorAt(token, ErrMissingClose)
 				}
 				if value == "if" {
 					return fmt.Errorf("if not implemented yet %s", token)
 				}
 
-				nestedTokens := tokens[i+1 : nextToken]
+				nestedTokens := lexer.SectionBody(tokens, i, nextToken)
 				i = nextToken
 
-				if len(nestedTokens) > 0 {
-					if nestedTokens[0].Data.Str == "\n" {
-						nestedTokens = nestedTokens[1:]
-					}
+				v, ok, lookupErr := r.lookup(ctx, value)
+				if lookupErr != nil {
+					return r.errorAt(token, lookupErr)
 				}
-
-				if len(nestedTokens) > 2 {
-					if nestedTokens[len(nestedTokens)-1].Data.Str == "\n" {
-						nestedTokens = nestedTokens[:len(nestedTokens)-1]
+				nested := *r
+				nested.sectionDepth++
+				if r.budget != nil {
+					if err = r.budget.enter(nested.sectionDepth); err != nil {
+						return r.errorAt(token, err)
 					}
 				}
-
-				if v, ok := ctx.Lookup(value); ok {
-					if mods.HasModifier(lexer.HashModifier) {
-						switch vv := v.(type) {
-						case nil:
-						case bool:
-							if vv {
-								err = r.render(nestedTokens, ctx)
-							}
-						case map[string]interface{}:
-							nc := context.New(vv, ctx)
-							err = r.render(nestedTokens, nc)
-						case string, float64:
-							newValues := map[string]interface{}{".": vv}
-							nc := context.New(newValues, ctx)
-							err = r.render(nestedTokens, nc)
-						case []interface{}:
-							for _, nm := range vv {
-								if inm, oknm := nm.(map[string]interface{}); oknm {
-									nc := context.New(inm, ctx)
-									err = r.render(nestedTokens, nc)
-									if err != nil {
-										break
-									}
-								}
-							}
-						default:
-							err = fmt.Errorf("hash missing type %s at value %s", reflect.TypeOf(v), value)
-						}
-					}
-					if mods.HasModifier(lexer.InvertedModifier) {
-						switch vv := v.(type) {
-						case bool:
-							if !vv {
-								err = r.render(nestedTokens, ctx)
-							}
-						case nil:
-							err = r.render(nestedTokens, ctx)
-						case map[string]interface{}:
-						case []interface{}:
-							if len(vv) == 0 {
-								err = r.render(nestedTokens, ctx)
-							}
-						default:
-							err = fmt.Errorf("inverted add check for type %s", reflect.TypeOf(v))
-						}
-					}
+				if ok {
+					err = r.section(value, v, mods.HasModifier(lexer.InvertedModifier), ctx,
+						func(nc *context.Context) error {
+							return nested.render(nestedTokens, nc)
+						},
+						func(l context.Lambda) error {
+							return r.writeLambda(l, lexer.RawText(nestedTokens), ctx)
+						})
 				} else {
-					err = fmt.Errorf("missing var for %s", token)
+					err = r.errorAt(token, ErrMissingName)
 				}
 
 				if err != nil {
-					return err
+					return r.errorAt(token, err)
 				}
 				continue
 			}
@@ -233,10 +412,21 @@ func (r *render) render(tokens []lexer.Token, ctx *context.Context) (err error)
 				escaping = false
 			}
 
-			if v, ok := ctx.Lookup(value); ok {
+			v, ok, lookupErr := r.lookup(ctx, value)
+			if lookupErr != nil {
+				return r.errorAt(token, lookupErr)
+			}
+			if ok {
+				if l, isLambda := asLambda(v); isLambda {
+					if v, err = r.callLambda(l, "", ctx); err != nil {
+						return
+					}
+				}
 				if err = r.writeValue(v, escaping); err != nil {
 					return
 				}
+			} else if r.strict {
+				return r.errorAt(token, ErrMissingName)
 			}
 			continue
 		}
@@ -245,16 +435,247 @@ func (r *render) render(tokens []lexer.Token, ctx *context.Context) (err error)
 	return nil
 }
 
+// partial renders the source name with ctx, a missing source renders nothing unless strict
+func (r *render) partial(token lexer.Token, name string, ctx *context.Context) error {
+	tokens, found, err := r.find(name)
+	switch {
+	case err != nil:
+		return r.errorAt(token, err)
+	case !found && r.strict:
+		return r.errorAt(token, fmt.Errorf("partial %q : %w", name, ErrSourceNameNotFound))
+	case !found:
+		return nil
+	}
+	return r.include(token, name, tokens, ctx)
+}
+
+// dynamicPartial renders the source named by the context value name, which must exist
+func (r *render) dynamicPartial(token lexer.Token, name string, ctx *context.Context) error {
+	v, ok, err := r.lookup(ctx, name)
+	switch {
+	case err != nil:
+		return r.errorAt(token, err)
+	case (!ok || v == nil) && r.strict:
+		return r.errorAt(token, ErrMissingName)
+	case !ok || v == nil:
+		return nil
+	}
+	partial, isString := v.(string)
+	if !isString {
+		return r.errorAt(token, fmt.Errorf("partial name %q is %s, want string : %w", name, valueKindOf(v), ErrWrongType))
+	}
+	tokens, found, err := r.find(partial)
+	switch {
+	case err != nil:
+		return r.errorAt(token, err)
+	case !found:
+		return r.errorAt(token, fmt.Errorf("partial %q named by %q : %w", partial, name, ErrSourceNameNotFound))
+	}
+	return r.include(token, partial, tokens, ctx)
+}
+
+// include renders the tokens of the partial name one level deeper
+func (r *render) include(token lexer.Token, name string, tokens []lexer.Token, ctx *context.Context) error {
+	maxDepth := r.maxPartialDepth
+	if maxDepth == 0 {
+		maxDepth = DefaultMaxPartialDepth
+	}
+	if r.limits.MaxPartialDepth > 0 && r.limits.MaxPartialDepth < maxDepth {
+		maxDepth = r.limits.MaxPartialDepth
+	}
+	if r.depth >= maxDepth {
+		return r.errorAt(token, fmt.Errorf("partial %q at depth %d : %w", name, r.depth+1, ErrPartialDepth))
+	}
+	sub := *r
+	sub.name = name
+	sub.depth++
+	return sub.render(tokens, ctx)
+}
+
+// section calls body with each frame produced by the value v of the section name, or lambda when v is a
+// lambda. An inverted section calls body once with ctx when v is false, nil or an empty list.
+func (r *render) section(name string, v interface{}, inverted bool, ctx *context.Context,
+	body func(ctx *context.Context) error, lambda func(l context.Lambda) error) (err error) {
+
+	if !inverted {
+		switch vv := v.(type) {
+		case nil:
+		case bool:
+			if vv {
+				err = body(ctx)
+			}
+		case context.Lambda, func(string, *context.Context, context.RenderFunc) (string, error):
+			l, _ := asLambda(vv)
+			err = lambda(l)
+		case map[string]interface{}, context.Resolver:
+			err = body(ctx.Push(vv))
+		case string, float64, json.Number, int, int64:
+			err = body(ctx.With(context.ImplicitIterator, vv))
+		case []interface{}:
+			for _, nm := range vv {
+				if r.budget != nil {
+					if err = r.budget.iterate(); err != nil {
+						break
+					}
+				}
+				switch nm.(type) {
+				case map[string]interface{}, context.Resolver:
+					err = body(ctx.Push(nm))
+				}
+				if err != nil {
+					break
+				}
+			}
+		default:
+			err = fmt.Errorf("hash missing type %s at value %s", reflect.TypeOf(v), name)
+		}
+		return
+	}
+
+	switch vv := v.(type) {
+	case bool:
+		if !vv {
+			err = body(ctx)
+		}
+	case nil:
+		err = body(ctx)
+	case map[string]interface{}, context.Resolver:
+	case string, float64, json.Number, int, int64:
+	case context.Lambda, func(string, *context.Context, context.RenderFunc) (string, error):
+	case []interface{}:
+		if len(vv) == 0 {
+			err = body(ctx)
+		}
+	default:
+		err = fmt.Errorf("inverted add check for type %s", reflect.TypeOf(v))
+	}
+	return
+}
+
+// translate writes the escaped message for key, searching the renderer locale then the fallbacks
+func (r *render) translate(key string, ctx *context.Context) (err error) {
+	if r.catalog == nil {
+		return fmt.Errorf("key %q : %w", key, ErrNoCatalog)
+	}
+	var tags []string
+	if r.locale != nil {
+		tags = append(tags, r.locale.Tag)
+	}
+	tags = append(tags, r.fallbacks...)
+
+	var message string
+	var lookupErr error
+	message, err = r.catalog.Translate(key, tags, func(name string) (v interface{}, ok bool) {
+		if lookupErr == nil {
+			v, ok, lookupErr = r.lookup(ctx, name)
+		}
+		return
+	})
+	if lookupErr != nil {
+		return lookupErr
+	}
+	if err != nil {
+		return
+	}
+	return r.writeValue(message, true)
+}
+
+func (r *render) lookup(ctx *context.Context, name string) (interface{}, bool, error) {
+	return ctx.Resolve(name, r.lookupOptions...)
+}
+
+func asLambda(v interface{}) (l context.Lambda, ok bool) {
+	switch vt := v.(type) {
+	case context.Lambda:
+		return vt, true
+	case func(string, *context.Context, context.RenderFunc) (string, error):
+		return vt, true
+	}
+	return
+}
+
+// callLambda invokes l with text, rendering any template text it requests against ctx.
+// The frame given to l escapes values with the escaper of {{name}} tags, looks up values
+// with the lookup options of r and has the locale of r.
+func (r *render) callLambda(l context.Lambda, text string, ctx *context.Context) (string, error) {
+	escape := r.escape
+	if escape == nil {
+		escape = context.EscapeHTML
+	}
+	frame := ctx.WithEscaper(escape).WithLookupOptions(r.lookupOptions...)
+	if r.locale != nil {
+		frame = frame.WithLocale(*r.locale)
+	}
+	return l(text, frame, func(text string) (string, error) {
+		return r.renderString(text, ctx)
+	})
+}
+
+// writeLambda passes the raw text of a section to l and writes the result unescaped
+func (r *render) writeLambda(l context.Lambda, text string, ctx *context.Context) (err error) {
+	var result string
+	if result, err = r.callLambda(l, text, ctx); err != nil {
+		return
+	}
+	_, err = r.writer.Write([]byte(result))
+	return
+}
+
+// renderString renders template text against ctx and returns the output
+func (r *render) renderString(text string, ctx *context.Context) (result string, err error) {
+	var src source.Source
+	if src, err = source.FromString(text); err != nil {
+		return
+	}
+	var tokens []lexer.Token
+	if tokens, err = lexer.New(src, r.lexerOptions...).Parse(); err != nil {
+		return
+	}
+	buf := &bytes.Buffer{}
+	sub := *r
+	sub.writer = buf
+	if err = sub.render(tokens, ctx); err == nil {
+		result = buf.String()
+	}
+	return
+}
+
 func (r *render) writeValue(v interface{}, escape bool) (err error) {
 	switch vt := v.(type) {
 	case string:
-		if escape {
-			_, err = r.writer.Write([]byte(htmlEscape(vt)))
+		if escape && r.escape != nil {
+			_, err = r.writer.Write([]byte(r.escape(vt)))
+		} else if escape {
+			_, err = r.writer.Write([]byte(context.EscapeHTML(vt)))
 		} else {
 			_, err = r.writer.Write([]byte(vt))
 		}
 	case float64:
-		_, err = r.writer.Write([]byte(formatFloat(vt)))
+		if r.locale != nil {
+			_, err = r.writer.Write([]byte(r.locale.FormatNumber(vt, -1)))
+		} else {
+			_, err = r.writer.Write([]byte(formatFloat(vt)))
+		}
+	case json.Number:
+		if i, intErr := vt.Int64(); intErr == nil {
+			err = r.writeValue(i, escape)
+		} else if f, floatErr := vt.Float64(); floatErr == nil {
+			err = r.writeValue(f, escape)
+		} else {
+			err = r.writeValue(vt.String(), escape)
+		}
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		if r.locale != nil {
+			_, err = r.writer.Write([]byte(formatInteger(*r.locale, vt)))
+		} else {
+			_, err = r.writer.Write([]byte(fmt.Sprint(vt)))
+		}
+	case time.Time:
+		if r.locale != nil {
+			_, err = r.writer.Write([]byte(r.locale.FormatDateTime(vt)))
+		} else {
+			_, err = r.writer.Write([]byte(vt.Format(time.RFC3339)))
+		}
 	case nil:
 	default:
 		err = fmt.Errorf("unhandled type %s", reflect.TypeOf(vt))
@@ -262,11 +683,16 @@ func (r *render) writeValue(v interface{}, escape bool) (err error) {
 	return
 }
 
+// formatInteger formats a value of an integer type in l, without converting it to float64
+func formatInteger(l locale.Locale, v interface{}) string {
+	rv := reflect.ValueOf(v)
+	if rv.CanInt() {
+		return l.FormatInt(rv.Int())
+	}
+	return l.FormatUint(rv.Uint())
+}
+
 func formatFloat(f float64) string {
 	fv := fmt.Sprintf("%1.2f", f)
 	return strings.TrimSuffix(fv, ".00")
 }
-
-func htmlEscape(s string) (result string) {
-	return strings.ReplaceAll(html.EscapeString(s), "&#34;", "&quot;")
-}
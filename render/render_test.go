@@ -2,15 +2,21 @@ package render
 
 import (
 	"bytes"
+	stdcontext "context"
+	"errors"
 	"fmt"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/mlctrez/mystace/context"
+	"github.com/mlctrez/mystace/i18n"
 	"github.com/mlctrez/mystace/internal/mocks"
 	"github.com/mlctrez/mystace/internal/spec"
 	"github.com/mlctrez/mystace/internal/testify"
 	"github.com/mlctrez/mystace/lexer"
+	"github.com/mlctrez/mystace/locale"
 	"github.com/mlctrez/mystace/source"
 )
 
@@ -114,6 +120,475 @@ func Test_render_writerErr(t *testing.T) {
 
 }
 
+func TestRender_Lambda(t *testing.T) {
+	_, require := testify.New(t)
+
+	wrap := func(text string, ctx *context.Context, render context.RenderFunc) (string, error) {
+		rendered, err := render(text)
+		return "<b>" + rendered + "</b>", err
+	}
+	greeting := context.Lambda(func(text string, ctx *context.Context, render context.RenderFunc) (string, error) {
+		return "a & b", nil
+	})
+	failing := context.Lambda(func(text string, ctx *context.Context, render context.RenderFunc) (string, error) {
+		return "", mocks.ErrBadWriterMockError
+	})
+
+	tests := []struct {
+		template string
+		expected string
+	}{
+		{"{{#wrap}}Hi {{name}}{{/wrap}}", "<b>Hi Joe</b>"},
+		{"{{^wrap}}Hi {{name}}{{/wrap}}", ""},
+		{"{{greeting}}", "a &amp; b"},
+		{"{{{greeting}}}", "a & b"},
+		{"{{&greeting}}", "a & b"},
+	}
+
+	for i, test := range tests {
+		name := fmt.Sprintf("lambda%d", i)
+		src, err := source.FromString(test.template, source.WithName(name))
+		require.Nil(err)
+
+		r := New()
+		buf := &bytes.Buffer{}
+		r.Writer(buf)
+		require.Nil(r.AddSource(src))
+
+		err = r.Render(name, context.New(map[string]interface{}{
+			"wrap": wrap, "greeting": greeting, "name": "Joe",
+		}))
+		require.Nil(err, test.template)
+		require.Equal(test.expected, buf.String(), test.template)
+	}
+
+	for i, template := range []string{"{{failing}}", "{{{failing}}}", "{{#failing}}x{{/failing}}", "{{#wrap}}{{{{/wrap}}"} {
+		name := fmt.Sprintf("failing%d", i)
+		src, err := source.FromString(template, source.WithName(name))
+		require.Nil(err)
+
+		r := New()
+		r.Writer(&bytes.Buffer{})
+		require.Nil(r.AddSource(src))
+
+		err = r.Render(name, context.New(map[string]interface{}{"failing": failing, "wrap": wrap}))
+		require.NotNil(err, template)
+	}
+
+}
+
+func TestWithLocale(t *testing.T) {
+	_, require := testify.New(t)
+
+	at := time.Date(2022, 3, 4, 17, 6, 0, 0, time.UTC)
+	values := map[string]interface{}{"total": 1234567.5, "at": at}
+
+	src, err := source.FromString("{{total}} {{at}}", source.WithName("locale"))
+	require.Nil(err)
+
+	r := New()
+	buf := &bytes.Buffer{}
+	r.Writer(buf)
+	require.Nil(r.AddSource(src))
+	require.Nil(r.Render("locale", context.New(values)))
+	require.Equal("1234567.50 2022-03-04T17:06:00Z", buf.String())
+
+	de, err := locale.Lookup("de")
+	require.Nil(err)
+
+	src, err = source.FromString("{{total}} {{at}}", source.WithName("locale"))
+	require.Nil(err)
+
+	r = New(WithLocale(de))
+	buf = &bytes.Buffer{}
+	r.Writer(buf)
+	require.Nil(r.AddSource(src))
+	require.Nil(r.Render("locale", context.New(values)))
+	require.Equal("1.234.567,50 04.03.2022, 17:06", buf.String())
+
+}
+
+func TestWithCatalog(t *testing.T) {
+	_, require := testify.New(t)
+
+	en, err := i18n.NewMessages("en", map[string]string{
+		"greeting": "Hello {name}",
+		"inbox":    "{count, plural, one {# message} other {# messages}}",
+	})
+	require.Nil(err)
+	de, err := i18n.NewMessages("de", map[string]string{"greeting": "Hallo {name}"})
+	require.Nil(err)
+
+	deLocale, err := locale.Lookup("de")
+	require.Nil(err)
+
+	template := "{{_ greeting}}, {{_ inbox }} {{_private}}"
+	values := map[string]interface{}{"name": "<Ana>", "count": 1234.0, "_private": "!"}
+
+	renderTemplate := func(options ...Option) (string, error) {
+		src, srcErr := source.FromString(template, source.WithName("i18n"))
+		require.Nil(srcErr)
+		r := New(options...)
+		buf := &bytes.Buffer{}
+		r.Writer(buf)
+		require.Nil(r.AddSource(src))
+		renderErr := r.Render("i18n", context.New(values))
+		return buf.String(), renderErr
+	}
+
+	actual, err := renderTemplate(WithCatalog(i18n.NewCatalog(en, de)), WithLocale(deLocale), WithFallbackLocales("en"))
+	require.Nil(err)
+	require.Equal("Hallo &lt;Ana&gt;, 1,234 messages !", actual)
+
+	_, err = renderTemplate(WithCatalog(i18n.NewCatalog(en, de)), WithLocale(deLocale))
+	require.ErrorIs(err, i18n.ErrMessageNotFound)
+
+	_, err = renderTemplate()
+	require.ErrorIs(err, ErrNoCatalog)
+
+}
+
+func TestWithParentPaths(t *testing.T) {
+	_, require := testify.New(t)
+
+	template := "{{#items}}{{name}}/{{../name}},{{/items}}"
+	values := map[string]interface{}{
+		"name":  "list",
+		"items": []interface{}{map[string]interface{}{"name": "a"}, map[string]interface{}{"name": "b"}},
+	}
+
+	renderTemplate := func(options ...Option) string {
+		src, err := source.FromString(template, source.WithName("parent"))
+		require.Nil(err)
+		r := New(options...)
+		buf := &bytes.Buffer{}
+		r.Writer(buf)
+		require.Nil(r.AddSource(src))
+		require.Nil(r.Render("parent", context.New(values)))
+		return buf.String()
+	}
+
+	require.Equal("a/list,b/list,", renderTemplate(WithParentPaths()))
+	require.Equal("a/,b/,", renderTemplate())
+
+}
+
+func TestWithNumericIndexes(t *testing.T) {
+	_, require := testify.New(t)
+
+	values := map[string]interface{}{
+		"items": []interface{}{map[string]interface{}{"name": "a"}, map[string]interface{}{"name": "b"}},
+	}
+
+	renderTemplate := func(options ...Option) string {
+		src, err := source.FromString("{{items.1.name}}", source.WithName("indexes"))
+		require.Nil(err)
+		r := New(options...)
+		buf := &bytes.Buffer{}
+		r.Writer(buf)
+		require.Nil(r.AddSource(src))
+		require.Nil(r.Render("indexes", context.New(values)))
+		return buf.String()
+	}
+
+	require.Equal("b", renderTemplate(WithNumericIndexes()))
+	require.Equal("", renderTemplate())
+
+}
+
+func renderSources(r Render, name string, values interface{}) (string, error) {
+	buf := &bytes.Buffer{}
+	r.Writer(buf)
+	err := r.Render(name, context.New(values))
+	return buf.String(), err
+}
+
+func TestWithStrict(t *testing.T) {
+	_, require := testify.New(t)
+
+	values := map[string]interface{}{"name": "ana"}
+	templates := []string{"page", "{{name}}{{&name}}\n{{missing}}", "partial", "{{name}}\n  {{> missing}}"}
+
+	out, err := renderSources(withTemplates(t, templates...), "page", values)
+	require.Nil(err)
+	require.Equal("anaana\n", out)
+
+	r := New(WithStrict())
+	for i := 0; i < len(templates); i += 2 {
+		src, srcErr := source.FromString(templates[i+1], source.WithName(templates[i]))
+		require.Nil(srcErr)
+		require.Nil(r.AddSource(src))
+	}
+	_, err = renderSources(r, "page", values)
+	require.Equal("page:2:1: {{missing}} : missing var", err.Error())
+
+	_, err = renderSources(r, "partial", values)
+	require.ErrorIs(err, ErrSourceNameNotFound)
+	var renderError *RenderError
+	require.True(errors.As(err, &renderError))
+	require.Equal(3, renderError.Range.Start.Column)
+}
+
+func TestWithEscaper(t *testing.T) {
+	_, require := testify.New(t)
+
+	values := map[string]interface{}{"name": "<a & b>"}
+	out, err := renderSources(withTemplates(t, "e", "{{name}} {{{name}}}"), "e", values)
+	require.Nil(err)
+	require.Equal("&lt;a &amp; b&gt; <a & b>", out)
+
+	r := New(WithEscaper(func(s string) string { return s }))
+	src, err := source.FromString("{{name}}", source.WithName("e"))
+	require.Nil(err)
+	require.Nil(r.AddSource(src))
+	out, err = renderSources(r, "e", values)
+	require.Nil(err)
+	require.Equal("<a & b>", out)
+}
+
+func TestWithDelimiters(t *testing.T) {
+	_, require := testify.New(t)
+
+	values := map[string]interface{}{"name": "<b>", "items": []interface{}{map[string]interface{}{"v": 1}}}
+
+	r := New(WithDelimiters("[[", "]]"))
+	src, err := source.FromString("func() { [[name]] [[{name}]]|[[#items]][[v]][[/items]] {{name}} }", source.WithName("d"))
+	require.Nil(err)
+	require.Nil(r.AddSource(src))
+	out, err := renderSources(r, "d", values)
+	require.Nil(err)
+	require.Equal("func() { &lt;b&gt; <b>|1 {{name}} }", out)
+
+	// literal braces right after a tag stay text
+	r = New(WithDelimiters("<%", "%>"))
+	src, err = source.FromString("<%name%>{{name}}<%#items%>{{v}}<%/items%>{{{name}}}", source.WithName("d"))
+	require.Nil(err)
+	require.Nil(r.AddSource(src))
+	out, err = renderSources(r, "d", values)
+	require.Nil(err)
+	require.Equal("&lt;b&gt;{{name}}{{v}}{{{name}}}", out)
+
+	r = New(WithDelimiters("[[", "]]"))
+	src, err = source.FromString("line\n  [[name", source.WithName("d"))
+	require.Nil(err)
+	require.Nil(r.AddSource(src))
+	_, err = renderSources(r, "d", values)
+	require.ErrorIs(err, lexer.ErrMissingEndToken)
+	require.Equal("d:2:3: {{ : missing end token }}", err.Error())
+}
+
+func TestRender_Partial(t *testing.T) {
+	_, require := testify.New(t)
+
+	r := withTemplates(t, "page", "<ul>{{#items}}{{> item}}{{/items}}</ul>{{> missing}}", "item", "<li>{{name}}</li>", "broken", "{{> bad}}", "bad", "{{#a}}")
+	values := map[string]interface{}{"items": []interface{}{map[string]interface{}{"name": "a"}, map[string]interface{}{"name": "b"}}}
+	out, err := renderSources(r, "page", values)
+	require.Nil(err)
+	require.Equal("<ul><li>a</li><li>b</li></ul>", out)
+
+	_, err = renderSources(r, "broken", values)
+	require.ErrorIs(err, ErrMissingClose)
+	require.Equal("bad:1:1: {{#a}} : unable to find close", err.Error())
+}
+
+func TestRender_DynamicPartial(t *testing.T) {
+	_, require := testify.New(t)
+
+	templates := []string{"dashboard", "{{#widgets}}[{{>*kind}}]{{/widgets}}{{> * missing }}", "chart", "chart {{title}}", "table", "table {{title}}"}
+	r := withTemplates(t, templates...)
+	widgets := func(kinds ...interface{}) map[string]interface{} {
+		var list []interface{}
+		for _, kind := range kinds {
+			list = append(list, map[string]interface{}{"kind": kind, "title": "t"})
+		}
+		return map[string]interface{}{"widgets": list}
+	}
+	out, err := renderSources(r, "dashboard", widgets("chart", "table"))
+	require.Nil(err)
+	require.Equal("[chart t][table t]", out)
+
+	_, err = renderSources(r, "dashboard", widgets("map"))
+	require.ErrorIs(err, ErrSourceNameNotFound)
+	require.Equal(`dashboard:1:14: {{>*kind}} : partial "map" named by "kind" : source name not found`, err.Error())
+
+	_, err = renderSources(r, "dashboard", widgets(1))
+	require.ErrorIs(err, ErrWrongType)
+
+	r = New(WithStrict())
+	require.Nil(addSources(r, templates...))
+	_, err = renderSources(r, "dashboard", widgets("chart"))
+	require.ErrorIs(err, ErrMissingName)
+	var renderError *RenderError
+	require.ErrorAs(err, &renderError)
+	require.Equal("{{> * missing }}", renderError.Tag)
+
+	// dynamic partials are not in the graph, their nesting is limited when rendering
+	r = withTemplates(t, "node", "{{>*self}}")
+	require.Equal(map[string][]string{"node": {}}, r.Graph().Partials)
+	_, err = renderSources(r, "node", map[string]interface{}{"self": "node"})
+	require.ErrorIs(err, ErrPartialDepth)
+}
+
+// TestRender_Concurrent renders with one shared root context, it is meaningful when run with -race
+func TestRender_Concurrent(t *testing.T) {
+	assert := testify.Assert(t)
+
+	root := context.New(map[string]interface{}{
+		"site": map[string]interface{}{"title": "Site"},
+		"items": []interface{}{
+			map[string]interface{}{"name": "a"},
+			map[string]interface{}{"name": "b"},
+		},
+	})
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				src, err := source.FromString("{{site.title}} {{user}}:{{#items}}{{name}}{{/items}}", source.WithName("page"))
+				if !assert.Nil(err) {
+					return
+				}
+				r := New()
+				buf := &bytes.Buffer{}
+				r.Writer(buf)
+				assert.Nil(r.AddSource(src))
+				assert.Nil(r.Render("page", root.With("user", fmt.Sprint(g))))
+				assert.Equal(fmt.Sprintf("Site %d:ab", g), buf.String())
+			}
+		}(g)
+	}
+	wg.Wait()
+
+}
+
+func TestRender_Resolver(t *testing.T) {
+	_, require := testify.New(t)
+
+	var calls []string
+	user := context.ResolverFunc(func(name string) (interface{}, bool) {
+		calls = append(calls, name)
+		if name == "name" {
+			return "Ana", true
+		}
+		return nil, false
+	})
+
+	src, err := source.FromString("{{#user}}{{name}}{{/user}}{{^user}}none{{/user}}{{#list}}{{name}}{{/list}}", source.WithName("resolver"))
+	require.Nil(err)
+
+	r := New()
+	buf := &bytes.Buffer{}
+	r.Writer(buf)
+	require.Nil(r.AddSource(src))
+	require.Nil(r.Render("resolver", context.New(map[string]interface{}{
+		"user": user, "list": []interface{}{user, user},
+	})))
+	require.Equal("AnaAnaAna", buf.String())
+	require.Equal([]string{"name", "name", "name"}, calls)
+
+}
+
+func TestRender_Lazy(t *testing.T) {
+	_, require := testify.New(t)
+
+	calls := 0
+	values := map[string]interface{}{
+		"expensive": context.Lazy(func() (interface{}, error) {
+			calls++
+			return []interface{}{map[string]interface{}{"name": "a"}, map[string]interface{}{"name": "b"}}, nil
+		}),
+		"failing": func() (interface{}, error) {
+			return nil, mocks.ErrBadReaderMockError
+		},
+	}
+
+	renderTemplate := func(template string) (string, error) {
+		src, err := source.FromString(template, source.WithName("lazy"))
+		require.Nil(err)
+		r := New()
+		buf := &bytes.Buffer{}
+		r.Writer(buf)
+		require.Nil(r.AddSource(src))
+		err = r.Render("lazy", context.New(values))
+		return buf.String(), err
+	}
+
+	actual, err := renderTemplate("{{#expensive}}{{name}}{{/expensive}}{{^expensive}}none{{/expensive}}{{#expensive}}{{name}}{{/expensive}}")
+	require.Nil(err)
+	require.Equal("abab", actual)
+	require.Equal(1, calls)
+
+	_, err = renderTemplate("{{#expensive}}{{name}}{{/expensive}}")
+	require.Nil(err)
+	require.Equal(2, calls)
+
+	for _, template := range []string{"line\n  {{failing}}", "line\n  {{{failing}}}", "line\n  {{#failing}}x{{/failing}}"} {
+		_, err = renderTemplate(template)
+		require.ErrorIs(err, mocks.ErrBadReaderMockError)
+		var renderError *RenderError
+		require.ErrorAs(err, &renderError)
+		require.Equal("lazy", renderError.Source)
+		require.Equal(source.Location{Line: 2, Column: 3}, renderError.Range.Start)
+		require.Contains(renderError.Error(), "lazy:2:3: {{")
+	}
+
+	// values of resolvers are evaluated once although the resolver returns new values on every call
+	calls = 0
+	resolver := context.ResolverFunc(func(name string) (interface{}, bool) {
+		if name != "user" {
+			return nil, false
+		}
+		return map[string]interface{}{"name": context.Lazy(func() (interface{}, error) {
+			calls++
+			return "ana", nil
+		})}, true
+	})
+	src, err := source.FromString("{{user.name}}-{{#user}}{{name}}{{/user}}-{{user.name}}", source.WithName("resolver"))
+	require.Nil(err)
+	r := New()
+	buf := &bytes.Buffer{}
+	r.Writer(buf)
+	require.Nil(r.AddSource(src))
+	require.Nil(r.Render("resolver", context.New(resolver)))
+	require.Equal("ana-ana-ana", buf.String())
+	require.Equal(1, calls)
+}
+
+func TestRender_Numbers(t *testing.T) {
+	_, require := testify.New(t)
+
+	ctx, err := context.FromJSON(strings.NewReader(`{"id": 9007199254740993, "big": 1e400, "price": 1.5, "count": 3, "items": [1, 2]}`))
+	require.Nil(err)
+
+	de, err := locale.Lookup("de")
+	require.Nil(err)
+
+	renderTemplate := func(template string, values *context.Context, options ...Option) string {
+		src, srcErr := source.FromString(template, source.WithName("numbers"))
+		require.Nil(srcErr)
+		r := New(options...)
+		buf := &bytes.Buffer{}
+		r.Writer(buf)
+		require.Nil(r.AddSource(src))
+		require.Nil(r.Render("numbers", values))
+		return buf.String()
+	}
+
+	template := "{{id}} {{price}} {{big}}|{{#count}}[{{.}}]{{/count}}{{^count}}none{{/count}}|{{#items}}{{/items}}"
+	require.Equal("9007199254740993 1.50 1e400|[3]|", renderTemplate(template, ctx))
+
+	values := context.New(map[string]interface{}{"int": 1234567, "int64": int64(-5), "uint8": uint8(7)})
+	require.Equal("1234567 -5 7", renderTemplate("{{int}} {{int64}} {{uint8}}", values))
+	require.Equal("1.234.567 -5 7", renderTemplate("{{int}} {{int64}} {{uint8}}", values, WithLocale(de)))
+
+	values = context.New(map[string]interface{}{"int64": int64(9007199254740993), "uint64": uint64(18446744073709551615)})
+	require.Equal("9.007.199.254.740.993 18.446.744.073.709.551.615", renderTemplate("{{int64}} {{uint64}}", values, WithLocale(de)))
+	require.Equal("9.007.199.254.740.993 1,50", renderTemplate("{{id}} {{price}}", ctx, WithLocale(de)))
+}
+
 func TestRender_MustacheSpecs(t *testing.T) {
 	_, require := testify.New(t)
 
@@ -172,37 +647,6 @@ func TestRender_MustacheSpecs(t *testing.T) {
 	}
 }
 
-func TestRender_modsAt(t *testing.T) {
-	require := testify.Require(t)
-	require.True(true)
-
-	src, err := source.FromString(`some data{{!comment}}other data
-more data
-{{!comment}}
-more more data
-`)
-	require.Nil(err)
-	var tokens []lexer.Token
-	tokens, err = lexer.New(src).Parse()
-	require.Nil(err)
-
-	// out of range should not blow up
-	require.False(canRemoveWhitespace(tokens, 1, -1))
-	require.False(canRemoveWhitespace(tokens, 1, 10))
-
-	// comments on same line should not be treated as whitespace removal
-	require.False(canRemoveWhitespace(tokens, 0, 1))
-	require.False(canRemoveWhitespace(tokens, 2, 1))
-
-	// comment on different line
-	require.True(canRemoveWhitespace(tokens, 2, 3))
-	require.True(canRemoveWhitespace(tokens, 4, 3))
-
-	// comparison with non comments
-	require.False(canRemoveWhitespace(tokens, 0, 0))
-
-}
-
 /*
 
 {{#a}}
@@ -229,3 +673,55 @@ more more data
 
 
 */
+
+func TestRender_RenderContext(t *testing.T) {
+	_, require := testify.New(t)
+
+	done, cancel := stdcontext.WithCancel(stdcontext.Background())
+	defer cancel()
+	items := make([]interface{}, 100)
+	for i := range items {
+		i := i
+		items[i] = map[string]interface{}{"name": context.Lambda(func(string, *context.Context, context.RenderFunc) (string, error) {
+			if i == 2 {
+				cancel()
+			}
+			return "x", nil
+		})}
+	}
+	r := withTemplates(t, "list", "{{#items}}{{name}}{{/items}}")
+	buf := &bytes.Buffer{}
+	r.Writer(buf)
+	err := r.RenderContext(done, "list", context.New(map[string]interface{}{"items": items}))
+	require.Equal(stdcontext.Canceled, err)
+	require.Empty(buf.String())
+
+	// a done context renders nothing
+	buf.Reset()
+	require.Equal(stdcontext.Canceled, r.RenderContext(done, "list", context.New(map[string]interface{}{"items": items})))
+	require.Empty(buf.String())
+
+	expired, cancelExpired := stdcontext.WithTimeout(stdcontext.Background(), time.Millisecond)
+	defer cancelExpired()
+	slow := context.Lambda(func(string, *context.Context, context.RenderFunc) (string, error) {
+		time.Sleep(2 * time.Millisecond)
+		return "", nil
+	})
+	err = r.RenderContext(expired, "list", context.New(map[string]interface{}{"items": []interface{}{
+		map[string]interface{}{"name": slow}, map[string]interface{}{"name": slow}}}))
+	require.Equal(stdcontext.DeadlineExceeded, err)
+
+	buf.Reset()
+	require.Nil(r.RenderContext(stdcontext.Background(), "list", context.New(map[string]interface{}{"items": items[:1]})))
+
+	// lazy values taking a context stop with the render
+	waiting := context.LazyContext(func(ctx stdcontext.Context) (interface{}, error) {
+		<-ctx.Done()
+		return nil, fmt.Errorf("lazy : %w", ctx.Err())
+	})
+	expired, cancelExpired = stdcontext.WithTimeout(stdcontext.Background(), time.Millisecond)
+	defer cancelExpired()
+	err = r.RenderContext(expired, "list", context.New(map[string]interface{}{"items": []interface{}{
+		map[string]interface{}{"name": waiting}}}))
+	require.Equal(stdcontext.DeadlineExceeded, err)
+}
@@ -0,0 +1,139 @@
+package render
+
+import (
+	"io"
+	"time"
+
+	"github.com/mlctrez/mystace/context"
+	"github.com/mlctrez/mystace/lexer"
+	"github.com/mlctrez/mystace/source"
+)
+
+// Tag locates a tag of a compiled template
+type Tag struct {
+	Str    string
+	Line   int
+	Column int
+}
+
+// Runtime writes the output of templates compiled to Go source by the codegen package,
+// following the same rules as Render. The first error is kept and later calls do nothing,
+// so generated code only checks Err when it returns. A Runtime is not safe for concurrent use.
+type Runtime struct {
+	r   render
+	err error
+}
+
+// NewRuntime returns a Runtime writing to w, name is the source reported in errors
+func NewRuntime(w io.Writer, name string) *Runtime {
+	return &Runtime{r: render{
+		writer:        w,
+		name:          name,
+		lookupOptions: []context.LookupOption{context.Memoize(context.NewMemo())},
+	}}
+}
+
+// Err returns the first error
+func (rt *Runtime) Err() error {
+	return rt.err
+}
+
+func (rt *Runtime) errorAt(tag Tag, err error) error {
+	if err == nil {
+		return nil
+	}
+	start := source.Location{Line: tag.Line, Column: tag.Column}
+	token := lexer.Token{Kind: lexer.TagKind, Data: source.Data{Str: tag.Str, Range: source.Range{Start: start}}}
+	return rt.r.errorAt(token, err)
+}
+
+// Text writes template text
+func (rt *Runtime) Text(s string) {
+	if rt.err == nil {
+		_, rt.err = io.WriteString(rt.r.writer, s)
+	}
+}
+
+// String writes s, escaping html when escape is set
+func (rt *Runtime) String(s string, escape bool) {
+	rt.value(s, escape)
+}
+
+// Int writes a signed integer
+func (rt *Runtime) Int(i int64) {
+	rt.value(i, false)
+}
+
+// Uint writes an unsigned integer
+func (rt *Runtime) Uint(u uint64) {
+	rt.value(u, false)
+}
+
+// Float writes a floating point number
+func (rt *Runtime) Float(f float64) {
+	rt.value(f, false)
+}
+
+// Time writes a time
+func (rt *Runtime) Time(t time.Time) {
+	rt.value(t, false)
+}
+
+func (rt *Runtime) value(v interface{}, escape bool) {
+	if rt.err == nil {
+		rt.err = rt.r.writeValue(v, escape)
+	}
+}
+
+// Missing fails a section whose name was not found
+func (rt *Runtime) Missing(tag Tag) {
+	if rt.err == nil {
+		rt.err = rt.errorAt(tag, ErrMissingName)
+	}
+}
+
+// Variable looks up name in ctx and writes the value as Render does for {{name}} and {{{name}}}
+func (rt *Runtime) Variable(ctx *context.Context, tag Tag, name string, escape bool) {
+	if rt.err != nil {
+		return
+	}
+	v, ok, err := rt.r.lookup(ctx, name)
+	if err != nil {
+		rt.err = rt.errorAt(tag, err)
+		return
+	}
+	if !ok {
+		return
+	}
+	if l, isLambda := asLambda(v); isLambda {
+		if v, rt.err = rt.r.callLambda(l, "", ctx); rt.err != nil {
+			return
+		}
+	}
+	rt.err = rt.r.writeValue(v, escape)
+}
+
+// Section looks up name in ctx and calls body for each frame of the section as Render does.
+// raw is the unrendered text of the section passed to lambdas, rendered with the default delimiters.
+func (rt *Runtime) Section(ctx *context.Context, tag Tag, name string, inverted bool, raw string, body func(ctx *context.Context)) {
+	if rt.err != nil {
+		return
+	}
+	v, ok, err := rt.r.lookup(ctx, name)
+	if err != nil {
+		rt.err = rt.errorAt(tag, err)
+		return
+	}
+	if !ok {
+		rt.Missing(tag)
+		return
+	}
+	rt.err = rt.errorAt(tag, rt.r.section(name, v, inverted, ctx,
+		func(nc *context.Context) error {
+			body(nc)
+			return rt.err
+		},
+		func(l context.Lambda) error {
+			return rt.r.writeLambda(l, raw, ctx)
+		}))
+}
@@ -0,0 +1,91 @@
+package render
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mlctrez/mystace/context"
+	"github.com/mlctrez/mystace/internal/mocks"
+	"github.com/mlctrez/mystace/internal/testify"
+)
+
+func TestRuntime(t *testing.T) {
+	require := testify.Require(t)
+
+	buf := &bytes.Buffer{}
+	rt := NewRuntime(buf, "compiled")
+	rt.Text("a ")
+	rt.String("<b>", true)
+	rt.String("<b>", false)
+	rt.Int(-3)
+	rt.Uint(4)
+	rt.Float(1.5)
+	rt.Time(time.Date(2022, 1, 2, 3, 4, 5, 0, time.UTC))
+	require.Nil(rt.Err())
+	require.Equal("a &lt;b&gt;<b>-341.502022-01-02T03:04:05Z", buf.String())
+
+	tag := Tag{Str: "{{#missing}}", Line: 2, Column: 3}
+	rt.Missing(tag)
+	require.ErrorIs(rt.Err(), ErrMissingName)
+	require.Equal("compiled:2:3: {{#missing}} : missing var", rt.Err().Error())
+
+	// later calls do nothing after an error
+	rt.Text("ignored")
+	require.Equal("a &lt;b&gt;<b>-341.502022-01-02T03:04:05Z", buf.String())
+
+	rt = NewRuntime(&mocks.BadWriter{WriteErr: mocks.ErrBadWriterMockError}, "compiled")
+	rt.Text("text")
+	require.ErrorIs(rt.Err(), mocks.ErrBadWriterMockError)
+}
+
+func TestRuntime_Context(t *testing.T) {
+	require := testify.Require(t)
+
+	upper := context.Lambda(func(text string, ctx *context.Context, render context.RenderFunc) (string, error) {
+		rendered, err := render(text)
+		return strings.ToUpper(rendered), err
+	})
+	ctx := context.New(map[string]interface{}{
+		"name":  "ana",
+		"upper": upper,
+		"items": []interface{}{map[string]interface{}{"n": "1"}, map[string]interface{}{"n": "2"}},
+	})
+
+	buf := &bytes.Buffer{}
+	rt := NewRuntime(buf, "compiled")
+	rt.Variable(ctx, Tag{Str: "{{name}}"}, "name", true)
+	rt.Section(ctx, Tag{Str: "{{#items}}"}, "items", false, "", func(ctx *context.Context) {
+		rt.Variable(ctx, Tag{Str: "{{n}}"}, "n", true)
+	})
+	rt.Section(ctx, Tag{Str: "{{^items}}"}, "items", true, "", func(ctx *context.Context) {
+		rt.Text("none")
+	})
+	rt.Section(ctx, Tag{Str: "{{#upper}}"}, "upper", false, "hi {{name}}", func(ctx *context.Context) {
+		rt.Text("not called for lambdas")
+	})
+	require.Nil(rt.Err())
+	require.Equal("ana12HI ANA", buf.String())
+
+	failing := context.Lazy(func() (interface{}, error) { return nil, mocks.ErrBadReaderMockError })
+	rt.Variable(context.New(map[string]interface{}{"lazy": failing}), Tag{Str: "{{lazy}}", Line: 1, Column: 4}, "lazy", true)
+	var renderError *RenderError
+	require.True(errors.As(rt.Err(), &renderError))
+	require.Equal(1, renderError.Range.Start.Line)
+	require.Equal(4, renderError.Range.Start.Column)
+
+	rt = NewRuntime(buf, "compiled")
+	rt.Section(ctx, Tag{Str: "{{#missing}}"}, "missing", false, "", func(ctx *context.Context) {})
+	require.ErrorIs(rt.Err(), ErrMissingName)
+	// errors of the section itself are located at the tag, as Render does
+	template := "{{#channel}}x{{/channel}}"
+	channel := context.New(map[string]interface{}{"channel": make(chan int)})
+	rt = NewRuntime(buf, "compiled")
+	rt.Section(channel, Tag{Str: "{{#channel}}", Line: 1, Column: 1}, "channel", false, "x", func(ctx *context.Context) {})
+	require.NotNil(rt.Err())
+	r := withTemplates(t, "compiled", template)
+	r.Writer(&bytes.Buffer{})
+	require.Equal(r.Render("compiled", channel).Error(), rt.Err().Error())
+}
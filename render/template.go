@@ -0,0 +1,119 @@
+package render
+
+import (
+	"bytes"
+	"sync"
+
+	"github.com/mlctrez/mystace/context"
+	"github.com/mlctrez/mystace/source"
+)
+
+// maxPooledBuffer keeps buffers grown by large outputs out of the pool
+const maxPooledBuffer = 64 << 10
+
+var buffers = sync.Pool{New: func() interface{} { return new(bytes.Buffer) }}
+
+// Template is a template rendered to strings and bytes, safe for concurrent use.
+// AddSource waits for the renders in progress.
+type Template struct {
+	name string
+	// mu guards the sources of r, renders read them while AddSource writes them
+	mu sync.RWMutex
+	r  *render
+}
+
+// NewTemplate reads text as the template name rendered with options
+func NewTemplate(name, text string, options ...Option) (*Template, error) {
+	r, err := build(options...)
+	if err != nil {
+		return nil, err
+	}
+	var src source.Source
+	if src, err = source.FromString(text, source.WithName(name)); err != nil {
+		return nil, err
+	}
+	if err = r.AddSource(src); err != nil {
+		return nil, err
+	}
+	// lexer errors are found now rather than on every render
+	if _, err = r.tokens(name); err != nil {
+		return nil, err
+	}
+	return &Template{name: name, r: r}, nil
+}
+
+// Must returns t and panics when err is set, for templates known when writing the program:
+// var page = render.Must(render.NewTemplate("page", "<h1>{{title}}</h1>"))
+func Must(t *Template, err error) *Template {
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+// AddSource registers a partial available to the template
+func (t *Template) AddSource(src source.Source) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.r.AddSource(src)
+}
+
+// Bytes renders the template with ctx
+func (t *Template) Bytes(ctx *context.Context) ([]byte, error) {
+	buf := buffers.Get().(*bytes.Buffer)
+	defer release(buf)
+	if err := t.render(buf, ctx); err != nil {
+		return nil, err
+	}
+	return append([]byte(nil), buf.Bytes()...), nil
+}
+
+// String renders the template with ctx
+func (t *Template) String(ctx *context.Context) (string, error) {
+	buf := buffers.Get().(*bytes.Buffer)
+	defer release(buf)
+	if err := t.render(buf, ctx); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// render renders with a copy of the renderer, so concurrent renders use their own writer
+func (t *Template) render(buf *bytes.Buffer, ctx *context.Context) error {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	r := *t.r
+	r.writer = buf
+	// buf already collects the whole output
+	r.flushThreshold = 0
+	return r.Render(t.name, ctx)
+}
+
+func release(buf *bytes.Buffer) {
+	if buf.Cap() <= maxPooledBuffer {
+		buf.Reset()
+		buffers.Put(buf)
+	}
+}
+
+// String renders template with data, which is a *context.Context or the values given to context.New
+func String(template string, data interface{}) (string, error) {
+	t, err := NewTemplate("template", template)
+	if err != nil {
+		return "", err
+	}
+	ctx, ok := data.(*context.Context)
+	if !ok {
+		ctx = context.New(data)
+	}
+	return t.String(ctx)
+}
+
+// MustString renders template with data as String and panics on errors
+func MustString(template string, data interface{}) string {
+	s, err := String(template, data)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
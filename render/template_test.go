@@ -0,0 +1,80 @@
+package render
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/mlctrez/mystace/context"
+	"github.com/mlctrez/mystace/internal/testify"
+	"github.com/mlctrez/mystace/source"
+)
+
+func TestString(t *testing.T) {
+	_, require := testify.New(t)
+
+	out, err := String("Hi {{name}}!", map[string]interface{}{"name": "<ana>"})
+	require.Nil(err)
+	require.Equal("Hi &lt;ana&gt;!", out)
+
+	out, err = String("{{.}}", context.New("scalar"))
+	require.Nil(err)
+	require.Equal("scalar", out)
+
+	_, err = String("{{#open}}", nil)
+	require.ErrorIs(err, ErrMissingClose)
+	_, err = String("{{name", nil)
+	var renderError *RenderError
+	require.ErrorAs(err, &renderError)
+
+	require.Equal("ok", MustString("{{a}}", map[string]interface{}{"a": "ok"}))
+	require.Panics(func() { MustString("{{#a}}", nil) })
+}
+
+func TestTemplate(t *testing.T) {
+	_, require := testify.New(t)
+
+	page := Must(NewTemplate("page", "<ul>{{#items}}{{> item}}{{/items}}</ul>", WithStrict()))
+	item, err := source.FromString("<li>{{name}}</li>", source.WithName("item"))
+	require.Nil(err)
+	require.Nil(page.AddSource(item))
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			ctx := context.New(map[string]interface{}{"items": []interface{}{map[string]interface{}{"name": g}}})
+			data, bytesErr := page.Bytes(ctx)
+			if bytesErr != nil || string(data) != fmt.Sprintf("<ul><li>%d</li></ul>", g) {
+				t.Errorf("render %d : %q %v", g, data, bytesErr)
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	// partials are added while rendering
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			src, _ := source.FromString("", source.WithName(fmt.Sprint("extra", g)))
+			if addErr := page.AddSource(src); addErr != nil {
+				t.Errorf("add %d : %v", g, addErr)
+			}
+			if _, stringErr := page.String(context.New(map[string]interface{}{"items": []interface{}{}})); stringErr != nil {
+				t.Errorf("render %d : %v", g, stringErr)
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	_, err = page.String(context.New(map[string]interface{}{"items": []interface{}{map[string]interface{}{}}}))
+	require.ErrorIs(err, ErrMissingName)
+
+	_, err = NewTemplate("bad", "{{name")
+	require.NotNil(err)
+	_, err = NewTemplate("limited", "", WithLimits(Limits{MaxIterations: -1}))
+	require.NotNil(err)
+	require.Panics(func() { Must(NewTemplate("", "")) })
+}
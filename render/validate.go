@@ -0,0 +1,208 @@
+package render
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mlctrez/mystace/context"
+	"github.com/mlctrez/mystace/lexer"
+	"github.com/mlctrez/mystace/parse"
+	"github.com/mlctrez/mystace/schema"
+)
+
+var (
+	ErrMissingValue = fmt.Errorf("missing value")
+	ErrWrongType    = fmt.Errorf("wrong type")
+)
+
+// Problem is a difference between the data supplied to a template and the data it uses
+type Problem struct {
+	// Path is the dotted name of the value, with list indexes in brackets: lines[0].price
+	Path string
+	Err  error
+}
+
+func (p Problem) Error() string {
+	if p.Path == "" {
+		return p.Err.Error()
+	}
+	return fmt.Sprintf("%s : %s", p.Path, p.Err)
+}
+
+func (p Problem) Unwrap() error {
+	return p.Err
+}
+
+// Validate infers the schema of the template name, including the partials it uses, and
+// checks ctx against it. Templates and partials are registered with AddSource or loaded
+// by the PartialLoader, a missing partial uses no names as it renders nothing. Names are
+// looked up as Render does, so a name used in a section may be found in the section
+// value or any outer frame.
+func (r *render) Validate(name string, ctx *context.Context) (problems []Problem) {
+	tree, found, err := r.tree(name)
+	if err != nil {
+		return []Problem{{Err: err}}
+	}
+	if !found {
+		return []Problem{{Err: fmt.Errorf("name %q : %w", name, ErrSourceNameNotFound)}}
+	}
+	var partials []*parse.Tree
+	partials, problems = r.partials(tree)
+	var s *schema.Schema
+	if s, err = schema.Infer(tree, schema.WithPartials(partials...)); err != nil {
+		return append(problems, Problem{Err: err})
+	}
+	v := &validator{r: r, problems: problems}
+	v.properties(s, ctx, "")
+	return v.problems
+}
+
+// tree returns the parsed template name and whether it exists
+func (r *render) tree(name string) (tree *parse.Tree, found bool, err error) {
+	var tokens []lexer.Token
+	if tokens, found, err = r.find(name); err != nil || !found {
+		return
+	}
+	tree, err = parse.Tokens(name, tokens)
+	return
+}
+
+// partials returns the trees of the partials included by tree and by those partials. A
+// partial that cannot be found is an empty tree, as it renders nothing, and a problem in
+// strict mode. Partials failing to load or parse are problems.
+func (r *render) partials(tree *parse.Tree) (partials []*parse.Tree, problems []Problem) {
+	seen := map[string]bool{tree.Name: true}
+	for pending := []*parse.Tree{tree}; len(pending) > 0; pending = pending[1:] {
+		parse.Walk(pending[0].Nodes, func(n parse.Node) bool {
+			partial, ok := n.(*parse.PartialNode)
+			if !ok || partial.Dynamic || seen[partial.Name] {
+				return true
+			}
+			seen[partial.Name] = true
+			t, found, err := r.tree(partial.Name)
+			switch {
+			case err != nil:
+				problems = append(problems, Problem{Err: err})
+			case !found && r.strict:
+				problems = append(problems, Problem{Err: fmt.Errorf("partial %q : %w", partial.Name, ErrSourceNameNotFound)})
+			case found:
+				pending = append(pending, t)
+				partials = append(partials, t)
+				return true
+			}
+			partials = append(partials, &parse.Tree{Name: partial.Name})
+			return true
+		})
+	}
+	return
+}
+
+type validator struct {
+	r        *render
+	problems []Problem
+}
+
+func (v *validator) report(path string, err error) {
+	v.problems = append(v.problems, Problem{Path: path, Err: err})
+}
+
+// properties looks up the properties of s in ctx and checks their values
+func (v *validator) properties(s *schema.Schema, ctx *context.Context, path string) {
+	names := make([]string, 0, len(s.Properties))
+	for name := range s.Properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		p := name
+		if path != "" {
+			p = path + "." + name
+		}
+		value, ok, err := v.r.lookup(ctx, name)
+		switch {
+		case err != nil:
+			v.report(p, err)
+		case !ok:
+			v.report(p, ErrMissingValue)
+		default:
+			v.value(s.Properties[name], value, ctx, p, s.Properties[name].Type.Has(schema.Array))
+		}
+	}
+}
+
+// value checks the type of a value and the values the template uses within it. The values
+// of sections and list items are frames above ctx, the rest of a dotted name is only
+// looked up within the value.
+func (v *validator) value(s *schema.Schema, value interface{}, ctx *context.Context, path string, frame bool) {
+	if _, isLambda := asLambda(value); isLambda || value == nil {
+		return
+	}
+	kind := kindOf(value)
+	if !s.Type.Has(schema.Array) {
+		// names not used as sections are only written by {{name}} tags
+		kind = valueKindOf(value)
+	}
+	if !s.Type.Has(kind) {
+		if kind == "" {
+			kind = fmt.Sprintf("%T", value)
+		}
+		v.report(path, fmt.Errorf("%s, want %s : %w", kind, strings.Join(s.Type, " or "), ErrWrongType))
+		return
+	}
+	switch kind {
+	case schema.Object:
+		if frame {
+			v.properties(s, ctx.Push(value), path)
+		} else {
+			v.properties(s, context.New(value), path)
+		}
+	case schema.Boolean:
+		if value == true {
+			v.properties(s, ctx, path)
+		}
+	case schema.Array:
+		if s.Items == nil {
+			return
+		}
+		for i, item := range value.([]interface{}) {
+			v.value(s.Items, item, ctx, fmt.Sprintf("%s[%d]", path, i), true)
+		}
+	default:
+		if frame {
+			v.properties(s, ctx.With(context.ImplicitIterator, value), path)
+		}
+	}
+}
+
+// kindOf returns the JSON Schema type of a value as a section treats it, or "" for the
+// values section rejects
+func kindOf(value interface{}) string {
+	switch value.(type) {
+	case map[string]interface{}, context.Resolver:
+		return schema.Object
+	case []interface{}:
+		return schema.Array
+	case bool:
+		return schema.Boolean
+	case string:
+		return schema.String
+	case float64, json.Number, int, int64:
+		return schema.Number
+	}
+	return ""
+}
+
+// valueKindOf returns the JSON Schema type of a value as {{name}} tags write it, which
+// accept more types than sections
+func valueKindOf(value interface{}) string {
+	switch value.(type) {
+	case time.Time:
+		return schema.String
+	case int8, int16, int32, uint, uint8, uint16, uint32, uint64:
+		return schema.Number
+	}
+	return kindOf(value)
+}
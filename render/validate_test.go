@@ -0,0 +1,150 @@
+package render
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mlctrez/mystace/context"
+	"github.com/mlctrez/mystace/internal/testify"
+	"github.com/mlctrez/mystace/parse"
+	"github.com/mlctrez/mystace/source"
+)
+
+func withTemplates(t *testing.T, templates ...string) Render {
+	_, require := testify.New(t)
+	r := New()
+	for i := 0; i < len(templates); i += 2 {
+		src, err := source.FromString(templates[i+1], source.WithName(templates[i]))
+		require.Nil(err)
+		require.Nil(r.AddSource(src))
+	}
+	return r
+}
+
+func validate(t *testing.T, r Render, name, data string) (paths []string, problems []Problem) {
+	_, require := testify.New(t)
+	ctx, err := context.FromJSON(strings.NewReader(data))
+	require.Nil(err)
+	problems = r.Validate(name, ctx)
+	for _, p := range problems {
+		paths = append(paths, p.Path)
+	}
+	return
+}
+
+func TestRender_Validate(t *testing.T) {
+	_, require := testify.New(t)
+
+	r := withTemplates(t, "invoice", "{{number}} {{customer.name}}\n{{#lines}}{{item}} {{price}} {{currency}}\n{{/lines}}{{#paid}}{{date}}{{/paid}}")
+
+	paths, _ := validate(t, r, "invoice", `{"number": 1, "customer": {"name": "ana"}, "currency": "EUR",
+		"lines": [{"item": "a", "price": 1}, {"item": "b", "price": 2, "currency": "USD"}], "paid": true, "date": "today"}`)
+	require.Empty(paths)
+
+	paths, problems := validate(t, r, "invoice", `{"customer": {}, "currency": "EUR", "lines": [{"item": "a"}, {"price": {}}], "paid": false}`)
+	require.Equal([]string{"customer.name", "lines[0].price", "lines[1].item", "lines[1].price", "number"}, paths)
+	require.ErrorIs(problems[0], ErrMissingValue)
+	require.ErrorIs(problems[3], ErrWrongType)
+	require.Equal("lines[1].price : object, want string or number : wrong type", problems[3].Error())
+
+	// a scalar where the template expects a section
+	paths, problems = validate(t, r, "invoice", `{"number": 1, "customer": "ana", "currency": "EUR", "lines": "a", "paid": true}`)
+	require.Equal([]string{"customer", "lines", "paid.date"}, paths)
+	require.ErrorIs(problems[0], ErrWrongType)
+	require.ErrorIs(problems[1], ErrWrongType)
+	require.ErrorIs(problems[2], ErrMissingValue)
+
+	// names in dotted paths are not looked up in outer frames
+	paths, _ = validate(t, r, "invoice", `{"number": 1, "customer": {}, "name": "ana", "currency": "EUR", "lines": [], "paid": false}`)
+	require.Equal([]string{"customer.name"}, paths)
+
+	paths, problems = validate(t, r, "missing", `{}`)
+	require.Equal([]string{""}, paths)
+	require.ErrorIs(problems[0], ErrSourceNameNotFound)
+}
+
+func TestRender_ValidateSectionTypes(t *testing.T) {
+	_, require := testify.New(t)
+
+	r := withTemplates(t, "page", "{{#when}}{{/when}}{{#count}}{{/count}}{{#price}}{{/price}} {{stamp}} {{small}}")
+	ctx := context.New(map[string]interface{}{
+		"when": time.Now(), "count": int8(1), "price": float32(1),
+		"stamp": time.Now(), "small": uint8(2),
+	})
+	problems := r.Validate("page", ctx)
+	var paths []string
+	for _, p := range problems {
+		require.ErrorIs(p, ErrWrongType)
+		paths = append(paths, p.Path)
+	}
+	// values a section rejects when rendering, {{name}} tags write them
+	require.Equal([]string{"count", "price", "when"}, paths)
+	require.Equal("count : int8, want object or array or boolean : wrong type", problems[0].Error())
+
+	r.Writer(&bytes.Buffer{})
+	require.NotNil(r.Render("page", ctx))
+
+	ctx = context.New(map[string]interface{}{"when": true, "count": []interface{}{}, "price": map[string]interface{}{},
+		"stamp": time.Now(), "small": uint8(2)})
+	require.Empty(r.Validate("page", ctx))
+	require.Nil(r.Render("page", ctx))
+}
+
+func TestRender_ValidatePartials(t *testing.T) {
+	_, require := testify.New(t)
+
+	r := withTemplates(t, "page", "{{#user}}{{> card}}{{/user}}", "card", "{{name}} {{#tags}}{{.}}{{/tags}}")
+	paths, problems := validate(t, r, "page", `{"user": {"name": "ana", "tags": ["a", {}]}}`)
+	require.Equal([]string{"user.tags[1]"}, paths)
+	require.ErrorIs(problems[0], ErrWrongType)
+
+	paths, _ = validate(t, r, "page", `{"user": {"tags": []}}`)
+	require.Equal([]string{"user.name"}, paths)
+
+	// a missing partial renders nothing, and fails strict renders
+	r = withTemplates(t, "page", "{{> missing}}{{name}}")
+	paths, _ = validate(t, r, "page", `{}`)
+	require.Equal([]string{"name"}, paths)
+	strict := New(WithStrict())
+	require.Nil(addSources(strict, "page", "{{> missing}}{{name}}"))
+	problems = strict.Validate("page", context.New(map[string]interface{}{"name": "ana"}))
+	require.Len(problems, 1)
+	require.ErrorIs(problems[0], ErrSourceNameNotFound)
+
+	// templates and partials supplied by a loader
+	loaded := map[string]string{"page": "{{#user}}{{> card}}{{/user}}", "card": "{{name}}{{> missing}}", "broken": "{{> bad}}", "bad": "{{#a}}"}
+	r = New(WithPartialLoader(PartialLoaderFunc(func(name string) (source.Source, error) {
+		if text, ok := loaded[name]; ok {
+			return source.FromString(text, source.WithName(name))
+		}
+		return nil, nil
+	}), DefaultCachePolicy))
+	paths, _ = validate(t, r, "page", `{"user": {}}`)
+	require.Equal([]string{"user.name"}, paths)
+	paths, problems = validate(t, r, "broken", `{}`)
+	require.Equal([]string{""}, paths)
+	require.ErrorIs(problems[0], parse.ErrMissingClose)
+	paths, problems = validate(t, r, "unknown", `{}`)
+	require.Equal([]string{""}, paths)
+	require.ErrorIs(problems[0], ErrSourceNameNotFound)
+}
+
+func TestRender_ValidateThenRender(t *testing.T) {
+	_, require := testify.New(t)
+
+	r := withTemplates(t, "hello", "Hello {{name}}!")
+	ctx := context.New(map[string]interface{}{"name": "ana"})
+	require.Empty(r.Validate("hello", ctx))
+
+	buf := &bytes.Buffer{}
+	r.Writer(buf)
+	require.Nil(r.Render("hello", ctx))
+	require.Equal("Hello ana!", buf.String())
+
+	r = withTemplates(t, "bad", "{{#a}}")
+	problems := r.Validate("bad", ctx)
+	require.Len(problems, 1)
+	require.Equal("", problems[0].Path)
+}
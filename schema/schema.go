@@ -0,0 +1,246 @@
+// Package schema infers a JSON Schema describing the data a template needs.
+//
+// Every name used by a template is required. Names used as interpolations are scalars,
+// names used as sections are objects, lists or booleans, and the names used inside a
+// section are properties of the section value, or of each item when it is a list.
+package schema
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/mlctrez/mystace/context"
+	"github.com/mlctrez/mystace/parse"
+)
+
+// Draft is the JSON Schema dialect of inferred schemas
+const Draft = "https://json-schema.org/draft/2020-12/schema"
+
+// JSON Schema types
+const (
+	Object  = "object"
+	Array   = "array"
+	Boolean = "boolean"
+	String  = "string"
+	Number  = "number"
+)
+
+var ErrPartialNotFound = fmt.Errorf("partial not found")
+
+// Schema is the subset of JSON Schema used to describe template data
+type Schema struct {
+	Schema     string             `json:"$schema,omitempty"`
+	Title      string             `json:"title,omitempty"`
+	Type       Types              `json:"type,omitempty"`
+	Properties map[string]*Schema `json:"properties,omitempty"`
+	Required   []string           `json:"required,omitempty"`
+	Items      *Schema            `json:"items,omitempty"`
+}
+
+// Types are the allowed JSON types of a value
+type Types []string
+
+// MarshalJSON writes a single type as a string and several as an array
+func (t Types) MarshalJSON() ([]byte, error) {
+	if len(t) == 1 {
+		return json.Marshal(t[0])
+	}
+	return json.Marshal([]string(t))
+}
+
+// UnmarshalJSON reads a type as a string or an array
+func (t *Types) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*t = Types{single}
+		return nil
+	}
+	return json.Unmarshal(data, (*[]string)(t))
+}
+
+// Has reports whether typ is allowed
+func (t Types) Has(typ string) bool {
+	for _, s := range t {
+		if s == typ {
+			return true
+		}
+	}
+	return false
+}
+
+type Option func(i *inferrer) error
+
+// WithPartials makes trees available to {{> name}} tags by tree name. The names used
+// by a partial are inferred in the scope of the tag that includes it.
+func WithPartials(trees ...*parse.Tree) Option {
+	return func(i *inferrer) error {
+		for _, tree := range trees {
+			i.partials[tree.Name] = tree
+		}
+		return nil
+	}
+}
+
+// Infer derives the schema of the data used by tree
+func Infer(tree *parse.Tree, options ...Option) (s *Schema, err error) {
+	i := &inferrer{partials: map[string]*parse.Tree{}, including: map[string]bool{}}
+	for _, option := range options {
+		if err = option(i); err != nil {
+			return
+		}
+	}
+	root := newUse()
+	root.object = true
+	if err = i.nodes(tree.Nodes, []*use{root}); err != nil {
+		return
+	}
+	s = root.schema()
+	s.Schema = Draft
+	s.Title = tree.Name
+	return
+}
+
+// use collects how a name is used by a template
+type use struct {
+	object   bool
+	value    bool
+	section  bool
+	self     bool
+	children map[string]*use
+}
+
+func newUse() *use {
+	return &use{children: map[string]*use{}}
+}
+
+func (u *use) child(name string) *use {
+	c, ok := u.children[name]
+	if !ok {
+		c = newUse()
+		u.children[name] = c
+	}
+	return c
+}
+
+type inferrer struct {
+	partials  map[string]*parse.Tree
+	including map[string]bool
+}
+
+func (i *inferrer) nodes(nodes []parse.Node, scopes []*use) (err error) {
+	for _, n := range nodes {
+		switch nt := n.(type) {
+		case *parse.VariableNode:
+			resolve(scopes, nt.Name, func(u *use) { u.value = true })
+		case *parse.SectionNode:
+			var section *use
+			resolve(scopes, nt.Name, func(u *use) {
+				u.section = true
+				section = u
+			})
+			inner := scopes
+			if !nt.Inverted && section != nil {
+				inner = append(scopes[:len(scopes):len(scopes)], section)
+			}
+			err = i.nodes(nt.Nodes, inner)
+		case *parse.PartialNode:
+			if nt.Dynamic {
+				// the template is only known when rendering, its name is a value
+				resolve(scopes, nt.Name, func(u *use) { u.value = true })
+				continue
+			}
+			err = i.partial(nt, scopes)
+		}
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// partial infers the names of a partial in the current scope, stopping at recursive includes
+func (i *inferrer) partial(n *parse.PartialNode, scopes []*use) error {
+	tree, ok := i.partials[n.Name]
+	if !ok {
+		return &parse.Error{Range: n.Range(), Tag: n.Token.Data.Str, Err: fmt.Errorf("%q : %w", n.Name, ErrPartialNotFound)}
+	}
+	if i.including[n.Name] {
+		return nil
+	}
+	i.including[n.Name] = true
+	defer delete(i.including, n.Name)
+	return i.nodes(tree.Nodes, scopes)
+}
+
+// resolve applies the dotted name rules: the first segment belongs to the innermost scope
+// already using it, or else to the innermost scope, and the rest are nested properties.
+// Each leading context.ParentPrefix starts the search one scope further out.
+func resolve(scopes []*use, name string, mark func(u *use)) {
+	top := len(scopes) - 1
+	for strings.HasPrefix(name, context.ParentPrefix) {
+		name = strings.TrimPrefix(name, context.ParentPrefix)
+		if top > 0 {
+			top--
+		}
+	}
+	if name == context.ImplicitIterator {
+		scopes[top].self = true
+		return
+	}
+	names := strings.Split(name, ".")
+	var u *use
+	for s := top; s >= 0 && u == nil; s-- {
+		u = scopes[s].children[names[0]]
+	}
+	if u == nil {
+		u = scopes[top].child(names[0])
+	}
+	for _, n := range names[1:] {
+		u.object = true
+		u = u.child(n)
+	}
+	mark(u)
+}
+
+// schema converts the collected uses to a schema
+func (u *use) schema() *Schema {
+	s := &Schema{}
+	properties, required := u.properties()
+	if u.object || u.section {
+		s.Type = append(s.Type, Object)
+		s.Properties, s.Required = properties, required
+	}
+	if u.section {
+		s.Type = append(s.Type, Array, Boolean)
+		items := &Schema{}
+		if len(properties) > 0 {
+			items.Type = Types{Object}
+			items.Properties, items.Required = properties, required
+		}
+		if u.self {
+			items.Type = append(items.Type, String, Number)
+		}
+		if len(items.Type) > 0 {
+			s.Items = items
+		}
+	}
+	if u.value || u.self && !u.section {
+		s.Type = append(s.Type, String, Number)
+	}
+	return s
+}
+
+func (u *use) properties() (properties map[string]*Schema, required []string) {
+	if len(u.children) == 0 {
+		return
+	}
+	properties = map[string]*Schema{}
+	for name, c := range u.children {
+		properties[name] = c.schema()
+		required = append(required, name)
+	}
+	sort.Strings(required)
+	return
+}
@@ -0,0 +1,104 @@
+package schema
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/mlctrez/mystace/internal/testify"
+	"github.com/mlctrez/mystace/parse"
+	"github.com/mlctrez/mystace/source"
+)
+
+func parseString(t *testing.T, name, template string) *parse.Tree {
+	src, err := source.FromString(template, source.WithName(name))
+	testify.Require(t).Nil(err)
+	tree, err := parse.Parse(src)
+	testify.Require(t).Nil(err)
+	return tree
+}
+
+func TestInfer(t *testing.T) {
+	require := testify.Require(t)
+
+	tree := parseString(t, "invoice", `{{title}} {{customer.name}} {{customer.address.city}}
+{{#lines}}{{item}} {{price}} {{title}} {{../currency}}{{/lines}}
+{{^lines}}none{{/lines}}{{#tags}}{{.}}{{/tags}}
+{{#paid}}{{paid_on}}{{/paid}}{{> footer}}{{! {{ignored}} }}`)
+	footer := parseString(t, "footer", "{{company}}{{> footer}}")
+
+	s, err := Infer(tree, WithPartials(footer))
+	require.Nil(err)
+
+	data, err := json.MarshalIndent(s, "", "  ")
+	require.Nil(err)
+	require.JSONEq(`{
+  "$schema": "https://json-schema.org/draft/2020-12/schema",
+  "title": "invoice",
+  "type": "object",
+  "properties": {
+    "company": {"type": ["string", "number"]},
+    "currency": {"type": ["string", "number"]},
+    "customer": {
+      "type": "object",
+      "properties": {
+        "address": {
+          "type": "object",
+          "properties": {"city": {"type": ["string", "number"]}},
+          "required": ["city"]
+        },
+        "name": {"type": ["string", "number"]}
+      },
+      "required": ["address", "name"]
+    },
+    "lines": {
+      "type": ["object", "array", "boolean"],
+      "properties": {
+        "item": {"type": ["string", "number"]},
+        "price": {"type": ["string", "number"]}
+      },
+      "required": ["item", "price"],
+      "items": {
+        "type": "object",
+        "properties": {
+          "item": {"type": ["string", "number"]},
+          "price": {"type": ["string", "number"]}
+        },
+        "required": ["item", "price"]
+      }
+    },
+    "paid": {"type": ["object", "array", "boolean"], "properties": {"paid_on": {"type": ["string", "number"]}}, "required": ["paid_on"], "items": {"type": "object", "properties": {"paid_on": {"type": ["string", "number"]}}, "required": ["paid_on"]}},
+    "tags": {"type": ["object", "array", "boolean"], "items": {"type": ["string", "number"]}},
+    "title": {"type": ["string", "number"]}
+  },
+  "required": ["company", "currency", "customer", "lines", "paid", "tags", "title"]
+}`, string(data))
+
+	_, err = Infer(tree)
+	require.ErrorIs(err, ErrPartialNotFound)
+
+	s, err = Infer(parseString(t, "scalar", "{{.}}"))
+	require.Nil(err)
+	require.Equal(Types{Object, String, Number}, s.Type)
+
+	// the name of a dynamic partial is a value, the partial is not known
+	s, err = Infer(parseString(t, "dashboard", "{{#widgets}}{{>*kind}}{{/widgets}}"))
+	require.Nil(err)
+	require.Equal(Types{String, Number}, s.Properties["widgets"].Items.Properties["kind"].Type)
+
+	// a name used as a section and a value allows both
+	s, err = Infer(parseString(t, "both", "{{#name}}{{/name}}{{name}}"))
+	require.Nil(err)
+	require.Equal(Types{Object, Array, Boolean, String, Number}, s.Properties["name"].Type)
+}
+
+func TestTypes(t *testing.T) {
+	require := testify.Require(t)
+
+	var s Schema
+	require.Nil(json.Unmarshal([]byte(`{"type": "object", "properties": {"a": {"type": ["string", "number"]}}}`), &s))
+	require.Equal(Types{Object}, s.Type)
+	require.Equal(Types{String, Number}, s.Properties["a"].Type)
+	require.True(s.Properties["a"].Type.Has(Number))
+	require.False(s.Type.Has(Array))
+	require.NotNil(json.Unmarshal([]byte(`{"type": 1}`), &s))
+}
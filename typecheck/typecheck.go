@@ -0,0 +1,297 @@
+// Package typecheck validates the names used by a template against a Go type, so a
+// typo such as {{user.emial}} is reported instead of rendering as an empty string.
+//
+// Checks can run in tests or from a go generate step with a small program:
+//
+//	//go:generate go run ./internal/checktemplates
+//
+//	func main() {
+//		if err := typecheck.Files(billing.Invoice{}, "templates/invoice.mustache"); err != nil {
+//			log.Fatal(err)
+//		}
+//	}
+package typecheck
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mlctrez/mystace/parse"
+	"github.com/mlctrez/mystace/source"
+)
+
+var (
+	ErrUnknownName = fmt.Errorf("unknown name")
+	ErrNotAValue   = fmt.Errorf("not a value")
+	ErrNotASection = fmt.Errorf("not a section")
+	ErrProblems    = fmt.Errorf("template problems")
+)
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// Problem is a name in a template that does not match the checked type
+type Problem struct {
+	Source string
+	Range  source.Range
+	Tag    string
+	Err    error
+}
+
+func (p Problem) Error() string {
+	return fmt.Sprintf("%s:%d:%d: %s : %s", p.Source, p.Range.Start.Line, p.Range.Start.Column, p.Tag, p.Err)
+}
+
+func (p Problem) Unwrap() error {
+	return p.Err
+}
+
+type Option func(c *checker)
+
+// WithNumericIndexes accepts list items addressed by index in dotted names: {{items.0.name}},
+// as rendered with render.WithNumericIndexes
+func WithNumericIndexes() Option {
+	return func(c *checker) {
+		c.numericIndexes = true
+	}
+}
+
+// Check walks tree and reports every variable and section whose name cannot be resolved
+// in the type of v, following the scope changes of sections. Values of interface and
+// map types may hold anything, so names below them are not checked, nor is the text
+// of sections that are lambdas.
+func Check(tree *parse.Tree, v interface{}, options ...Option) (problems []Problem) {
+	c := &checker{name: tree.Name}
+	for _, option := range options {
+		option(c)
+	}
+	c.nodes(tree.Nodes, []reflect.Type{reflect.TypeOf(v)})
+	return c.problems
+}
+
+// Files parses and checks the template files at paths against the type of v,
+// returning the problems of all files joined in a single error
+func Files(v interface{}, paths ...string) error {
+	return CheckFiles(v, paths)
+}
+
+// CheckFiles is Files with options
+func CheckFiles(v interface{}, paths []string, options ...Option) error {
+	var problems []string
+	for _, path := range paths {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		var src source.Source
+		if src, err = source.FromReadCloser(f, source.WithName(path)); err != nil {
+			return err
+		}
+		var tree *parse.Tree
+		if tree, err = parse.Parse(src); err != nil {
+			return err
+		}
+		for _, p := range Check(tree, v, options...) {
+			problems = append(problems, p.Error())
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%w\n%s", ErrProblems, strings.Join(problems, "\n"))
+	}
+	return nil
+}
+
+// Field finds the field of a struct, or pointer to struct, type named name in templates.
+// Fields promoted through embedded pointers are not visible as they may be nil.
+func Field(t reflect.Type, name string) (field reflect.StructField, ok bool) {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct || t == timeType {
+		return
+	}
+	for _, f := range reflect.VisibleFields(t) {
+		if !f.IsExported() || f.Anonymous || !directField(t, f.Index) {
+			continue
+		}
+		if fieldName, ok := FieldName(f); ok && fieldName == name {
+			return f, true
+		}
+	}
+	return
+}
+
+func directField(t reflect.Type, index []int) bool {
+	for _, i := range index[:len(index)-1] {
+		t = t.Field(i).Type
+		if t.Kind() == reflect.Ptr {
+			return false
+		}
+	}
+	return true
+}
+
+// FieldName returns the name of a struct field in templates: the mystace tag, the json tag or
+// the field name. ok is false for fields tagged mystace:"-", or json:"-" without a mystace name,
+// as the json encoding of the value, and so the renderer, does not see them.
+func FieldName(f reflect.StructField) (name string, ok bool) {
+	for _, key := range []string{"mystace", "json"} {
+		tag := f.Tag.Get(key)
+		if tag == "-" {
+			return "", false
+		}
+		if name, _, _ = strings.Cut(tag, ","); name != "" {
+			return name, true
+		}
+	}
+	return f.Name, true
+}
+
+type checker struct {
+	name           string
+	numericIndexes bool
+	problems       []Problem
+}
+
+func (c *checker) report(n parse.Node, tag string, err error) {
+	c.problems = append(c.problems, Problem{Source: c.name, Range: n.Range(), Tag: tag, Err: err})
+}
+
+// nodes checks nodes with frames in scope, a nil frame is a value of unknown type
+func (c *checker) nodes(nodes []parse.Node, frames []reflect.Type) {
+	for _, n := range nodes {
+		switch nt := n.(type) {
+		case *parse.VariableNode:
+			t, ok := c.resolve(frames, nt.Name)
+			switch {
+			case !ok:
+				c.report(nt, nt.Token.Data.Str, fmt.Errorf("%q : %w", nt.Name, ErrUnknownName))
+			case !isValue(t):
+				c.report(nt, nt.Token.Data.Str, fmt.Errorf("%q of type %s : %w", nt.Name, t, ErrNotAValue))
+			}
+		case *parse.SectionNode:
+			t, ok := c.resolve(frames, nt.Name)
+			if !ok {
+				c.report(nt, nt.Token.Data.Str, fmt.Errorf("%q : %w", nt.Name, ErrUnknownName))
+				continue
+			}
+			scope, push, isSection := sectionFrame(t)
+			switch {
+			case !isSection:
+				c.report(nt, nt.Token.Data.Str, fmt.Errorf("%q of type %s : %w", nt.Name, t, ErrNotASection))
+			case isLambda(t):
+			case nt.Inverted || !push:
+				c.nodes(nt.Nodes, frames)
+			default:
+				c.nodes(nt.Nodes, append(frames[:len(frames):len(frames)], scope))
+			}
+		}
+	}
+}
+
+// resolve finds the type of name, ok is false when the name cannot exist in the frames
+func (c *checker) resolve(frames []reflect.Type, name string) (t reflect.Type, ok bool) {
+	if name == "." {
+		return frames[len(frames)-1], true
+	}
+	names := strings.Split(name, ".")
+	for i := len(frames) - 1; i >= 0; i-- {
+		var found bool
+		if t, found = c.member(frames[i], names[0]); found {
+			return c.path(t, names[1:])
+		}
+	}
+	return nil, false
+}
+
+// member returns the type of the value name holds in a value of type t, list items are
+// only addressed by index with WithNumericIndexes
+func (c *checker) member(t reflect.Type, name string) (reflect.Type, bool) {
+	if t == nil {
+		return nil, true
+	}
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Interface:
+		return nil, true
+	case reflect.Map:
+		if t.Key().Kind() == reflect.String {
+			return dynamic(t.Elem()), true
+		}
+	case reflect.Slice, reflect.Array:
+		if _, err := strconv.Atoi(name); err == nil && c.numericIndexes {
+			return dynamic(t.Elem()), true
+		}
+	case reflect.Struct:
+		if field, ok := Field(t, name); ok {
+			return field.Type, true
+		}
+	}
+	return nil, false
+}
+
+func (c *checker) path(t reflect.Type, names []string) (reflect.Type, bool) {
+	for _, name := range names {
+		var ok bool
+		if t, ok = c.member(t, name); !ok {
+			return nil, false
+		}
+	}
+	return t, true
+}
+
+// dynamic returns nil for interface types, whose values are only known when rendering
+func dynamic(t reflect.Type) reflect.Type {
+	if t.Kind() == reflect.Interface {
+		return nil
+	}
+	return t
+}
+
+func isLambda(t reflect.Type) bool {
+	return t != nil && t.Kind() == reflect.Func
+}
+
+// isValue reports whether values of type t can be interpolated
+func isValue(t reflect.Type) bool {
+	if t == nil {
+		return true
+	}
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.String, reflect.Float32, reflect.Float64, reflect.Func, reflect.Interface,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return true
+	}
+	return t == timeType
+}
+
+// sectionFrame returns the type of the frame pushed by a section over a value of type t,
+// nil for values of unknown type. push is false when the section does not change scope.
+func sectionFrame(t reflect.Type) (scope reflect.Type, push bool, ok bool) {
+	if t == nil {
+		return nil, true, true
+	}
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Bool, reflect.Func:
+		return nil, false, true
+	case reflect.Slice, reflect.Array:
+		return dynamic(t.Elem()), true, true
+	case reflect.Struct:
+		return t, true, t != timeType
+	case reflect.Chan, reflect.Complex64, reflect.Complex128, reflect.UnsafePointer:
+		return nil, false, false
+	}
+	return dynamic(t), true, true
+}
@@ -0,0 +1,161 @@
+package typecheck
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/mlctrez/mystace/context"
+	"github.com/mlctrez/mystace/internal/fixtures"
+	"github.com/mlctrez/mystace/internal/testify"
+	"github.com/mlctrez/mystace/parse"
+	"github.com/mlctrez/mystace/source"
+)
+
+func check(t *testing.T, template string, v interface{}, options ...Option) []Problem {
+	src, err := source.FromString(template, source.WithName("test"))
+	testify.Require(t).Nil(err)
+	tree, err := parse.Parse(src)
+	testify.Require(t).Nil(err)
+	return Check(tree, v, options...)
+}
+
+type page struct {
+	Title   string
+	Invoice *fixtures.Invoice      `json:"invoice"`
+	Meta    map[string]interface{} `json:"meta"`
+	Counts  map[string]int         `json:"counts"`
+	Extra   interface{}            `json:"extra"`
+	Upper   context.Lambda         `json:"upper"`
+	Scores  []float64              `json:"scores"`
+	Tags    [2]string              `json:"tags"`
+	Channel chan int               `json:"channel"`
+}
+
+func TestCheck(t *testing.T) {
+	require := testify.Require(t)
+
+	valid := `{{Title}}
+{{#invoice}}{{number}} {{issued}} {{author}} {{memo}}
+{{#customer}}{{name}} {{email}} {{address.city}} {{Title}}{{/customer}}
+{{#lines}}{{item}} {{quantity}} {{price}} {{tax.rate}} {{#tax}}{{rate}}{{/tax}} {{number}}{{/lines}}
+{{^lines}}none{{/lines}}
+{{#notes}}{{.}}{{/notes}}
+{{#paid}}{{total}}{{/paid}}{{#discount}}{{.}}{{/discount}}
+{{/invoice}}
+{{invoice.customer.address.city}} {{meta.anything.at.all}} {{#meta}}{{whatever}}{{/meta}}
+{{counts.views}} {{#extra}}{{unknown}}{{/extra}} {{extra.a.b}}
+{{#upper}}{{not checked}}{{/upper}} {{upper}}
+{{#scores}}{{.}}{{/scores}}
+{{! {{comments.are.ignored}} }}`
+	require.Empty(check(t, valid, page{}))
+	require.Empty(check(t, valid, &page{}))
+
+	problems := check(t, `{{invoice.customer.emial}}
+{{#invoice}}{{#lines}}{{quantity}}{{custmer}}{{/lines}}{{/invoice}}
+{{#missing}}{{anything}}{{/missing}}
+{{invoice}} {{#invoice.lines}}{{#item}}{{/item}}{{/invoice.lines}} {{#invoice.issued}}{{/invoice.issued}}
+{{#channel}}{{/channel}} {{invoice.paid}} {{scores.first}}`, page{})
+
+	var messages []string
+	for _, p := range problems {
+		messages = append(messages, p.Error())
+	}
+	require.Equal([]string{
+		`test:1:1: {{invoice.customer.emial}} : "invoice.customer.emial" : unknown name`,
+		`test:2:35: {{custmer}} : "custmer" : unknown name`,
+		`test:3:1: {{#missing}} : "missing" : unknown name`,
+		`test:4:1: {{invoice}} : "invoice" of type *fixtures.Invoice : not a value`,
+		`test:4:68: {{#invoice.issued}} : "invoice.issued" of type time.Time : not a section`,
+		`test:5:1: {{#channel}} : "channel" of type chan int : not a section`,
+		`test:5:26: {{invoice.paid}} : "invoice.paid" of type bool : not a value`,
+		`test:5:43: {{scores.first}} : "scores.first" : unknown name`,
+	}, messages)
+	require.ErrorIs(problems[0], ErrUnknownName)
+	require.Equal(1, problems[0].Range.Start.Line)
+
+	// list items are addressed by index as the renderer does with numeric indexes
+	indexed := "{{scores.0}} {{tags.1}} {{invoice.lines.0.item}}"
+	require.Empty(check(t, indexed, page{}, WithNumericIndexes()))
+	problems = check(t, indexed, page{})
+	require.Len(problems, 3)
+	require.ErrorIs(problems[2], ErrUnknownName)
+
+	// anything goes without a type
+	require.Empty(check(t, "{{a.b}}{{#c}}{{d}}{{/c}}", nil))
+}
+
+func TestField(t *testing.T) {
+	require := testify.Require(t)
+
+	invoiceType := reflect.TypeOf(&fixtures.Invoice{})
+	field, ok := Field(invoiceType, "memo")
+	require.True(ok)
+	require.Equal("Memo", field.Name)
+	_, ok = Field(invoiceType, "Memo")
+	require.False(ok)
+	field, ok = Field(invoiceType, "author")
+	require.True(ok)
+	require.Equal([]int{9, 0}, field.Index)
+	_, ok = Field(invoiceType, "Audit")
+	require.False(ok)
+
+	type embedded struct {
+		*fixtures.Audit
+		Title string
+		title string
+	}
+	_, ok = Field(reflect.TypeOf(embedded{}), "author")
+	require.False(ok)
+	_, ok = Field(reflect.TypeOf(embedded{}), "Title")
+	require.True(ok)
+	_, ok = Field(reflect.TypeOf(embedded{}), "title")
+	require.False(ok)
+	_, ok = Field(reflect.TypeOf(""), "x")
+	require.False(ok)
+
+	// fields the json encoding drops are not rendered either
+	type excluded struct {
+		Secret string `json:"-"`
+		Hidden string `mystace:"-" json:"hidden"`
+		Dash   string `json:"-,"`
+	}
+	for _, name := range []string{"Secret", "-", "Hidden", "hidden"} {
+		_, ok = Field(reflect.TypeOf(excluded{}), name)
+		require.Equal(name == "-", ok, name)
+	}
+	problems := check(t, "{{Secret}}", excluded{})
+	require.Len(problems, 1)
+	require.ErrorIs(problems[0], ErrUnknownName)
+}
+
+func TestFiles(t *testing.T) {
+	require := testify.Require(t)
+
+	dir := t.TempDir()
+	good := filepath.Join(dir, "good.mustache")
+	bad := filepath.Join(dir, "bad.mustache")
+	require.Nil(os.WriteFile(good, []byte("{{number}}"), 0644))
+	require.Nil(os.WriteFile(bad, []byte("{{numbr}}\n{{#lines}}{{itme}}{{/lines}}"), 0644))
+
+	require.Nil(Files(fixtures.Invoice{}, good))
+
+	indexed := filepath.Join(dir, "indexed.mustache")
+	require.Nil(os.WriteFile(indexed, []byte("{{lines.0.item}}"), 0644))
+	require.ErrorIs(Files(fixtures.Invoice{}, indexed), ErrProblems)
+	require.Nil(CheckFiles(fixtures.Invoice{}, []string{good, indexed}, WithNumericIndexes()))
+
+	err := Files(fixtures.Invoice{}, good, bad)
+	require.ErrorIs(err, ErrProblems)
+	require.Contains(err.Error(), bad+`:1:1: {{numbr}} : "numbr" : unknown name`)
+	require.Contains(err.Error(), bad+`:2:11: {{itme}} : "itme" : unknown name`)
+
+	err = Files(fixtures.Invoice{}, filepath.Join(dir, "missing.mustache"))
+	require.True(errors.Is(err, os.ErrNotExist))
+
+	unclosed := filepath.Join(dir, "unclosed.mustache")
+	require.Nil(os.WriteFile(unclosed, []byte("{{#lines}}"), 0644))
+	require.ErrorIs(Files(fixtures.Invoice{}, unclosed), parse.ErrMissingClose)
+}